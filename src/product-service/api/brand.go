@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
 	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
 )
 
 type BrandRequest struct {
@@ -31,11 +33,13 @@ func RegisterBrandRoutes(rg *gin.RouterGroup, repo repository.BaseRepository[dom
 	handler := NewBrandHandler(repo)
 
 	rg.GET("", handler.GetAll)
-	rg.POST("", handler.AddBrand)
-	rg.POST("batch", handler.AddBatchBrand)
 	rg.GET("/:id", middleware.UUIDParamMiddleware("id"), handler.GetBrandById)
-	rg.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateBrand)
-	rg.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteBrand)
+
+	staff := rg.Group("", middleware.Permitted(auth.PermissionBrandWrite)...)
+	staff.POST("", handler.AddBrand)
+	staff.POST("batch", handler.AddBatchBrand)
+	staff.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateBrand)
+	staff.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteBrand)
 
 }
 
@@ -103,6 +107,10 @@ func (h *BrandHandler) GetBrandById(c *gin.Context) {
 		return
 	}
 
+	if notModified(c, brand) {
+		return
+	}
+
 	c.JSON(http.StatusOK, BaseResponse{
 		Success: true,
 		Data:    brand,
@@ -121,7 +129,7 @@ func (h *BrandHandler) UpdateBrand(c *gin.Context) {
 		return
 	}
 
-	brand, err := h.repo.FindByID(c, id)
+	brand, err := findForWrite(c, h.repo, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
@@ -132,6 +140,9 @@ func (h *BrandHandler) UpdateBrand(c *gin.Context) {
 	}
 
 	if brand == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: fmt.Sprintf("Not found brand %v", id),
@@ -139,15 +150,26 @@ func (h *BrandHandler) UpdateBrand(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, ok := checkIfMatch(c, brand)
+	if !ok {
+		return
+	}
+
 	opts := repository.UpdateOptions{
 		ExpressionAttributes: map[string]any{
 			"name": request.Name,
 		},
-		ReturnValues: types.ReturnValueAllNew,
+		ReturnValues:    types.ReturnValueAllNew,
+		ExpectedVersion: expectedVersion,
 	}
 
 	updated, err := h.repo.Update(c, brand, opts)
 
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
@@ -156,6 +178,7 @@ func (h *BrandHandler) UpdateBrand(c *gin.Context) {
 		return
 	}
 
+	setValidators(c, updated)
 	c.JSON(http.StatusOK, BaseResponse{
 		Success: true,
 		Message: "Brand updated successfully",
@@ -166,7 +189,7 @@ func (h *BrandHandler) UpdateBrand(c *gin.Context) {
 func (h *BrandHandler) DeleteBrand(c *gin.Context) {
 	id := c.Param("id")
 
-	brand, err := h.repo.FindByID(c, id)
+	brand, err := findForWrite(c, h.repo, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
@@ -177,6 +200,9 @@ func (h *BrandHandler) DeleteBrand(c *gin.Context) {
 	}
 
 	if brand == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: "Not found brand",
@@ -184,9 +210,19 @@ func (h *BrandHandler) DeleteBrand(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, ok := checkIfMatch(c, brand)
+	if !ok {
+		return
+	}
+
 	// Handle check products
 
-	err = h.repo.DeleteByID(c, id)
+	err = deleteIfVersion(c, h.repo, id, expectedVersion)
+
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
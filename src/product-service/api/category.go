@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -10,10 +11,12 @@ import (
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
 	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
 )
 
 type CategoryRequest struct {
-	Name string `json:"name"`
+	Name       string                       `json:"name"`
+	Attributes []domain.AttributeDefinition `json:"attributes"`
 }
 
 type CategoryHandler struct {
@@ -30,10 +33,12 @@ func RegisterCategoryRoutes(rg *gin.RouterGroup, repo repository.BaseRepository[
 	handler := NewCategoryHandler(repo)
 
 	rg.GET("", handler.GetAll)
-	rg.POST("", handler.AddCategory)
 	rg.GET("/:id", middleware.UUIDParamMiddleware("id"), handler.GetCategoryById)
-	rg.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateCategory)
-	rg.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteCategory)
+
+	staff := rg.Group("", middleware.Permitted(auth.PermissionCategoryWrite)...)
+	staff.POST("", handler.AddCategory)
+	staff.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateCategory)
+	staff.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteCategory)
 }
 
 func (h *CategoryHandler) GetAll(c *gin.Context) {
@@ -60,9 +65,18 @@ func (h *CategoryHandler) AddCategory(c *gin.Context) {
 		return
 	}
 
+	if err := domain.ValidateAttributeSchema(request.Attributes); err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	category := domain.Category{
-		Id:   uuid.New().String(),
-		Name: request.Name,
+		Id:         uuid.New().String(),
+		Name:       request.Name,
+		Attributes: request.Attributes,
 	}
 
 	if err := h.repo.Save(c, &category); err != nil {
@@ -100,6 +114,10 @@ func (h *CategoryHandler) GetCategoryById(c *gin.Context) {
 		return
 	}
 
+	if notModified(c, category) {
+		return
+	}
+
 	c.JSON(http.StatusOK, BaseResponse{
 		Success: true,
 		Data:    category,
@@ -118,7 +136,15 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.repo.FindByID(c, id)
+	if err := domain.ValidateAttributeSchema(request.Attributes); err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	category, err := findForWrite(c, h.repo, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
@@ -129,6 +155,9 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	}
 
 	if category == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: fmt.Sprintf("Not found category %v", id),
@@ -136,15 +165,27 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, ok := checkIfMatch(c, category)
+	if !ok {
+		return
+	}
+
 	opts := repository.UpdateOptions{
 		ExpressionAttributes: map[string]any{
-			"name": request.Name,
+			"name":       request.Name,
+			"attributes": request.Attributes,
 		},
-		ReturnValues: types.ReturnValueAllNew,
+		ReturnValues:    types.ReturnValueAllNew,
+		ExpectedVersion: expectedVersion,
 	}
 
 	updated, err := h.repo.Update(c, category, opts)
 
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
@@ -153,6 +194,7 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
+	setValidators(c, updated)
 	c.JSON(http.StatusOK, BaseResponse{
 		Success: true,
 		Message: "Category updated successfully",
@@ -163,7 +205,7 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
 
-	category, err := h.repo.FindByID(c, id)
+	category, err := findForWrite(c, h.repo, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
@@ -174,6 +216,9 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	}
 
 	if category == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, BaseResponse{
 			Success: false,
 			Message: "Not found category",
@@ -181,9 +226,19 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, ok := checkIfMatch(c, category)
+	if !ok {
+		return
+	}
+
 	// Handle check products in this category if needed
 
-	err = h.repo.DeleteByID(c, id)
+	err = deleteIfVersion(c, h.repo, id, expectedVersion)
+
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+)
+
+// entityETag returns a strong ETag derived from the entity version
+func entityETag(entity domain.VersionedEntity) string {
+	return `"` + strconv.Itoa(entity.GetVersion()) + `"`
+}
+
+// setValidators writes the ETag and Last-Modified headers for entity
+func setValidators(c *gin.Context, entity any) {
+	if versioned, ok := entity.(domain.VersionedEntity); ok {
+		c.Header("ETag", entityETag(versioned))
+	}
+
+	if timestamped, ok := entity.(domain.TimestampedEntity); ok && timestamped.GetUpdatedAt() > 0 {
+		c.Header("Last-Modified", time.Unix(timestamped.GetUpdatedAt(), 0).UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified answers a GET with 304 when the client copy is still current. If-None-Match
+// takes precedence over If-Modified-Since, as RFC 9110 requires.
+func notModified(c *gin.Context, entity any) bool {
+	setValidators(c, entity)
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		versioned, ok := entity.(domain.VersionedEntity)
+		if !ok || !etagMatches(ifNoneMatch, entityETag(versioned), false) {
+			return false
+		}
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" {
+		timestamped, ok := entity.(domain.TimestampedEntity)
+		if !ok {
+			return false
+		}
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil || timestamped.GetUpdatedAt() > since.Unix() {
+			return false
+		}
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// checkIfMatch compares If-Match with the current entity. It returns the version the
+// write must be conditioned on, or writes 412 and returns false when the client copy is stale.
+func checkIfMatch(c *gin.Context, entity any) (*int, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	versioned, ok := entity.(domain.VersionedEntity)
+	if ifMatch == "" || !ok {
+		return nil, true
+	}
+
+	current := entityETag(versioned)
+	if !etagMatches(ifMatch, current, true) {
+		c.Header("ETag", current)
+		preconditionFailed(c)
+		return nil, false
+	}
+
+	version := versioned.GetVersion()
+	return &version, true
+}
+
+// ifMatchMissing writes 412 and returns true when the client sent If-Match for an
+// entity that does not exist: no current representation can match it (RFC 9110 13.1.1)
+func ifMatchMissing(c *gin.Context) bool {
+	if c.GetHeader("If-Match") == "" {
+		return false
+	}
+	preconditionFailed(c)
+	return true
+}
+
+// findForWrite reads the entity with strong consistency when the client sent If-Match,
+// so the precondition is not checked against a stale copy
+func findForWrite[T domain.DynamoEntity](c *gin.Context, repo repository.BaseRepository[T], id string) (*T, error) {
+	if c.GetHeader("If-Match") != "" {
+		return repo.FindByIDConsistent(c, id)
+	}
+	return repo.FindByID(c, id)
+}
+
+// deleteIfVersion deletes the entity, conditioned on expectedVersion when If-Match was sent
+func deleteIfVersion[T domain.DynamoEntity](c *gin.Context, repo repository.BaseRepository[T], id string, expectedVersion *int) error {
+	if expectedVersion != nil {
+		return repo.DeleteByIDIfVersion(c, id, *expectedVersion)
+	}
+	return repo.DeleteByID(c, id)
+}
+
+func preconditionFailed(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, BaseResponse{
+		Success: false,
+		Message: "Resource has been modified",
+	})
+}
+
+// etagMatches reports whether header lists etag or is "*". Strong comparison never
+// matches weak tags; weak comparison ignores the W/ prefix.
+func etagMatches(header string, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak, found := strings.CutPrefix(candidate, "W/"); found {
+			if strong {
+				continue
+			}
+			candidate = weak
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
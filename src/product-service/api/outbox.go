@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+// failedOutboxEventsLimit bounds how many failed events are listed at once
+const failedOutboxEventsLimit = 100
+
+type OutboxHandler struct {
+	repo repository.OutboxRepository
+}
+
+func NewOutboxHandler(repo repository.OutboxRepository) *OutboxHandler {
+	return &OutboxHandler{
+		repo: repo,
+	}
+}
+
+// RegisterOutboxRoutes lets operators deal with catalog events the relay gave up on.
+// Each holds back the later events of its aggregate until it is republished or dismissed.
+func RegisterOutboxRoutes(rg *gin.RouterGroup, repo repository.OutboxRepository) {
+	handler := NewOutboxHandler(repo)
+
+	failed := rg.Group("/failed", middleware.Permitted(auth.PermissionOutboxManage)...)
+	failed.GET("", handler.GetFailedEvents)
+	failed.POST("/:id/republish", middleware.UUIDParamMiddleware("id"), handler.RepublishEvent)
+	failed.POST("/:id/dismiss", middleware.UUIDParamMiddleware("id"), handler.DismissEvent)
+}
+
+// GetFailedEvents lists the oldest failed events first, with the error they failed on
+func (h *OutboxHandler) GetFailedEvents(c *gin.Context) {
+	events, err := h.repo.FindFailed(c, failedOutboxEventsLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving failed events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: events})
+}
+
+// RepublishEvent hands a failed event back to the relay, for after its cause is fixed
+func (h *OutboxHandler) RepublishEvent(c *gin.Context) {
+	h.resolve(c, h.repo.Republish, "Event will be republished")
+}
+
+// DismissEvent drops a failed event for good and releases the events held behind it
+func (h *OutboxHandler) DismissEvent(c *gin.Context) {
+	h.resolve(c, h.repo.Dismiss, "Event dismissed")
+}
+
+func (h *OutboxHandler) resolve(c *gin.Context, action func(ctx context.Context, id string) error, message string) {
+	err := action(c, c.Param("id"))
+	if errors.Is(err, repository.ErrOutboxEventNotFailed) {
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Failed event not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error updating event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Message: message})
+}
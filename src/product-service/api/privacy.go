@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+// ReviewVote is a vote a user cast on a review. Which way they voted is not kept.
+type ReviewVote struct {
+	ReviewID  string `json:"reviewId"`
+	ProductID string `json:"productId"`
+}
+
+// UserDataExport is the personal data this service holds about one user
+type UserDataExport struct {
+	Reviews []domain.Review `json:"reviews"`
+	Votes   []ReviewVote    `json:"votes"`
+}
+
+type PrivacyHandler struct {
+	reviewRepo repository.ReviewRepository
+}
+
+func NewPrivacyHandler(reviewRepo repository.ReviewRepository) *PrivacyHandler {
+	return &PrivacyHandler{
+		reviewRepo: reviewRepo,
+	}
+}
+
+// RegisterPrivacyRoutes are the hooks user-service calls when a user exports their
+// data or their account is erased. Both are idempotent.
+func RegisterPrivacyRoutes(rg *gin.RouterGroup, reviewRepo repository.ReviewRepository) {
+	handler := NewPrivacyHandler(reviewRepo)
+
+	users := rg.Group("", middleware.Permitted(auth.PermissionPersonalDataManage)...)
+	users.GET("/:userId", middleware.UUIDParamMiddleware("userId"), handler.ExportUserData)
+	users.DELETE("/:userId", middleware.UUIDParamMiddleware("userId"), handler.EraseUserData)
+}
+
+// ExportUserData returns the reviews a user wrote and the reviews they voted on
+func (h *PrivacyHandler) ExportUserData(c *gin.Context) {
+	userId := c.Param("userId")
+
+	reviews, err := h.reviewRepo.FindByUser(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving reviews"})
+		return
+	}
+
+	voted, err := h.reviewRepo.FindVotedBy(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving votes"})
+		return
+	}
+
+	votes := make([]ReviewVote, 0, len(voted))
+	for _, review := range voted {
+		votes = append(votes, ReviewVote{ReviewID: review.ID, ProductID: review.ProductID})
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: UserDataExport{Reviews: reviews, Votes: votes}})
+}
+
+// EraseUserData detaches a user from their reviews and votes, see Anonymize for
+// what is kept of the reviews they wrote
+func (h *PrivacyHandler) EraseUserData(c *gin.Context) {
+	userId := c.Param("userId")
+
+	reviews, err := h.reviewRepo.FindByUser(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving reviews"})
+		return
+	}
+
+	voted, err := h.reviewRepo.FindVotedBy(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving votes"})
+		return
+	}
+
+	// Reviews the user wrote go first: anonymizing them also drops their vote, and
+	// the votes left on their old ids are then skipped as deleted
+	for _, review := range append(reviews, voted...) {
+		if err := h.reviewRepo.Anonymize(c, &review, userId); err != nil {
+			c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error anonymizing review"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Message: "User data erased"})
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gin-gonic/gin"
@@ -10,31 +12,36 @@ import (
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
 	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
 )
 
 type ProductRequest struct {
-	Name       string  `json:"name"`
-	BrandId    string  `json:"brandId"`
-	CategoryId string  `json:"categoryId"`
-	Price      float64 `json:"price"`
+	Name       string         `json:"name"`
+	BrandId    string         `json:"brandId"`
+	CategoryId string         `json:"categoryId"`
+	Price      float64        `json:"price"`
+	Attributes map[string]any `json:"attributes"`
 }
 
 type ProductHandler struct {
-	repo repository.ProductRepository
+	repo         repository.ProductRepository
+	categoryRepo repository.BaseRepository[domain.Category]
 }
 
-func NewProductHandler(repo repository.ProductRepository) *ProductHandler {
-	return &ProductHandler{repo: repo}
+func NewProductHandler(repo repository.ProductRepository, categoryRepo repository.BaseRepository[domain.Category]) *ProductHandler {
+	return &ProductHandler{repo: repo, categoryRepo: categoryRepo}
 }
 
-func RegisterProductRoutes(rg *gin.RouterGroup, repo repository.ProductRepository) {
-	handler := NewProductHandler(repo)
+func RegisterProductRoutes(rg *gin.RouterGroup, repo repository.ProductRepository, categoryRepo repository.BaseRepository[domain.Category]) {
+	handler := NewProductHandler(repo, categoryRepo)
 
 	rg.GET("", handler.GetAll)
-	rg.POST("", handler.AddProduct)
 	rg.GET("/:id", middleware.UUIDParamMiddleware("id"), handler.GetProductById)
-	rg.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateProduct)
-	rg.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteProduct)
+
+	staff := rg.Group("", middleware.Permitted(auth.PermissionProductWrite)...)
+	staff.POST("", handler.AddProduct)
+	staff.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateProduct)
+	staff.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteProduct)
 
 	// optional: expose your custom repo methods
 	rg.GET("/brand/:brandId", handler.GetByBrand)
@@ -44,8 +51,22 @@ func RegisterProductRoutes(rg *gin.RouterGroup, repo repository.ProductRepositor
 
 // ------------------ Handlers ------------------
 
+// GetAll lists products. Filters: ?categoryId=, ?attr[key]=value, ?attrMin[key]=n, ?attrMax[key]=n
 func (h *ProductHandler) GetAll(c *gin.Context) {
-	products, err := h.repo.ScanItems(c)
+	filters, err := parseAttributeFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	categoryId := c.Query("categoryId")
+
+	var products []domain.Product
+	if categoryId == "" && len(filters) == 0 {
+		products, err = h.repo.ScanItems(c)
+	} else {
+		products, err = h.repo.FindByAttributes(c, categoryId, filters)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
 		return
@@ -60,12 +81,18 @@ func (h *ProductHandler) AddProduct(c *gin.Context) {
 		return
 	}
 
+	attributes, ok := h.validateAttributes(c, request)
+	if !ok {
+		return
+	}
+
 	product := domain.Product{
 		ID:         uuid.New().String(),
 		Name:       request.Name,
 		BrandID:    request.BrandId,
 		CategoryID: request.CategoryId,
 		Price:      request.Price,
+		Attributes: attributes,
 	}
 
 	if err := h.repo.Save(c, &product); err != nil {
@@ -90,6 +117,10 @@ func (h *ProductHandler) GetProductById(c *gin.Context) {
 		return
 	}
 
+	if notModified(c, product) {
+		return
+	}
+
 	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: product})
 }
 
@@ -102,49 +133,82 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.repo.FindByID(c, id)
+	product, err := findForWrite(c, h.repo, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
 		return
 	}
 	if product == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: fmt.Sprintf("Not found product %v", id)})
 		return
 	}
 
+	expectedVersion, ok := checkIfMatch(c, product)
+	if !ok {
+		return
+	}
+
+	attributes, ok := h.validateAttributes(c, request)
+	if !ok {
+		return
+	}
+
 	opts := repository.UpdateOptions{
 		ExpressionAttributes: map[string]any{
 			"name":       request.Name,
-			"brandId":    request.BrandId,
-			"categoryId": request.CategoryId,
+			"brandId":    optionalKey(request.BrandId),
+			"categoryId": optionalKey(request.CategoryId),
 			"price":      request.Price,
+			"attributes": attributes,
 		},
-		ReturnValues: types.ReturnValueAllNew,
+		ReturnValues:    types.ReturnValueAllNew,
+		ExpectedVersion: expectedVersion,
 	}
 
 	updated, err := h.repo.Update(c, product, opts)
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
 		return
 	}
 
+	setValidators(c, updated)
 	c.JSON(http.StatusOK, BaseResponse{Success: true, Message: "Product updated successfully", Data: updated})
 }
 
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
 
-	product, err := h.repo.FindByID(c, id)
+	product, err := findForWrite(c, h.repo, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
 		return
 	}
 	if product == nil {
+		if ifMatchMissing(c) {
+			return
+		}
 		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Product not found"})
 		return
 	}
 
-	if err := h.repo.DeleteByID(c, id); err != nil {
+	expectedVersion, ok := checkIfMatch(c, product)
+	if !ok {
+		return
+	}
+
+	err = deleteIfVersion(c, h.repo, id, expectedVersion)
+	if errors.Is(err, repository.ErrConcurrentUpdate) {
+		preconditionFailed(c)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
 		return
 	}
@@ -189,3 +253,94 @@ func (h *ProductHandler) SearchByName(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: products})
 }
+
+// ------------------ Attributes ------------------
+
+// validateAttributes checks the request attributes against the category schema and
+// writes the error response itself when they do not match
+func (h *ProductHandler) validateAttributes(c *gin.Context, request ProductRequest) (map[string]any, bool) {
+	if request.CategoryId == "" {
+		if len(request.Attributes) > 0 {
+			c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Attributes require a category"})
+			return nil, false
+		}
+		return map[string]any{}, true
+	}
+
+	category, err := h.categoryRepo.FindByID(c, request.CategoryId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving category"})
+		return nil, false
+	}
+	if category == nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: fmt.Sprintf("Not found category %v", request.CategoryId)})
+		return nil, false
+	}
+
+	attributes, err := category.ValidateAttributes(request.Attributes)
+	if err != nil {
+		var attributeErrors domain.AttributeErrors
+		if errors.As(err, &attributeErrors) {
+			c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: err.Error(), Data: attributeErrors})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: err.Error()})
+		return nil, false
+	}
+
+	return attributes, true
+}
+
+func parseAttributeFilters(c *gin.Context) ([]repository.AttributeFilter, error) {
+	byKey := make(map[string]*repository.AttributeFilter)
+	filter := func(key string) (*repository.AttributeFilter, error) {
+		if !domain.IsValidAttributeKey(key) {
+			return nil, fmt.Errorf("invalid attribute key %q", key)
+		}
+		if byKey[key] == nil {
+			byKey[key] = &repository.AttributeFilter{Key: key}
+		}
+		return byKey[key], nil
+	}
+
+	for key, value := range c.QueryMap("attr") {
+		f, err := filter(key)
+		if err != nil {
+			return nil, err
+		}
+		f.Equals = &value
+	}
+
+	for _, bound := range []string{"attrMin", "attrMax"} {
+		for key, value := range c.QueryMap(bound) {
+			f, err := filter(key)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%s] must be a number", bound, key)
+			}
+			if bound == "attrMin" {
+				f.Min = &n
+			} else {
+				f.Max = &n
+			}
+		}
+	}
+
+	filters := make([]repository.AttributeFilter, 0, len(byKey))
+	for _, f := range byKey {
+		filters = append(filters, *f)
+	}
+	return filters, nil
+}
+
+// optionalKey removes an empty id instead of storing it, since the product price
+// indexes are keyed on it and DynamoDB rejects empty index keys
+func optionalKey(id string) any {
+	if id == "" {
+		return nil
+	}
+	return id
+}
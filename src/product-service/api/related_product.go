@@ -0,0 +1,192 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+const defaultRelatedLimit = 8
+
+type RelatedLinkRequest struct {
+	ProductId string `json:"productId" binding:"required"`
+	Type      string `json:"type" binding:"required"`
+}
+
+type RelatedProductsRequest struct {
+	Links []RelatedLinkRequest `json:"links"`
+}
+
+type RelatedProductsResponse struct {
+	Related                  []domain.Product `json:"related"`
+	FrequentlyBoughtTogether []domain.Product `json:"frequentlyBoughtTogether"`
+}
+
+type RelatedProductHandler struct {
+	repo        repository.RelatedProductRepository
+	productRepo repository.ProductRepository
+}
+
+func NewRelatedProductHandler(repo repository.RelatedProductRepository,
+	productRepo repository.ProductRepository) *RelatedProductHandler {
+	return &RelatedProductHandler{
+		repo:        repo,
+		productRepo: productRepo,
+	}
+}
+
+func RegisterRelatedProductRoutes(rg *gin.RouterGroup,
+	repo repository.RelatedProductRepository,
+	productRepo repository.ProductRepository) {
+
+	handler := NewRelatedProductHandler(repo, productRepo)
+
+	rg.GET("/:id/related", middleware.UUIDParamMiddleware("id"), handler.GetRelated)
+
+	staff := rg.Group("", middleware.Permitted(auth.PermissionProductWrite)...)
+	staff.PUT("/:id/related", middleware.UUIDParamMiddleware("id"), handler.SetCurated)
+}
+
+// GetRelated fills the cross-sell slots with curated links first and tops up the
+// related slot with the links computed by the similarity job.
+func (h *RelatedProductHandler) GetRelated(c *gin.Context) {
+	id := c.Param("id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRelatedLimit)))
+	if err != nil || limit <= 0 || limit > domain.MaxRelatedProductsPerSet {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid limit"})
+		return
+	}
+
+	related, err := h.repo.FindByID(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	response := RelatedProductsResponse{
+		Related:                  []domain.Product{},
+		FrequentlyBoughtTogether: []domain.Product{},
+	}
+	if related == nil {
+		c.JSON(http.StatusOK, BaseResponse{Success: true, Data: response})
+		return
+	}
+
+	relatedIds := pickLinks(id, limit, domain.RelationRelated, related.Curated, related.Computed)
+	togetherIds := pickLinks(id, limit, domain.RelationBoughtTogether, related.Curated)
+
+	products, err := h.productRepo.FindByIDs(c, append(append([]string{}, relatedIds...), togetherIds...))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	byId := make(map[string]domain.Product, len(products))
+	for _, product := range products {
+		byId[product.ID] = product
+	}
+
+	// Keep the ranking order, dropping links to products that no longer exist
+	for _, productId := range relatedIds {
+		if product, ok := byId[productId]; ok {
+			response.Related = append(response.Related, product)
+		}
+	}
+	for _, productId := range togetherIds {
+		if product, ok := byId[productId]; ok {
+			response.FrequentlyBoughtTogether = append(response.FrequentlyBoughtTogether, product)
+		}
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: response})
+}
+
+// SetCurated replaces the manually curated links of a product
+func (h *RelatedProductHandler) SetCurated(c *gin.Context) {
+	id := c.Param("id")
+
+	var request RelatedProductsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid request body"})
+		return
+	}
+
+	if len(request.Links) > 2*domain.MaxRelatedProductsPerSet {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Too many related products"})
+		return
+	}
+
+	links := make([]domain.RelatedLink, 0, len(request.Links))
+	ids := make([]string, 0, len(request.Links))
+	for _, link := range request.Links {
+		if _, err := uuid.Parse(link.ProductId); err != nil || link.ProductId == id || !domain.IsValidRelation(link.Type) {
+			c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid related product link"})
+			return
+		}
+		links = append(links, domain.RelatedLink{ProductID: link.ProductId, Type: link.Type})
+		ids = append(ids, link.ProductId)
+	}
+
+	exists, err := h.productRepo.Exists(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Product not found"})
+		return
+	}
+
+	products, err := h.productRepo.FindByIDs(c, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+	found := make(map[string]bool, len(products))
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	for _, productId := range ids {
+		if !found[productId] {
+			c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Not found product " + productId})
+			return
+		}
+	}
+
+	updated, err := h.repo.SetCurated(c, id, links)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Message: "Related products updated successfully", Data: updated})
+}
+
+// pickLinks returns up to limit distinct product ids of the given relation, taking
+// the link sets in priority order
+func pickLinks(self string, limit int, relation string, sets ...[]domain.RelatedLink) []string {
+	seen := map[string]bool{self: true}
+	ids := make([]string, 0, limit)
+
+	for _, set := range sets {
+		for _, link := range set {
+			if len(ids) == limit {
+				return ids
+			}
+			if link.Type != relation || seen[link.ProductID] {
+				continue
+			}
+			seen[link.ProductID] = true
+			ids = append(ids, link.ProductID)
+		}
+	}
+
+	return ids
+}
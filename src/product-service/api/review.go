@@ -0,0 +1,243 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+)
+
+// reviewNamespace scopes review ids derived from product and user ids
+var reviewNamespace = uuid.MustParse("0b9f4c1e-6a7d-4c52-9a59-3f1d2e8b7c40")
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"required,max=200"`
+	Body   string `json:"body" binding:"required,max=5000"`
+}
+
+type ReviewStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+type ReviewVoteRequest struct {
+	Helpful bool `json:"helpful"`
+}
+
+type ReviewHandler struct {
+	repo        repository.ReviewRepository
+	productRepo repository.ProductRepository
+	verifier    service.PurchaseVerifier
+}
+
+func NewReviewHandler(repo repository.ReviewRepository,
+	productRepo repository.ProductRepository,
+	verifier service.PurchaseVerifier) *ReviewHandler {
+	return &ReviewHandler{
+		repo:        repo,
+		productRepo: productRepo,
+		verifier:    verifier,
+	}
+}
+
+func RegisterReviewRoutes(rg *gin.RouterGroup,
+	repo repository.ReviewRepository,
+	productRepo repository.ProductRepository,
+	verifier service.PurchaseVerifier) {
+
+	handler := NewReviewHandler(repo, productRepo, verifier)
+
+	rg.GET("/:id/reviews", middleware.UUIDParamMiddleware("id"),
+		authmw.RequirePermissionWhen(listsUnpublishedReviews, auth.PermissionReviewModerate), handler.GetReviews)
+
+	users := rg.Group("", authmw.AuthMiddleware(), authmw.RequireScope("reviews:write"), authmw.RequirePermission(auth.PermissionReviewWrite))
+	users.POST("/:id/reviews", middleware.UUIDParamMiddleware("id"), handler.AddReview)
+	users.POST("/:id/reviews/:reviewId/votes", middleware.UUIDParamMiddleware("id"), middleware.UUIDParamMiddleware("reviewId"), handler.VoteReview)
+
+	staff := rg.Group("", middleware.Permitted(auth.PermissionReviewModerate)...)
+	staff.PUT("/:id/reviews/:reviewId/status", middleware.UUIDParamMiddleware("id"), middleware.UUIDParamMiddleware("reviewId"), handler.ModerateReview)
+}
+
+// listsUnpublishedReviews reports whether a review listing asks for a status other
+// than APPROVED, which only moderators may see
+func listsUnpublishedReviews(c *gin.Context) bool {
+	return c.DefaultQuery("status", domain.ReviewStatusApproved) != domain.ReviewStatusApproved
+}
+
+// GetReviews lists approved reviews, ?status= lets moderators see other statuses
+func (h *ReviewHandler) GetReviews(c *gin.Context) {
+	productId := c.Param("id")
+
+	status := c.DefaultQuery("status", domain.ReviewStatusApproved)
+	if !domain.IsValidReviewStatus(status) {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid review status"})
+		return
+	}
+
+	reviews, err := h.repo.FindByProduct(c, productId, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: reviews})
+}
+
+// AddReview creates the caller's review. Reviews from verified purchasers are
+// published immediately, everything else waits for moderation.
+func (h *ReviewHandler) AddReview(c *gin.Context) {
+	productId := c.Param("id")
+
+	userId, ok := authmw.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, BaseResponse{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	var request ReviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid request body"})
+		return
+	}
+
+	product, err := h.productRepo.FindByID(c, productId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving product"})
+		return
+	}
+	if product == nil {
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Product not found"})
+		return
+	}
+
+	verified, err := h.verifier.HasPurchased(c, userId, productId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Failed to verify purchase"})
+		return
+	}
+
+	status := domain.ReviewStatusPending
+	if verified {
+		status = domain.ReviewStatusApproved
+	}
+
+	review := domain.Review{
+		ID:               uuid.NewSHA1(reviewNamespace, []byte(productId+":"+userId)).String(),
+		ProductID:        productId,
+		UserID:           userId,
+		Rating:           request.Rating,
+		Title:            request.Title,
+		Body:             request.Body,
+		Status:           status,
+		VerifiedPurchase: verified,
+	}
+
+	if err := h.repo.Create(c, &review); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	// Approved reviews change the product rating outside the product repository
+	if review.Status == domain.ReviewStatusApproved {
+		h.productRepo.Invalidate(c, productId)
+	}
+
+	c.JSON(http.StatusCreated, BaseResponse{Success: true, Message: "Review created successfully", Data: review})
+}
+
+func (h *ReviewHandler) ModerateReview(c *gin.Context) {
+	var request ReviewStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil || !domain.IsValidReviewStatus(request.Status) {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid request body"})
+		return
+	}
+
+	review, ok := h.findReview(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.repo.ChangeStatus(c, review, request.Status)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.productRepo.Invalidate(c, review.ProductID)
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Message: "Review status updated successfully", Data: updated})
+}
+
+func (h *ReviewHandler) VoteReview(c *gin.Context) {
+	userId, ok := authmw.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, BaseResponse{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	var request ReviewVoteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Invalid request body"})
+		return
+	}
+
+	review, ok := h.findReview(c)
+	if !ok {
+		return
+	}
+
+	// Reviews waiting for moderation or rejected are not public, so they are not found
+	if review.Status != domain.ReviewStatusApproved {
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Review not found"})
+		return
+	}
+
+	if review.UserID == userId {
+		c.JSON(http.StatusBadRequest, BaseResponse{Success: false, Message: "Cannot vote on your own review"})
+		return
+	}
+
+	updated, err := h.repo.Vote(c, review.ID, userId, request.Helpful)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, BaseResponse{Success: true, Data: updated})
+}
+
+// findReview loads the review from the path and checks it belongs to the product
+func (h *ReviewHandler) findReview(c *gin.Context) (*domain.Review, bool) {
+	review, err := h.repo.FindByIDConsistent(c, c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: "Error retrieving review"})
+		return nil, false
+	}
+
+	if review == nil || review.ProductID != c.Param("id") {
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Review not found"})
+		return nil, false
+	}
+
+	return review, true
+}
+
+func (h *ReviewHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrReviewExists), errors.Is(err, repository.ErrAlreadyVoted),
+		errors.Is(err, repository.ErrStatusTransition), errors.Is(err, repository.ErrConcurrentUpdate):
+		c.JSON(http.StatusConflict, BaseResponse{Success: false, Message: err.Error()})
+	case errors.Is(err, repository.ErrReviewedProductGone):
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Product not found"})
+	case errors.Is(err, repository.ErrReviewNotPublished):
+		c.JSON(http.StatusNotFound, BaseResponse{Success: false, Message: "Review not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, BaseResponse{Success: false, Message: err.Error()})
+	}
+}
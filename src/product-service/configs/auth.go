@@ -0,0 +1,42 @@
+package configs
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+// SetupAuth makes the auth middleware verify tokens against the user-service key
+// set and reject tokens revoked there. The revocation store defaults to redis when
+// REDIS_ADDR is set; only development may run without one. API keys are verified
+// by user-service too.
+func SetupAuth(cfg *Config) error {
+	auth.SetVerifier(auth.NewJWKSVerifier(cfg.Auth.JWKSURL, cfg.Auth.JWKSCacheTTL))
+	auth.SetAPIKeyVerifier(auth.NewRemoteAPIKeyVerifier(cfg.Auth.APIKeyVerifyURL, cfg.Auth.APIKeyCacheTTL))
+
+	store := cfg.Auth.RevocationStore
+	if store == "" && cfg.Cache.RedisAddr != "" {
+		store = "redis"
+	}
+
+	switch store {
+	case "":
+		if cfg.App.AppEnv == "production" {
+			return fmt.Errorf("REVOCATION_STORE is required in production")
+		}
+		log.Print("REVOCATION_STORE not set, revoked access tokens are accepted until they expire")
+		return nil
+	case "redis":
+		if cfg.Cache.RedisAddr == "" {
+			return fmt.Errorf("REDIS_ADDR is required for the redis revocation store")
+		}
+		// This service only reads revocations, so the watermark TTL is never used
+		client := redis.NewClient(&redis.Options{Addr: cfg.Cache.RedisAddr})
+		auth.SetRevocationStore(auth.NewRedisRevocationStore(client, 0))
+		return nil
+	default:
+		return fmt.Errorf("unknown revocation store %q", store)
+	}
+}
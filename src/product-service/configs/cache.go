@@ -0,0 +1,67 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/cache"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/stream"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewCacheBackend creates the backend named in the cache config, defaulting to an
+// in-process LRU. A nil backend means caching is disabled. An in-process cache only
+// learns about writes of other instances from the table streams, so production
+// needs them enabled or the shared redis cache.
+func NewCacheBackend(cfg *Config) (cache.Backend, error) {
+	switch cfg.Cache.Backend {
+	case "", "memory":
+		if !cfg.Streams.Enabled {
+			if cfg.App.AppEnv == "production" {
+				return nil, fmt.Errorf("the in-process cache needs STREAMS_ENABLED=true in production, or use CACHE_BACKEND=redis")
+			}
+			log.Print("STREAMS_ENABLED not set, writes of other instances stay cached here until the entries expire")
+		}
+		return cache.NewLRU(cfg.Cache.Capacity), nil
+	case "redis":
+		if cfg.Cache.RedisAddr == "" {
+			return nil, fmt.Errorf("REDIS_ADDR is required for the redis cache")
+		}
+		return cache.NewRedis(redis.NewClient(&redis.Options{Addr: cfg.Cache.RedisAddr})), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+}
+
+// cacheIsShared reports whether every instance reads the same cache entries
+func cacheIsShared(cfg *Config) bool {
+	return cfg.Cache.Backend == "redis"
+}
+
+// registerCacheInvalidation drops the cached entries of changed items. Changes
+// created before since are skipped, the cache did not exist yet.
+func registerCacheInvalidation(consumers *StreamConsumers, since time.Time,
+	products, brands, categories repository.Invalidator) {
+	consumers.Products.Handle("cache", invalidateOnChange[domain.Product](products, since))
+	if brands != nil {
+		consumers.Brands.Handle("cache", invalidateOnChange[domain.Brand](brands, since))
+	}
+	if categories != nil {
+		consumers.Categories.Handle("cache", invalidateOnChange[domain.Category](categories, since))
+	}
+}
+
+func invalidateOnChange[T any](invalidator repository.Invalidator, since time.Time) stream.Handler[T] {
+	return func(ctx context.Context, change stream.Change[T]) error {
+		if change.CreatedAt.Before(since) {
+			return nil
+		}
+		return invalidator.Invalidate(ctx, change.Keys["id"])
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -12,8 +14,9 @@ import (
 )
 
 type AppConfig struct {
-	AppEnv  string
-	AppPort string
+	AppEnv                  string
+	AppPort                 string
+	RelatedProductsInterval time.Duration
 }
 
 type AWSConfig struct {
@@ -22,9 +25,45 @@ type AWSConfig struct {
 	Region          string
 }
 
+// EventsConfig selects the bus catalog events are relayed to
+type EventsConfig struct {
+	Bus           string // memory, file, sns or sqs
+	Target        string // file path, topic ARN or queue URL
+	RelayInterval time.Duration
+}
+
+// StreamsConfig controls the DynamoDB Streams consumers of the catalog tables
+type StreamsConfig struct {
+	Enabled      bool
+	ConsumerName string
+}
+
+// CacheConfig selects the read-through cache of catalog reads
+type CacheConfig struct {
+	Backend     string // memory, redis or none
+	RedisAddr   string
+	Capacity    int
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+}
+
+// AuthConfig points at the key set and revocations of the service issuing access
+// tokens, and at its endpoint verifying API keys
+type AuthConfig struct {
+	JWKSURL         string
+	JWKSCacheTTL    time.Duration
+	RevocationStore string // redis; defaults to redis when REDIS_ADDR is set
+	APIKeyVerifyURL string
+	APIKeyCacheTTL  time.Duration // how long a revoked key keeps working
+}
+
 type Config struct {
-	App AppConfig
-	AWS aws.Config
+	App     AppConfig
+	AWS     aws.Config
+	Events  EventsConfig
+	Streams StreamsConfig
+	Cache   CacheConfig
+	Auth    AuthConfig
 }
 
 func LoadConfig() (*Config, error) {
@@ -36,8 +75,9 @@ func LoadConfig() (*Config, error) {
 	}
 
 	appConfig := AppConfig{
-		AppEnv:  os.Getenv("APP_ENV"),
-		AppPort: os.Getenv("APP_PORT"),
+		AppEnv:                  os.Getenv("APP_ENV"),
+		AppPort:                 os.Getenv("APP_PORT"),
+		RelatedProductsInterval: getEnvMinutes("RELATED_PRODUCTS_INTERVAL", 60),
 	}
 
 	// Load the default AWS configuration, which now includes values from .env.
@@ -46,12 +86,75 @@ func LoadConfig() (*Config, error) {
 		log.Fatalf("unable to load SDK config: %v", err)
 	}
 
+	eventsConfig := EventsConfig{
+		Bus:           os.Getenv("EVENT_BUS"),
+		Target:        os.Getenv("EVENT_BUS_TARGET"),
+		RelayInterval: getEnvSeconds("EVENT_RELAY_INTERVAL", 5),
+	}
+
+	streamsConfig := StreamsConfig{
+		Enabled:      os.Getenv("STREAMS_ENABLED") == "true",
+		ConsumerName: os.Getenv("STREAMS_CONSUMER_NAME"),
+	}
+	if streamsConfig.ConsumerName == "" {
+		streamsConfig.ConsumerName = "product-service"
+	}
+
+	capacity, err := strconv.Atoi(os.Getenv("CACHE_CAPACITY"))
+	if err != nil || capacity <= 0 {
+		capacity = 10000
+	}
+
+	cacheConfig := CacheConfig{
+		Backend:     os.Getenv("CACHE_BACKEND"),
+		RedisAddr:   os.Getenv("REDIS_ADDR"),
+		Capacity:    capacity,
+		TTL:         getEnvSeconds("CACHE_TTL", 300),
+		NotFoundTTL: getEnvSeconds("CACHE_NOT_FOUND_TTL", 30),
+	}
+
+	authConfig := AuthConfig{
+		JWKSURL:         os.Getenv("JWKS_URL"),
+		JWKSCacheTTL:    getEnvSeconds("JWKS_CACHE_TTL", 900),
+		RevocationStore: os.Getenv("REVOCATION_STORE"),
+		APIKeyVerifyURL: os.Getenv("API_KEY_VERIFY_URL"),
+		APIKeyCacheTTL:  getEnvSeconds("API_KEY_CACHE_TTL", 30),
+	}
+	if authConfig.JWKSURL == "" {
+		authConfig.JWKSURL = "http://localhost:8080/.well-known/jwks.json"
+	}
+	if authConfig.APIKeyVerifyURL == "" {
+		authConfig.APIKeyVerifyURL = "http://localhost:8080/api/v1/api-keys/verify"
+	}
+
 	return &Config{
-		App: appConfig,
-		AWS: cfg,
+		App:     appConfig,
+		AWS:     cfg,
+		Events:  eventsConfig,
+		Streams: streamsConfig,
+		Cache:   cacheConfig,
+		Auth:    authConfig,
 	}, nil
 }
 
+// getEnvMinutes reads a duration given in minutes, falling back on missing or bad values
+func getEnvMinutes(key string, fallback int) time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || minutes <= 0 {
+		minutes = fallback
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// getEnvSeconds reads a duration given in seconds, falling back on missing or bad values
+func getEnvSeconds(key string, fallback int) time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || seconds <= 0 {
+		seconds = fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func LoadDynamoDBConfig() {
 
 }
@@ -0,0 +1,39 @@
+package configs
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/events"
+)
+
+// NewEventBus creates the bus named in the events config, defaulting to memory
+func NewEventBus(cfg *Config) (events.Bus, error) {
+	switch cfg.Events.Bus {
+	case "", "memory":
+		bus := events.NewMemoryBus()
+		bus.Subscribe(events.LogSubscriber)
+		return bus, nil
+	case "file":
+		target := cfg.Events.Target
+		if target == "" {
+			target = "catalog-events.jsonl"
+		}
+		log.Printf("Catalog events are written to %s", target)
+		return events.NewFileBus(target), nil
+	case "sns":
+		if cfg.Events.Target == "" {
+			return nil, fmt.Errorf("EVENT_BUS_TARGET must be the SNS topic ARN")
+		}
+		return events.NewSNSBus(sns.NewFromConfig(cfg.AWS), cfg.Events.Target), nil
+	case "sqs":
+		if cfg.Events.Target == "" {
+			return nil, fmt.Errorf("EVENT_BUS_TARGET must be the SQS queue URL")
+		}
+		return events.NewSQSBus(sqs.NewFromConfig(cfg.AWS), cfg.Events.Target), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", cfg.Events.Bus)
+	}
+}
@@ -1,14 +1,23 @@
 package configs
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/gin-gonic/gin"
 	"github.com/quochao170402/ecommerce-aws/product-service/api"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/cache"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/events"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/job"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/stream"
+	"github.com/quochao170402/ecommerce-aws/product-service/middleware"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
 )
 
 func SetupRoutes(router *gin.Engine, cfg *Config) {
@@ -26,11 +35,89 @@ func SetupRoutes(router *gin.Engine, cfg *Config) {
 		})
 	})
 
+	// Access tokens are issued by user-service, only its public keys are needed here
+	if err := SetupAuth(cfg); err != nil {
+		log.Fatalf("Error when setting up authentication: %v", err)
+	}
+
 	client := dynamodb.NewFromConfig(cfg.AWS)
 
-	brandRepo := repository.NewBaseRepository[domain.Brand](client, "Brands")
-	categoryRepo := repository.NewBaseRepository[domain.Category](client, "Categories")
-	productRepo := repository.NewProductRepository(client)
+	brandRepo := repository.NewEventedRepository[domain.Brand](client, "Brands", domain.AggregateBrand)
+	categoryRepo := repository.NewEventedRepository[domain.Category](client, "Categories", domain.AggregateCategory)
+
+	cacheBackend, err := NewCacheBackend(cfg)
+	if err != nil {
+		log.Fatalf("Error when creating cache backend: %v", err)
+	}
+
+	cacheMetrics := &cache.Metrics{}
+	var productDecorators []func(repository.BaseRepository[domain.Product]) repository.BaseRepository[domain.Product]
+	if cacheBackend != nil {
+		brandRepo = repository.NewCachedRepository(brandRepo, cacheBackend, cacheMetrics, cacheOptions(cfg, "brands"))
+		categoryRepo = repository.NewCachedRepository(categoryRepo, cacheBackend, cacheMetrics, cacheOptions(cfg, "categories"))
+		productDecorators = append(productDecorators,
+			repository.WithCache[domain.Product](cacheBackend, cacheMetrics, cacheOptions(cfg, "products")))
+	}
+
+	metrics := router.Group("/metrics", middleware.Permitted(auth.PermissionMetricsRead)...)
+	metrics.GET("/cache", func(c *gin.Context) {
+		c.JSON(http.StatusOK, cacheMetrics.Snapshot())
+	})
+
+	productRepo := repository.NewProductRepository(client, productDecorators...)
+	reviewRepo := repository.NewReviewRepository(client)
+	relatedRepo := repository.NewRelatedProductRepository(client)
+
+	leaseRepo := repository.NewLeaseRepository(client)
+
+	go job.NewRelatedProductsJob(productRepo, relatedRepo, leaseRepo, instanceName(),
+		cfg.App.RelatedProductsInterval).Start(context.Background())
+
+	bus, err := NewEventBus(cfg)
+	if err != nil {
+		log.Fatalf("Error when creating event bus: %v", err)
+	}
+	outboxRepo := repository.NewOutboxRepository(client)
+	relay := events.NewRelay(outboxRepo, bus, leaseRepo, instanceName(), cfg.Events.RelayInterval)
+	go relay.Start(context.Background())
+	metrics.GET("/outbox", func(c *gin.Context) {
+		c.JSON(http.StatusOK, relay.Stats())
+	})
+
+	if cfg.Streams.Enabled {
+		consumers, err := NewStreamConsumers(context.Background(), cfg, client, leaseRepo)
+		if err != nil {
+			log.Fatalf("Error when creating stream consumers: %v", err)
+		}
+		consumers.Products.Handle("log", func(ctx context.Context, change stream.Change[domain.Product]) error {
+			log.Printf("Product %s %s", change.Keys["id"], change.EventName)
+			return nil
+		})
+
+		// A shared cache is invalidated by the instance holding the lease of the shard a
+		// change is in, see NewStreamConsumers; a takeover may invalidate again, which
+		// is harmless. An in-process cache has to be invalidated by every instance, so
+		// each reads the streams on its own too, from the oldest record on, skipping
+		// changes older than the cache. Stream timestamps are approximate, hence the margin.
+		cacheConsumers := consumers
+		var since time.Time
+		if cacheBackend != nil && !cacheIsShared(cfg) {
+			cacheConsumers, err = NewInstanceStreamConsumers(context.Background(), cfg, client)
+			if err != nil {
+				log.Fatalf("Error when creating cache stream consumers: %v", err)
+			}
+			since = time.Now().Add(-time.Minute)
+		}
+
+		brandInvalidator, _ := brandRepo.(repository.Invalidator)
+		categoryInvalidator, _ := categoryRepo.(repository.Invalidator)
+		registerCacheInvalidation(cacheConsumers, since, productRepo, brandInvalidator, categoryInvalidator)
+
+		if cacheConsumers != consumers {
+			cacheConsumers.Start(context.Background())
+		}
+		consumers.Start(context.Background())
+	}
 
 	v1 := router.Group("/api/v1")
 	{
@@ -46,7 +133,20 @@ func SetupRoutes(router *gin.Engine, cfg *Config) {
 
 		products := v1.Group("/products")
 		{
-			api.RegisterProductRoutes(products, productRepo)
+			api.RegisterProductRoutes(products, productRepo, categoryRepo)
+			api.RegisterReviewRoutes(products, reviewRepo, productRepo, service.NoopPurchaseVerifier{})
+			api.RegisterRelatedProductRoutes(products, relatedRepo, productRepo)
+		}
+
+		outbox := v1.Group("/outbox")
+		{
+			api.RegisterOutboxRoutes(outbox, outboxRepo)
+		}
+
+		// Personal data hooks called by user-service
+		privacy := v1.Group("/privacy")
+		{
+			api.RegisterPrivacyRoutes(privacy.Group("/users"), reviewRepo)
 		}
 	}
 
@@ -81,11 +181,20 @@ func SetupRoutes(router *gin.Engine, cfg *Config) {
 	log.Fatal(router.Run(":" + port))
 }
 
+func cacheOptions(cfg *Config, prefix string) repository.CacheOptions {
+	return repository.CacheOptions{
+		Prefix:      "product-service:" + prefix,
+		TTL:         cfg.Cache.TTL,
+		NotFoundTTL: cfg.Cache.NotFoundTTL,
+	}
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match, If-Modified-Since")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,102 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/stream"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+// StreamConsumers holds one consumer per catalog table so callers can register
+// handlers before the consumers are started
+type StreamConsumers struct {
+	Products   *stream.Consumer[domain.Product]
+	Brands     *stream.Consumer[domain.Brand]
+	Categories *stream.Consumer[domain.Category]
+}
+
+// NewStreamConsumers enables the table streams and creates the catalog consumers.
+// Every instance shares their checkpoints and leases each shard it reads, so each
+// change is handled by one instance at a time; one taking over a shard handles the
+// changes after its last checkpoint again.
+// Point AWS_ENDPOINT_URL_DYNAMODB and AWS_ENDPOINT_URL_DYNAMODB_STREAMS at DynamoDB
+// Local to run them without AWS.
+func NewStreamConsumers(ctx context.Context, cfg *Config, client *dynamodb.Client,
+	leases repository.LeaseRepository) (*StreamConsumers, error) {
+	checkpoints := stream.NewCheckpointStore(repository.NewBaseRepository[domain.StreamCheckpoint](client, "StreamCheckpoints"))
+	consumers, err := newStreamConsumers(ctx, cfg, client, cfg.Streams.ConsumerName, checkpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := instanceName()
+	consumers.Products.WithShardLeases(leases, owner)
+	consumers.Brands.WithShardLeases(leases, owner)
+	consumers.Categories.WithShardLeases(leases, owner)
+	return consumers, nil
+}
+
+// NewInstanceStreamConsumers creates catalog consumers of this instance alone, so
+// every instance sees every change. Their checkpoints are kept in memory: they
+// are meant for state of the process, such as an in-process cache, which starts
+// over empty anyway.
+func NewInstanceStreamConsumers(ctx context.Context, cfg *Config, client *dynamodb.Client) (*StreamConsumers, error) {
+	name := cfg.Streams.ConsumerName + "-" + instanceName()
+	return newStreamConsumers(ctx, cfg, client, name, stream.NewLocalCheckpointStore())
+}
+
+// instanceName identifies this process among the instances of the service
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func newStreamConsumers(ctx context.Context, cfg *Config, client *dynamodb.Client,
+	name string, checkpoints stream.CheckpointStore) (*StreamConsumers, error) {
+	streamsClient := dynamodbstreams.NewFromConfig(cfg.AWS)
+	deadLetters := stream.NewDeadLetterSink(repository.NewBaseRepository[domain.StreamDeadLetter](client, "StreamDeadLetters"))
+
+	consumers := &StreamConsumers{}
+	var err error
+
+	consumers.Products, err = stream.NewTableConsumer(ctx, name+"-products",
+		service.NewDynamoService[domain.Product](client, repository.ProductTableName), streamsClient, checkpoints, deadLetters)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers.Brands, err = stream.NewTableConsumer(ctx, name+"-brands",
+		service.NewDynamoService[domain.Brand](client, "Brands"), streamsClient, checkpoints, deadLetters)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers.Categories, err = stream.NewTableConsumer(ctx, name+"-categories",
+		service.NewDynamoService[domain.Category](client, "Categories"), streamsClient, checkpoints, deadLetters)
+	if err != nil {
+		return nil, err
+	}
+
+	return consumers, nil
+}
+
+// Start runs every consumer in the background until ctx is cancelled
+func (s *StreamConsumers) Start(ctx context.Context) {
+	for _, runner := range []stream.Runner{s.Products, s.Brands, s.Categories} {
+		go func() {
+			if err := runner.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Stream consumer stopped: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Backend stores serialized entries with an expiry. SetIfAbsent stores only when
+// the key holds nothing, and reports whether it did.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Stats counts cache lookups; Errors are backend failures that fell through to the store
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	NegativeHits  uint64 `json:"negativeHits"`
+	Misses        uint64 `json:"misses"`
+	Errors        uint64 `json:"errors"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// Metrics are the live counters behind Stats
+type Metrics struct {
+	hits          atomic.Uint64
+	negativeHits  atomic.Uint64
+	misses        atomic.Uint64
+	errors        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+func (m *Metrics) Hit()         { m.hits.Add(1) }
+func (m *Metrics) NegativeHit() { m.negativeHits.Add(1) }
+func (m *Metrics) Miss()        { m.misses.Add(1) }
+func (m *Metrics) Error()       { m.errors.Add(1) }
+func (m *Metrics) Invalidated() { m.invalidations.Add(1) }
+
+func (m *Metrics) Snapshot() Stats {
+	return Stats{
+		Hits:          m.hits.Load(),
+		NegativeHits:  m.negativeHits.Load(),
+		Misses:        m.misses.Load(),
+		Errors:        m.errors.Load(),
+		Invalidations: m.invalidations.Load(),
+	}
+}
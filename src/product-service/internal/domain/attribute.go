@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Attribute value types supported in category schemas
+const (
+	AttributeTypeString  = "STRING"
+	AttributeTypeNumber  = "NUMBER"
+	AttributeTypeBoolean = "BOOLEAN"
+	AttributeTypeEnum    = "ENUM"
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// AttributeDefinition describes one specification field of the products in a category
+type AttributeDefinition struct {
+	Key           string   `dynamodbav:"key" json:"key"`
+	Name          string   `dynamodbav:"name" json:"name"`
+	Type          string   `dynamodbav:"type" json:"type"`
+	Unit          string   `dynamodbav:"unit,omitempty" json:"unit,omitempty"`
+	Required      bool     `dynamodbav:"required" json:"required"`
+	AllowedValues []string `dynamodbav:"allowedValues,omitempty" json:"allowedValues,omitempty"`
+}
+
+// AttributeErrors collects the validation problems keyed by attribute
+type AttributeErrors map[string]string
+
+func (e AttributeErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for key, msg := range e {
+		parts = append(parts, key+": "+msg)
+	}
+	slices.Sort(parts)
+	return "invalid attributes: " + strings.Join(parts, "; ")
+}
+
+// IsValidAttributeKey reports whether key can be used as an attribute key
+func IsValidAttributeKey(key string) bool {
+	return attributeKeyPattern.MatchString(key)
+}
+
+// ValidateAttributeSchema checks a category schema is well formed
+func ValidateAttributeSchema(definitions []AttributeDefinition) error {
+	errs := AttributeErrors{}
+	seen := make(map[string]bool, len(definitions))
+
+	for _, def := range definitions {
+		switch {
+		case !IsValidAttributeKey(def.Key):
+			errs[def.Key] = "key must start with a letter and contain only letters, digits and underscores"
+		case seen[def.Key]:
+			errs[def.Key] = "duplicate key"
+		case def.Type == AttributeTypeEnum && len(def.AllowedValues) == 0:
+			errs[def.Key] = "enum attributes need allowed values"
+		case def.Type != AttributeTypeString && def.Type != AttributeTypeNumber &&
+			def.Type != AttributeTypeBoolean && def.Type != AttributeTypeEnum:
+			errs[def.Key] = fmt.Sprintf("unknown type %q", def.Type)
+		}
+		seen[def.Key] = true
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateAttributes checks product attribute values against the category schema and
+// returns them normalized to their declared types. Keys missing from the schema are rejected.
+func (c Category) ValidateAttributes(values map[string]any) (map[string]any, error) {
+	errs := AttributeErrors{}
+	normalized := make(map[string]any, len(values))
+
+	definitions := make(map[string]AttributeDefinition, len(c.Attributes))
+	for _, def := range c.Attributes {
+		definitions[def.Key] = def
+	}
+
+	for key, value := range values {
+		def, ok := definitions[key]
+		if !ok {
+			errs[key] = "not defined for category " + c.Name
+			continue
+		}
+
+		typed, err := def.normalize(value)
+		if err != nil {
+			errs[key] = err.Error()
+			continue
+		}
+		normalized[key] = typed
+	}
+
+	for _, def := range c.Attributes {
+		if _, ok := values[def.Key]; def.Required && !ok {
+			errs[def.Key] = "required"
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
+
+func (d AttributeDefinition) normalize(value any) (any, error) {
+	switch d.Type {
+	case AttributeTypeNumber:
+		// Request bodies decode every JSON number as float64
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a number")
+
+	case AttributeTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a boolean")
+
+	case AttributeTypeEnum:
+		v, ok := value.(string)
+		if !ok || !slices.Contains(d.AllowedValues, v) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(d.AllowedValues, ", "))
+		}
+		return v, nil
+
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		if len(d.AllowedValues) > 0 && !slices.Contains(d.AllowedValues, v) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(d.AllowedValues, ", "))
+		}
+		return v, nil
+	}
+}
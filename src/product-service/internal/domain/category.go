@@ -9,6 +9,9 @@ type Category struct {
 	CreatedAt int64  `dynamodbav:"createdAt" json:"createdAt"`
 	UpdatedAt int64  `dynamodbav:"updatedAt" json:"updatedAt"`
 	Version   int    `dynamodbav:"version" json:"version"`
+
+	// Specification schema the products of this category are validated against
+	Attributes []AttributeDefinition `dynamodbav:"attributes" json:"attributes"`
 }
 
 // Implement DynamoEntity interface for Category
@@ -0,0 +1,21 @@
+package domain
+
+import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+// JobLease lets one service instance at a time run a periodic job
+type JobLease struct {
+	ID        string `dynamodbav:"id" json:"id"` // job name
+	Owner     string `dynamodbav:"owner" json:"owner"`
+	ExpiresAt int64  `dynamodbav:"expiresAt" json:"expiresAt"`
+}
+
+// Implement DynamoEntity interface for JobLease
+func (l JobLease) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: l.ID},
+	}
+}
+
+func (l JobLease) GetTableName() string {
+	return "job_leases"
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Outbox event statuses
+const (
+	OutboxStatusPending   = "PENDING"
+	OutboxStatusPublished = "PUBLISHED"
+	OutboxStatusFailed    = "FAILED"
+	OutboxStatusDismissed = "DISMISSED"
+)
+
+// Catalog aggregates that publish change events
+const (
+	AggregateProduct  = "Product"
+	AggregateBrand    = "Brand"
+	AggregateCategory = "Category"
+)
+
+// Change actions carried by catalog events
+const (
+	ActionCreated = "Created"
+	ActionUpdated = "Updated"
+	ActionDeleted = "Deleted"
+)
+
+// Published and dismissed events are kept this long for troubleshooting before DynamoDB expires them
+const OutboxRetention = 7 * 24 * time.Hour
+
+// OutboxEvent is a catalog change waiting to be relayed to the event bus. The id
+// doubles as the idempotency key consumers use to drop redeliveries.
+type OutboxEvent struct {
+	ID            string `dynamodbav:"id" json:"id"`
+	Type          string `dynamodbav:"type" json:"type"`
+	AggregateType string `dynamodbav:"aggregateType" json:"aggregateType"`
+	AggregateID   string `dynamodbav:"aggregateId" json:"aggregateId"`
+	Action        string `dynamodbav:"action" json:"action"`
+	Payload       string `dynamodbav:"payload" json:"payload"`
+	Status        string `dynamodbav:"status" json:"status"`
+	Attempts      int    `dynamodbav:"attempts" json:"attempts"`
+	LastError     string `dynamodbav:"lastError,omitempty" json:"lastError,omitempty"`
+	OccurredAt    int64  `dynamodbav:"occurredAt" json:"occurredAt"` // milliseconds, keeps events of one second ordered
+	PublishedAt   int64  `dynamodbav:"publishedAt,omitempty" json:"publishedAt,omitempty"`
+	ExpiresAt     int64  `dynamodbav:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
+
+// Implement DynamoEntity interface for OutboxEvent
+func (e OutboxEvent) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: e.ID},
+	}
+}
+
+func (e OutboxEvent) GetTableName() string {
+	return "outbox"
+}
+
+// CatalogEventType names the event published for a change of aggregate. Products
+// get one event type per action, brands and categories a single *Changed type.
+func CatalogEventType(aggregate string, action string) string {
+	if aggregate == AggregateProduct {
+		return aggregate + action
+	}
+	return aggregate + "Changed"
+}
+
+// NewOutboxEvent captures entity as the payload of a pending catalog event
+func NewOutboxEvent(aggregate string, aggregateId string, action string, entity any) (OutboxEvent, error) {
+	payload, err := json.Marshal(entity)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	return OutboxEvent{
+		ID:            uuid.NewString(),
+		Type:          CatalogEventType(aggregate, action),
+		AggregateType: aggregate,
+		AggregateID:   aggregateId,
+		Action:        action,
+		Payload:       string(payload),
+		Status:        OutboxStatusPending,
+		OccurredAt:    time.Now().UnixMilli(),
+	}, nil
+}
@@ -1,6 +1,11 @@
 package domain
 
-import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+import (
+	"math"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
 
 type ImageUrl struct {
 	URL string `dynamodbav:"url" json:"url"`
@@ -16,9 +21,17 @@ type Product struct {
 	UpdatedAt   int64      `dynamodbav:"updatedAt" json:"updatedAt"`
 	Status      string     `dynamodbav:"status" json:"status"`
 	Version     int        `dynamodbav:"version" json:"version"`
-	BrandID     string     `dynamodbav:"brandId" json:"brandId"`
-	CategoryID  string     `dynamodbav:"categoryId" json:"categoryId"`
+	BrandID     string     `dynamodbav:"brandId,omitempty" json:"brandId"`
+	CategoryID  string     `dynamodbav:"categoryId,omitempty" json:"categoryId"`
 	Images      []ImageUrl `dynamodbav:"imageUrls" json:"imageUrls"`
+
+	// Typed specification values, validated against the category's attribute schema
+	Attributes map[string]any `dynamodbav:"attributes" json:"attributes"`
+
+	// Denormalized review statistics, only approved reviews are counted
+	AverageRating   float64        `dynamodbav:"averageRating" json:"averageRating"`
+	ReviewCount     int            `dynamodbav:"reviewCount" json:"reviewCount"`
+	RatingHistogram map[string]int `dynamodbav:"ratingHistogram" json:"ratingHistogram"`
 }
 
 // Implement DynamoEntity interface for Product
@@ -42,3 +55,29 @@ func (p Product) GetUpdatedAt() int64           { return p.UpdatedAt }
 func (p Product) GetVersion() int         { return p.Version }
 func (p *Product) SetVersion(version int) { p.Version = version }
 func (p *Product) IncrementVersion()      { p.Version++ }
+
+// ApplyRating adds (delta = 1) or removes (delta = -1) a rating from the review statistics
+func (p *Product) ApplyRating(rating int, delta int) {
+	if p.RatingHistogram == nil {
+		p.RatingHistogram = make(map[string]int, MaxRating)
+	}
+
+	key := strconv.Itoa(rating)
+	p.RatingHistogram[key] += delta
+	if p.RatingHistogram[key] < 0 {
+		p.RatingHistogram[key] = 0
+	}
+
+	total, count := 0, 0
+	for star := MinRating; star <= MaxRating; star++ {
+		n := p.RatingHistogram[strconv.Itoa(star)]
+		total += star * n
+		count += n
+	}
+
+	p.ReviewCount = count
+	p.AverageRating = 0
+	if count > 0 {
+		p.AverageRating = math.Round(float64(total)/float64(count)*100) / 100
+	}
+}
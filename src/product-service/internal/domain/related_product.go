@@ -0,0 +1,42 @@
+package domain
+
+import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+// Relation types between products
+const (
+	RelationRelated          = "RELATED"
+	RelationBoughtTogether   = "BOUGHT_TOGETHER"
+	MaxRelatedProductsPerSet = 20
+)
+
+type RelatedLink struct {
+	ProductID string  `dynamodbav:"productId" json:"productId"`
+	Type      string  `dynamodbav:"type" json:"type"`
+	Score     float64 `dynamodbav:"score" json:"score"`
+}
+
+// RelatedProducts holds the cross-sell links of one product, keyed by the product id.
+// Curated links are maintained by staff, computed links by the similarity job.
+type RelatedProducts struct {
+	ID         string        `dynamodbav:"id" json:"id"`
+	Curated    []RelatedLink `dynamodbav:"curated" json:"curated"`
+	Computed   []RelatedLink `dynamodbav:"computed" json:"computed"`
+	ComputedAt int64         `dynamodbav:"computedAt" json:"computedAt"`
+	UpdatedAt  int64         `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+// Implement DynamoEntity interface for RelatedProducts
+func (r RelatedProducts) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: r.ID},
+	}
+}
+
+func (r RelatedProducts) GetTableName() string {
+	return "related_products"
+}
+
+// IsValidRelation reports whether relation is a known relation type
+func IsValidRelation(relation string) bool {
+	return relation == RelationRelated || relation == RelationBoughtTogether
+}
@@ -0,0 +1,63 @@
+package domain
+
+import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+// Review moderation statuses
+const (
+	ReviewStatusPending  = "PENDING"
+	ReviewStatusApproved = "APPROVED"
+	ReviewStatusRejected = "REJECTED"
+)
+
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+type Review struct {
+	ID               string   `dynamodbav:"id" json:"id"`
+	ProductID        string   `dynamodbav:"productId" json:"productId"`
+	UserID           string   `dynamodbav:"userId,omitempty" json:"userId"` // empty once the author erased their account
+	Rating           int      `dynamodbav:"rating" json:"rating"`
+	Title            string   `dynamodbav:"title" json:"title"`
+	Body             string   `dynamodbav:"body" json:"body"`
+	Status           string   `dynamodbav:"status" json:"status"`
+	VerifiedPurchase bool     `dynamodbav:"verifiedPurchase" json:"verifiedPurchase"`
+	HelpfulCount     int      `dynamodbav:"helpfulCount" json:"helpfulCount"`
+	UnhelpfulCount   int      `dynamodbav:"unhelpfulCount" json:"unhelpfulCount"`
+	Voters           []string `dynamodbav:"voters,stringset,omitempty" json:"-"`
+	CreatedAt        int64    `dynamodbav:"createdAt" json:"createdAt"`
+	UpdatedAt        int64    `dynamodbav:"updatedAt" json:"updatedAt"`
+	Version          int      `dynamodbav:"version" json:"version"`
+}
+
+// Implement DynamoEntity interface for Review
+func (r Review) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: r.ID},
+	}
+}
+
+func (r Review) GetTableName() string {
+	return "reviews"
+}
+
+// Implement TimestampedEntity interface for Review
+func (r *Review) SetCreatedAt(timestamp int64) { r.CreatedAt = timestamp }
+func (r *Review) SetUpdatedAt(timestamp int64) { r.UpdatedAt = timestamp }
+func (r Review) GetCreatedAt() int64           { return r.CreatedAt }
+func (r Review) GetUpdatedAt() int64           { return r.UpdatedAt }
+
+// Implement VersionedEntity interface for Review
+func (r Review) GetVersion() int         { return r.Version }
+func (r *Review) SetVersion(version int) { r.Version = version }
+func (r *Review) IncrementVersion()      { r.Version++ }
+
+// IsValidReviewStatus reports whether status is a known moderation status
+func IsValidReviewStatus(status string) bool {
+	switch status {
+	case ReviewStatusPending, ReviewStatusApproved, ReviewStatusRejected:
+		return true
+	}
+	return false
+}
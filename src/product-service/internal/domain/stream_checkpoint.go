@@ -0,0 +1,51 @@
+package domain
+
+import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+// StreamCheckpoint remembers how far a consumer got in one shard of a table stream
+type StreamCheckpoint struct {
+	ID             string `dynamodbav:"id" json:"id"` // <consumer>#<shardId>
+	Consumer       string `dynamodbav:"consumer" json:"consumer"`
+	StreamArn      string `dynamodbav:"streamArn" json:"streamArn"`
+	ShardID        string `dynamodbav:"shardId" json:"shardId"`
+	SequenceNumber string `dynamodbav:"sequenceNumber" json:"sequenceNumber"`
+	Finished       bool   `dynamodbav:"finished" json:"finished"`
+	UpdatedAt      int64  `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+// Implement DynamoEntity interface for StreamCheckpoint
+func (c StreamCheckpoint) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: c.ID},
+	}
+}
+
+func (c StreamCheckpoint) GetTableName() string {
+	return "stream_checkpoints"
+}
+
+// StreamDeadLetter is a stream record no handler could process after all retries
+type StreamDeadLetter struct {
+	ID             string `dynamodbav:"id" json:"id"` // <consumer>#<handler>#<sequenceNumber>
+	Consumer       string `dynamodbav:"consumer" json:"consumer"`
+	Handler        string `dynamodbav:"handler" json:"handler"`
+	StreamArn      string `dynamodbav:"streamArn" json:"streamArn"`
+	ShardID        string `dynamodbav:"shardId" json:"shardId"`
+	SequenceNumber string `dynamodbav:"sequenceNumber" json:"sequenceNumber"`
+	EventName      string `dynamodbav:"eventName" json:"eventName"`
+	Keys           string `dynamodbav:"keys" json:"keys"`
+	Error          string `dynamodbav:"error" json:"error"`
+	Attempts       int    `dynamodbav:"attempts" json:"attempts"`
+	CreatedAt      int64  `dynamodbav:"createdAt" json:"createdAt"`
+}
+
+// Implement DynamoEntity interface for StreamDeadLetter
+func (d StreamDeadLetter) GetKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: d.ID},
+	}
+}
+
+func (d StreamDeadLetter) GetTableName() string {
+	return "stream_dead_letters"
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"context"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+)
+
+// Message is the envelope published for every catalog change. ID is stable across
+// redeliveries so consumers can use it as an idempotency key.
+type Message struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	AggregateType string `json:"aggregateType"`
+	AggregateID   string `json:"aggregateId"`
+	Action        string `json:"action"`
+	OccurredAt    int64  `json:"occurredAt"`
+	Payload       string `json:"payload"`
+}
+
+// Bus delivers messages to other services. Implementations only need at-least-once
+// semantics, the relay retries until Publish succeeds.
+type Bus interface {
+	Publish(ctx context.Context, message Message) error
+}
+
+// NewMessage builds the published envelope of an outbox event
+func NewMessage(event domain.OutboxEvent) Message {
+	return Message{
+		ID:            event.ID,
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Action:        event.Action,
+		OccurredAt:    event.OccurredAt,
+		Payload:       event.Payload,
+	}
+}
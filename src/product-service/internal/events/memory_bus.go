@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryBus delivers messages to in-process subscribers, for local development
+type MemoryBus struct {
+	mu          sync.RWMutex
+	subscribers []func(ctx context.Context, message Message) error
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Subscribe registers handler for every published message
+func (b *MemoryBus) Subscribe(handler func(ctx context.Context, message Message) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, handler)
+}
+
+// Publish calls the subscribers in order, a failing subscriber fails the publish
+// so the relay delivers the message again
+func (b *MemoryBus) Publish(ctx context.Context, message Message) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.subscribers {
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogSubscriber logs every message, handy as the default local subscriber
+func LogSubscriber(ctx context.Context, message Message) error {
+	log.Printf("Catalog event %s %s %s", message.ID, message.Type, message.AggregateID)
+	return nil
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+)
+
+const (
+	relayBatchSize   = 100
+	relayMaxAttempts = 10
+
+	// relayLease names the lease the instance running the relay holds. It lasts a
+	// few intervals, so the holder renews it well before it runs out.
+	relayLease          = "outbox-relay"
+	relayLeaseIntervals = 3
+)
+
+// RelayStats tells how the relay is doing. HeldAggregates have an event the relay
+// gave up on, their later events wait until it is republished or dismissed.
+type RelayStats struct {
+	HeldAggregates int `json:"heldAggregates"`
+}
+
+// Relay moves pending outbox events to the bus. An event is marked published only
+// after the bus accepted it, so a crash in between redelivers it (at-least-once).
+// Every instance starts it, the one holding the lease runs it, so events are
+// published in order and once.
+type Relay struct {
+	repo     repository.OutboxRepository
+	bus      Bus
+	leases   repository.LeaseRepository
+	owner    string
+	interval time.Duration
+
+	held     atomic.Int64
+	lastHeld string // the held aggregates last logged, so each change is logged once
+}
+
+func NewRelay(repo repository.OutboxRepository, bus Bus, leases repository.LeaseRepository,
+	owner string, interval time.Duration) *Relay {
+	return &Relay{
+		repo:     repo,
+		bus:      bus,
+		leases:   leases,
+		owner:    owner,
+		interval: interval,
+	}
+}
+
+// Start relays on every tick until ctx is cancelled, whenever this instance holds the lease
+func (r *Relay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.runLeased(ctx); err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runLeased relays one batch if this instance gets or renews the lease
+func (r *Relay) runLeased(ctx context.Context) error {
+	acquired, err := r.leases.Acquire(ctx, relayLease, r.owner, relayLeaseIntervals*r.interval)
+	if err != nil || !acquired {
+		return err
+	}
+	return r.RunOnce(ctx)
+}
+
+// Stats returns the state of the last run on this instance
+func (r *Relay) Stats() RelayStats {
+	return RelayStats{HeldAggregates: int(r.held.Load())}
+}
+
+// RunOnce publishes one batch of pending events in the order they occurred. Once an
+// event of an aggregate fails, later events of that aggregate wait for the next run
+// so consumers never see them out of order; once it is given up on, they wait until
+// it is republished or dismissed, see OutboxRepository.FailedAggregates.
+func (r *Relay) RunOnce(ctx context.Context) error {
+	held, err := r.repo.FailedAggregates(ctx)
+	if err != nil {
+		return err
+	}
+	r.reportHeld(held)
+
+	pending, err := r.repo.FindPending(ctx, relayBatchSize, held)
+	if err != nil {
+		return err
+	}
+
+	blocked := make(map[string]bool)
+	for _, event := range pending {
+		if blocked[event.AggregateID] {
+			continue
+		}
+
+		if err := r.bus.Publish(ctx, NewMessage(event)); err != nil {
+			blocked[event.AggregateID] = true
+			giveUp := event.Attempts+1 >= relayMaxAttempts
+			if giveUp {
+				log.Printf("Giving up on outbox event %s (%s): %v", event.ID, event.Type, err)
+			}
+			markErr := r.repo.MarkAttemptFailed(ctx, event, err, giveUp)
+			switch {
+			case errors.Is(markErr, repository.ErrOutboxEventChanged):
+				// Published or resolved meanwhile, its state is not ours to overwrite
+				log.Printf("Outbox event %s changed while it was relayed", event.ID)
+			case markErr != nil:
+				log.Printf("Failed to record attempt of outbox event %s: %v", event.ID, markErr)
+			}
+			continue
+		}
+
+		err := r.repo.MarkPublished(ctx, event)
+		switch {
+		case errors.Is(err, repository.ErrOutboxEventChanged):
+			log.Printf("Outbox event %s changed while it was relayed", event.ID)
+			blocked[event.AggregateID] = true
+		case err != nil:
+			// Published but still pending, the next run delivers it again
+			log.Printf("Failed to mark outbox event %s published: %v", event.ID, err)
+			blocked[event.AggregateID] = true
+		}
+	}
+
+	return nil
+}
+
+// reportHeld updates the held aggregates gauge and logs whenever they change
+func (r *Relay) reportHeld(held map[string]bool) {
+	r.held.Store(int64(len(held)))
+
+	ids := make([]string, 0, len(held))
+	for id := range held {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	current := strings.Join(ids, ", ")
+	if current == r.lastHeld {
+		return
+	}
+	r.lastHeld = current
+
+	if len(ids) == 0 {
+		log.Print("Outbox relay no longer holds back any aggregate")
+		return
+	}
+	log.Printf("Outbox relay holds back the events of %d aggregates with a failed event until it is republished or dismissed: %s",
+		len(ids), current)
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSBus publishes messages to an SNS topic. Message attributes carry the event type
+// so subscriptions can filter, FIFO topics are grouped per aggregate to keep order.
+type SNSBus struct {
+	client   *sns.Client
+	topicArn string
+}
+
+func NewSNSBus(client *sns.Client, topicArn string) *SNSBus {
+	return &SNSBus{client: client, topicArn: topicArn}
+}
+
+func (b *SNSBus) Publish(ctx context.Context, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(b.topicArn),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"eventType":      {DataType: aws.String("String"), StringValue: aws.String(message.Type)},
+			"idempotencyKey": {DataType: aws.String("String"), StringValue: aws.String(message.ID)},
+		},
+	}
+
+	if strings.HasSuffix(b.topicArn, ".fifo") {
+		input.MessageGroupId = aws.String(message.AggregateID)
+		input.MessageDeduplicationId = aws.String(message.ID)
+	}
+
+	if _, err := b.client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("failed to publish to topic %s: %w", b.topicArn, err)
+	}
+	return nil
+}
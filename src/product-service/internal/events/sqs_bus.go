@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQSBus sends messages straight to an SQS queue, for consumers without a topic
+type SQSBus struct {
+	client   *sqs.Client
+	queueUrl string
+}
+
+func NewSQSBus(client *sqs.Client, queueUrl string) *SQSBus {
+	return &SQSBus{client: client, queueUrl: queueUrl}
+}
+
+func (b *SQSBus) Publish(ctx context.Context, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(b.queueUrl),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"eventType":      {DataType: aws.String("String"), StringValue: aws.String(message.Type)},
+			"idempotencyKey": {DataType: aws.String("String"), StringValue: aws.String(message.ID)},
+		},
+	}
+
+	if strings.HasSuffix(b.queueUrl, ".fifo") {
+		input.MessageGroupId = aws.String(message.AggregateID)
+		input.MessageDeduplicationId = aws.String(message.ID)
+	}
+
+	if _, err := b.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("failed to send to queue %s: %w", b.queueUrl, err)
+	}
+	return nil
+}
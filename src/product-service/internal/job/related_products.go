@@ -0,0 +1,228 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+)
+
+const (
+	relatedScanPageSize = 100
+
+	// relatedCandidateLimit caps the products read per product from each of its
+	// category and brand
+	relatedCandidateLimit = 50
+
+	// relatedProductsLease names the lease the instance running the job holds
+	relatedProductsLease = "related-products"
+
+	// Products within this relative price distance are considered comparable
+	priceWindow = 0.3
+
+	categoryWeight = 2.0
+	brandWeight    = 1.0
+	priceWeight    = 1.0
+)
+
+// RelatedProductsJob periodically recomputes similarity-based related products.
+// Every instance starts it, the one holding the lease runs it.
+type RelatedProductsJob struct {
+	productRepo repository.ProductRepository
+	relatedRepo repository.RelatedProductRepository
+	leases      repository.LeaseRepository
+	owner       string
+	interval    time.Duration
+	limit       int
+}
+
+func NewRelatedProductsJob(productRepo repository.ProductRepository,
+	relatedRepo repository.RelatedProductRepository,
+	leases repository.LeaseRepository,
+	owner string,
+	interval time.Duration) *RelatedProductsJob {
+	return &RelatedProductsJob{
+		productRepo: productRepo,
+		relatedRepo: relatedRepo,
+		leases:      leases,
+		owner:       owner,
+		interval:    interval,
+		limit:       domain.MaxRelatedProductsPerSet,
+	}
+}
+
+// Start runs the job immediately and then on every tick until ctx is cancelled,
+// whenever this instance gets the lease. The lease lasts one interval, so the job
+// runs once per interval across all instances.
+func (j *RelatedProductsJob) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.runLeased(ctx); err != nil {
+			log.Printf("Related products job failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runLeased runs the job if this instance gets the lease
+func (j *RelatedProductsJob) runLeased(ctx context.Context) error {
+	acquired, err := j.leases.Acquire(ctx, relatedProductsLease, j.owner, j.interval)
+	if err != nil || !acquired {
+		return err
+	}
+	return j.Run(ctx)
+}
+
+// Run scores the catalog page by page. Each product is scored against the products
+// sharing its category or brand within the price window, at most
+// relatedCandidateLimit closest in price of each, so a run costs a few queries per
+// product however large a category grows. Only links that changed are written.
+// A run outlasting half the interval renews the lease, and stops once it is lost.
+func (j *RelatedProductsJob) Run(ctx context.Context) error {
+	started := time.Now()
+	renewed := started
+
+	scored, failed, unchanged := 0, 0, 0
+	errLeaseLost := errors.New("lease lost")
+
+	err := j.productRepo.ScanPages(ctx, relatedScanPageSize, func(page []domain.Product) error {
+		if time.Since(renewed) > j.interval/2 {
+			acquired, err := j.leases.Acquire(ctx, relatedProductsLease, j.owner, j.interval)
+			if err != nil {
+				return err
+			}
+			if !acquired {
+				return errLeaseLost
+			}
+			renewed = time.Now()
+		}
+
+		ids := make([]string, 0, len(page))
+		for _, product := range page {
+			ids = append(ids, product.ID)
+		}
+		stored, err := j.relatedRepo.FindComputed(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, product := range page {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			links, err := j.relatedLinks(ctx, product)
+			if err != nil {
+				return err
+			}
+			scored++
+
+			if current, ok := stored[product.ID]; ok && slices.Equal(current, links) {
+				unchanged++
+				continue
+			}
+
+			if err := j.relatedRepo.SetComputed(ctx, product.ID, links); err != nil {
+				log.Printf("Failed to save related products for %s: %v", product.ID, err)
+				failed++
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLeaseLost) {
+		log.Printf("Related products job lost its lease after %d products", scored)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Related products job finished: %d products, %d unchanged, %d failed, took %v",
+		scored, unchanged, failed, time.Since(started))
+	return nil
+}
+
+// relatedLinks scores the candidates of product and keeps the best j.limit
+func (j *RelatedProductsJob) relatedLinks(ctx context.Context, product domain.Product) ([]domain.RelatedLink, error) {
+	// The prices priceCloseness scores above 0
+	low, high := product.Price*(1-priceWindow), product.Price/(1-priceWindow)
+
+	var sameCategory, sameBrand []domain.Product
+	var err error
+	if product.CategoryID != "" {
+		sameCategory, err = j.productRepo.FindByCategoryNearPrice(ctx, product.CategoryID,
+			product.Price, low, high, relatedCandidateLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if product.BrandID != "" {
+		sameBrand, err = j.productRepo.FindByBrandNearPrice(ctx, product.BrandID,
+			product.Price, low, high, relatedCandidateLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := make(map[string]domain.Product, len(sameCategory)+len(sameBrand))
+	for _, c := range append(sameCategory, sameBrand...) {
+		if c.ID != product.ID {
+			candidates[c.ID] = c
+		}
+	}
+
+	links := make([]domain.RelatedLink, 0, len(candidates))
+	for _, c := range candidates {
+		var score float64
+		if c.CategoryID == product.CategoryID && product.CategoryID != "" {
+			score += categoryWeight
+		}
+		if c.BrandID == product.BrandID && product.BrandID != "" {
+			score += brandWeight
+		}
+		score += priceWeight * priceCloseness(product.Price, c.Price)
+		links = append(links, domain.RelatedLink{
+			ProductID: c.ID,
+			Type:      domain.RelationRelated,
+			Score:     math.Round(score*100) / 100,
+		})
+	}
+
+	sort.Slice(links, func(a, b int) bool {
+		if links[a].Score == links[b].Score {
+			return links[a].ProductID < links[b].ProductID
+		}
+		return links[a].Score > links[b].Score
+	})
+	if len(links) > j.limit {
+		links = links[:j.limit]
+	}
+	return links, nil
+}
+
+// priceCloseness is 1 for equal prices, falling to 0 at the edge of the price window
+func priceCloseness(a, b float64) float64 {
+	high := math.Max(a, b)
+	if high <= 0 {
+		return 0
+	}
+
+	distance := math.Abs(a-b) / high
+	if distance >= priceWindow {
+		return 0
+	}
+	return 1 - distance/priceWindow
+}
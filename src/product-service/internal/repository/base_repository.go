@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -17,6 +18,8 @@ type UpdateOptions struct {
 	ConditionExpression  *string
 	ExpressionAttributes map[string]interface{}
 	ReturnValues         types.ReturnValue
+	// ExpectedVersion rejects the update with ErrConcurrentUpdate when the stored version differs
+	ExpectedVersion *int
 }
 
 // QueryOptions provides configuration for query operations
@@ -53,6 +56,7 @@ type BaseRepository[T domain.DynamoEntity] interface {
 	FindByIDConsistent(ctx context.Context, id string) (*T, error)
 	Delete(ctx context.Context, entity T) error
 	DeleteByID(ctx context.Context, id string) error
+	DeleteByIDIfVersion(ctx context.Context, id string, version int) error
 
 	// Advanced operations
 	Update(ctx context.Context, entity *T, opts UpdateOptions) (*T, error)
@@ -83,17 +87,7 @@ func NewBaseRepository[T domain.DynamoEntity](client *dynamodb.Client, tableName
 
 // Save saves an entity with automatic timestamps
 func (r *baseRepository[T]) Save(ctx context.Context, entity *T) error {
-	// Set timestamps if the entity supports it
-	if timestamped, ok := any(entity).(domain.TimestampedEntity); ok {
-		now := time.Now().Unix()
-		timestamped.SetCreatedAt(now)
-		timestamped.SetUpdatedAt(now)
-	}
-
-	if versioned, ok := any(entity).(domain.VersionedEntity); ok {
-		versioned.SetVersion(1)
-	}
-
+	stampCreated(entity, time.Now().Unix())
 	return r.service.PutItem(ctx, *entity)
 }
 
@@ -103,19 +97,35 @@ func (r *baseRepository[T]) SaveBatch(ctx context.Context, entities *[]T) (int,
 
 	for i := range items {
 		// Take pointer to each item
-		if timestamped, ok := any(&items[i]).(domain.TimestampedEntity); ok {
-			timestamped.SetCreatedAt(now)
-			timestamped.SetUpdatedAt(now)
-		}
-
-		if versioned, ok := any(&items[i]).(domain.VersionedEntity); ok {
-			versioned.SetVersion(1)
-		}
+		stampCreated(&items[i], now)
 	}
 
 	return r.service.BatchWriteItems(ctx, items)
 }
 
+// stampCreated sets timestamps and the initial version if the entity supports them
+func stampCreated(entity any, now int64) {
+	if timestamped, ok := entity.(domain.TimestampedEntity); ok {
+		timestamped.SetCreatedAt(now)
+		timestamped.SetUpdatedAt(now)
+	}
+
+	if versioned, ok := entity.(domain.VersionedEntity); ok {
+		versioned.SetVersion(1)
+	}
+}
+
+// stampUpdated adds updatedAt and the next version to the update attributes
+func stampUpdated(entity any, attributes map[string]any) {
+	if _, ok := entity.(domain.TimestampedEntity); ok {
+		attributes["updatedAt"] = time.Now().Unix()
+	}
+
+	if versioned, ok := entity.(domain.VersionedEntity); ok {
+		attributes["version"] = versioned.GetVersion() + 1
+	}
+}
+
 // FindByID finds an entity by its ID (eventually consistent)
 func (r *baseRepository[T]) FindByID(ctx context.Context, id string) (*T, error) {
 	key := service.CreateStringKey(id)
@@ -139,36 +149,48 @@ func (r *baseRepository[T]) DeleteByID(ctx context.Context, id string) error {
 	return r.service.DeleteItem(ctx, key)
 }
 
+// DeleteByIDIfVersion removes an entity by its ID only while it still has the given version
+func (r *baseRepository[T]) DeleteByIDIfVersion(ctx context.Context, id string, version int) error {
+	key := service.CreateStringKey(id)
+	return conditionError(r.service.DeleteItemIfVersion(ctx, key, version))
+}
+
 // Update updates an entity with custom options
 func (r *baseRepository[T]) Update(ctx context.Context, entity *T, opts UpdateOptions) (*T, error) {
 	attributes := opts.ExpressionAttributes
 	// Set timestamps if the entity supports it
-	if _, ok := any(entity).(domain.TimestampedEntity); ok {
-		now := time.Now().Unix()
-		attributes["updatedAt"] = now
-	}
-
-	if versioned, ok := any(entity).(domain.VersionedEntity); ok {
-		attributes["version"] = versioned.GetVersion() + 1
-	}
+	stampUpdated(entity, attributes)
 
-	return r.service.UpdateItem(ctx, service.UpdateItemOptions{
+	updated, err := r.service.UpdateItem(ctx, service.UpdateItemOptions{
 		Key:                  (*entity).GetKey(),
 		ConditionExpression:  opts.ConditionExpression,
 		ExpressionAttributes: attributes,
 		ReturnValues:         opts.ReturnValues,
+		ExpectedVersion:      opts.ExpectedVersion,
 	})
+	return updated, conditionError(err)
 }
 
 // UpdateByID updates an entity by ID with custom options
 func (r *baseRepository[T]) UpdateByID(ctx context.Context, id string, opts UpdateOptions) (*T, error) {
 	key := service.CreateStringKey(id)
-	return r.service.UpdateItem(ctx, service.UpdateItemOptions{
+	updated, err := r.service.UpdateItem(ctx, service.UpdateItemOptions{
 		Key:                  key,
 		ConditionExpression:  opts.ConditionExpression,
 		ExpressionAttributes: opts.ExpressionAttributes,
 		ReturnValues:         opts.ReturnValues,
+		ExpectedVersion:      opts.ExpectedVersion,
 	})
+	return updated, conditionError(err)
+}
+
+// conditionError reports a failed version condition as ErrConcurrentUpdate
+func conditionError(err error) error {
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return ErrConcurrentUpdate
+	}
+	return err
 }
 
 // Exists checks if an entity exists by ID
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/cache"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"golang.org/x/sync/singleflight"
+)
+
+// Bounds a shared load, which no caller can cancel
+const cacheLoadTimeout = 10 * time.Second
+
+// Stored for ids the store does not know, so repeated misses skip DynamoDB
+var notFoundMarker = []byte("null")
+
+// Stored by invalidations in place of the dropped entry, for as long as a load may
+// run. Loads only cache into empty keys, so one that overlapped an invalidation,
+// made by any instance sharing the backend, cannot cache what it read before.
+var invalidatedMarker = []byte("invalidated")
+
+// Invalidator drops cached entries whose data changed outside the repository
+type Invalidator interface {
+	Invalidate(ctx context.Context, ids ...string) error
+}
+
+// CacheOptions tunes how long entries stay cached
+type CacheOptions struct {
+	Prefix      string
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+}
+
+// cachedRepository serves FindByID and ScanItems from a cache and replaces the
+// affected entries with invalidatedMarker on every write. Concurrent misses for the
+// same key share one load, which runs detached from the request that started it, so
+// its cancellation does not fail the others. Cache failures are logged and fall
+// through to the store.
+type cachedRepository[T domain.DynamoEntity] struct {
+	BaseRepository[T]
+	backend cache.Backend
+	opts    CacheOptions
+	group   singleflight.Group
+	metrics *cache.Metrics
+
+	// Counts invalidations of this instance. A load that overlapped one is not
+	// cached, which skips the write invalidatedMarker would refuse anyway.
+	generation atomic.Uint64
+}
+
+// NewCachedRepository decorates inner with a read-through cache
+func NewCachedRepository[T domain.DynamoEntity](inner BaseRepository[T], backend cache.Backend,
+	metrics *cache.Metrics, opts CacheOptions) BaseRepository[T] {
+	return &cachedRepository[T]{
+		BaseRepository: inner,
+		backend:        backend,
+		opts:           opts,
+		metrics:        metrics,
+	}
+}
+
+func (r *cachedRepository[T]) idKey(id string) string {
+	return r.opts.Prefix + ":id:" + id
+}
+
+func (r *cachedRepository[T]) allKey() string {
+	return r.opts.Prefix + ":all"
+}
+
+func (r *cachedRepository[T]) FindByID(ctx context.Context, id string) (*T, error) {
+	key := r.idKey(id)
+
+	if cached, ok := r.lookup(ctx, key); ok {
+		if string(cached) == string(notFoundMarker) {
+			r.metrics.NegativeHit()
+			return nil, nil
+		}
+
+		var entity T
+		if err := json.Unmarshal(cached, &entity); err == nil {
+			r.metrics.Hit()
+			return &entity, nil
+		}
+	}
+	r.metrics.Miss()
+
+	value, err, _ := r.group.Do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+
+		generation := r.generation.Load()
+		entity, err := r.BaseRepository.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if entity == nil {
+			r.store(ctx, key, generation, notFoundMarker, r.opts.NotFoundTTL)
+		} else {
+			r.storeJSON(ctx, key, generation, entity)
+		}
+		return entity, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entity, _ := value.(*T)
+	if entity == nil {
+		return nil, nil
+	}
+	// Callers may modify the entity, so do not hand out the shared instance
+	copied := *entity
+	return &copied, nil
+}
+
+func (r *cachedRepository[T]) Exists(ctx context.Context, id string) (bool, error) {
+	entity, err := r.FindByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return entity != nil, nil
+}
+
+func (r *cachedRepository[T]) ScanItems(ctx context.Context) ([]T, error) {
+	key := r.allKey()
+
+	if cached, ok := r.lookup(ctx, key); ok {
+		var entities []T
+		if err := json.Unmarshal(cached, &entities); err == nil {
+			r.metrics.Hit()
+			return entities, nil
+		}
+	}
+	r.metrics.Miss()
+
+	value, err, _ := r.group.Do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+
+		generation := r.generation.Load()
+		entities, err := r.BaseRepository.ScanItems(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.storeJSON(ctx, key, generation, entities)
+		return entities, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entities, _ := value.([]T)
+	return append([]T(nil), entities...), nil
+}
+
+func (r *cachedRepository[T]) Save(ctx context.Context, entity *T) error {
+	defer r.Invalidate(ctx, keyID(*entity))
+	return r.BaseRepository.Save(ctx, entity)
+}
+
+func (r *cachedRepository[T]) SaveBatch(ctx context.Context, entities *[]T) (int, error) {
+	ids := make([]string, 0, len(*entities))
+	for _, entity := range *entities {
+		ids = append(ids, keyID(entity))
+	}
+	defer r.Invalidate(ctx, ids...)
+
+	return r.BaseRepository.SaveBatch(ctx, entities)
+}
+
+func (r *cachedRepository[T]) Update(ctx context.Context, entity *T, opts UpdateOptions) (*T, error) {
+	defer r.Invalidate(ctx, keyID(*entity))
+	return r.BaseRepository.Update(ctx, entity, opts)
+}
+
+func (r *cachedRepository[T]) UpdateByID(ctx context.Context, id string, opts UpdateOptions) (*T, error) {
+	defer r.Invalidate(ctx, id)
+	return r.BaseRepository.UpdateByID(ctx, id, opts)
+}
+
+func (r *cachedRepository[T]) Delete(ctx context.Context, entity T) error {
+	defer r.Invalidate(ctx, keyID(entity))
+	return r.BaseRepository.Delete(ctx, entity)
+}
+
+func (r *cachedRepository[T]) DeleteByID(ctx context.Context, id string) error {
+	defer r.Invalidate(ctx, id)
+	return r.BaseRepository.DeleteByID(ctx, id)
+}
+
+func (r *cachedRepository[T]) DeleteByIDIfVersion(ctx context.Context, id string, version int) error {
+	defer r.Invalidate(ctx, id)
+	return r.BaseRepository.DeleteByIDIfVersion(ctx, id, version)
+}
+
+// Invalidate drops the given ids and the cached listing. Writes invalidate even
+// when they fail, since a failed write may still have been applied.
+func (r *cachedRepository[T]) Invalidate(ctx context.Context, ids ...string) error {
+	r.generation.Add(1)
+
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, r.idKey(id))
+	}
+	keys = append(keys, r.allKey())
+
+	r.metrics.Invalidated()
+	var failed error
+	for _, key := range keys {
+		r.group.Forget(key)
+		// Loads end within cacheLoadTimeout, so the marker outlives every load it overlapped
+		if err := r.backend.Set(ctx, key, invalidatedMarker, cacheLoadTimeout); err != nil {
+			failed = err
+		}
+	}
+	if failed != nil {
+		r.metrics.Error()
+		log.Printf("Failed to invalidate cache %s: %v", r.opts.Prefix, failed)
+		return failed
+	}
+	return nil
+}
+
+func (r *cachedRepository[T]) lookup(ctx context.Context, key string) ([]byte, bool) {
+	cached, ok, err := r.backend.Get(ctx, key)
+	if err != nil {
+		r.metrics.Error()
+		log.Printf("Cache lookup of %s failed: %v", key, err)
+		return nil, false
+	}
+	if ok && string(cached) == string(invalidatedMarker) {
+		return nil, false
+	}
+	return cached, ok
+}
+
+func (r *cachedRepository[T]) storeJSON(ctx context.Context, key string, generation uint64, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		r.metrics.Error()
+		return
+	}
+	r.store(ctx, key, generation, data, r.opts.TTL)
+}
+
+// store caches value loaded at generation, unless an invalidation happened since.
+// Invalidations of other instances are only seen through the marker they left, so
+// the value is only written into an empty key.
+func (r *cachedRepository[T]) store(ctx context.Context, key string, generation uint64, value []byte, ttl time.Duration) {
+	if r.generation.Load() != generation {
+		return
+	}
+
+	if _, err := r.backend.SetIfAbsent(ctx, key, value, ttl); err != nil {
+		r.metrics.Error()
+		log.Printf("Cache store of %s failed: %v", key, err)
+	}
+}
+
+// WithCache returns a decorator that adds a read-through cache to a repository
+func WithCache[T domain.DynamoEntity](backend cache.Backend, metrics *cache.Metrics, opts CacheOptions) func(BaseRepository[T]) BaseRepository[T] {
+	return func(inner BaseRepository[T]) BaseRepository[T] {
+		return NewCachedRepository(inner, backend, metrics, opts)
+	}
+}
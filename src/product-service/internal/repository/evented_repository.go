@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+// DynamoDB allows 100 operations per transaction and each entity write pairs with an outbox put
+const maxEntitiesPerTransaction = 50
+
+// eventedRepository writes a catalog change event to the outbox in the same
+// transaction as every entity write, so no change is lost or published twice
+// without having happened.
+type eventedRepository[T domain.DynamoEntity] struct {
+	BaseRepository[T]
+	dynamo    *service.DynamoService[T]
+	outbox    *service.DynamoService[domain.OutboxEvent]
+	aggregate string
+}
+
+// NewEventedRepository creates a base repository that publishes change events for aggregate
+func NewEventedRepository[T domain.DynamoEntity](client *dynamodb.Client, tableName string, aggregate string) BaseRepository[T] {
+	return &eventedRepository[T]{
+		BaseRepository: NewBaseRepository[T](client, tableName),
+		dynamo:         service.NewDynamoService[T](client, tableName),
+		outbox:         newOutboxService(client),
+		aggregate:      aggregate,
+	}
+}
+
+func (r *eventedRepository[T]) Save(ctx context.Context, entity *T) error {
+	stampCreated(entity, time.Now().Unix())
+
+	put, err := r.dynamo.PutTransactItem(*entity)
+	if err != nil {
+		return err
+	}
+
+	return r.commit(ctx, put, *entity, domain.ActionCreated)
+}
+
+func (r *eventedRepository[T]) SaveBatch(ctx context.Context, entities *[]T) (int, error) {
+	items := *entities
+	now := time.Now().Unix()
+	written := 0
+
+	for start := 0; start < len(items); start += maxEntitiesPerTransaction {
+		end := min(start+maxEntitiesPerTransaction, len(items))
+
+		writes := make([]types.TransactWriteItem, 0, 2*(end-start))
+		for i := start; i < end; i++ {
+			stampCreated(&items[i], now)
+
+			put, err := r.dynamo.PutTransactItem(items[i])
+			if err != nil {
+				return written, err
+			}
+			event, err := r.eventItem(items[i], domain.ActionCreated)
+			if err != nil {
+				return written, err
+			}
+			writes = append(writes, put, event)
+		}
+
+		if err := r.dynamo.TransactWriteItems(ctx, writes); err != nil {
+			return written, err
+		}
+		written += end - start
+	}
+
+	return written, nil
+}
+
+// Update applies the update and returns the stored entity, which is also the event
+// payload. The payload is built from the item as stored, read right before and
+// guarded by its version, so changes of concurrent writers are not lost from it.
+// Those writers make the update retry, unless the caller expects a version.
+func (r *eventedRepository[T]) Update(ctx context.Context, entity *T, opts UpdateOptions) (*T, error) {
+	return r.update(ctx, keyID(*entity), opts)
+}
+
+func (r *eventedRepository[T]) UpdateByID(ctx context.Context, id string, opts UpdateOptions) (*T, error) {
+	return r.update(ctx, id, opts)
+}
+
+func (r *eventedRepository[T]) update(ctx context.Context, id string, opts UpdateOptions) (*T, error) {
+	for attempt := 0; attempt < service.MaxRetryAttempts; attempt++ {
+		current, err := r.FindByIDConsistent(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, fmt.Errorf("entity %s not found", id)
+		}
+
+		expectedVersion := opts.ExpectedVersion
+		if versioned, ok := any(current).(domain.VersionedEntity); ok {
+			version := versioned.GetVersion()
+			if expectedVersion != nil && *expectedVersion != version {
+				return nil, ErrConcurrentUpdate
+			}
+			expectedVersion = &version
+		}
+
+		attributes := maps.Clone(opts.ExpressionAttributes)
+		if attributes == nil {
+			attributes = map[string]any{}
+		}
+		stampUpdated(current, attributes)
+
+		updated, err := applyAttributes(*current, attributes)
+		if err != nil {
+			return nil, err
+		}
+
+		update, err := r.dynamo.UpdateTransactItem(service.UpdateItemOptions{
+			Key:                  (*current).GetKey(),
+			ExpressionAttributes: attributes,
+			ExpectedVersion:      expectedVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.commit(ctx, update, updated, domain.ActionUpdated)
+		if errors.Is(err, ErrConcurrentUpdate) && opts.ExpectedVersion == nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.ReturnValues == types.ReturnValueNone {
+			return nil, nil
+		}
+		return &updated, nil
+	}
+
+	return nil, ErrConcurrentUpdate
+}
+
+func (r *eventedRepository[T]) Delete(ctx context.Context, entity T) error {
+	return r.DeleteByID(ctx, keyID(entity))
+}
+
+// DeleteByID publishes the entity as it was before deletion
+func (r *eventedRepository[T]) DeleteByID(ctx context.Context, id string) error {
+	return r.deleteByID(ctx, id, nil)
+}
+
+func (r *eventedRepository[T]) DeleteByIDIfVersion(ctx context.Context, id string, version int) error {
+	return r.deleteByID(ctx, id, &version)
+}
+
+func (r *eventedRepository[T]) deleteByID(ctx context.Context, id string, expectedVersion *int) error {
+	entity, err := r.FindByIDConsistent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if entity == nil {
+		return nil
+	}
+
+	del, err := r.dynamo.DeleteTransactItem((*entity).GetKey(), expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	return r.commit(ctx, del, *entity, domain.ActionDeleted)
+}
+
+func (r *eventedRepository[T]) commit(ctx context.Context, write types.TransactWriteItem, entity T, action string) error {
+	event, err := r.eventItem(entity, action)
+	if err != nil {
+		return err
+	}
+
+	err = r.dynamo.TransactWriteItems(ctx, []types.TransactWriteItem{write, event})
+
+	// The first cancellation reason belongs to the entity write
+	var canceledEx *types.TransactionCanceledException
+	if errors.As(err, &canceledEx) {
+		reasons := canceledEx.CancellationReasons
+		if len(reasons) > 0 && aws.ToString(reasons[0].Code) == "ConditionalCheckFailed" {
+			return ErrConcurrentUpdate
+		}
+	}
+	return err
+}
+
+func (r *eventedRepository[T]) eventItem(entity T, action string) (types.TransactWriteItem, error) {
+	event, err := domain.NewOutboxEvent(r.aggregate, keyID(entity), action, entity)
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	return r.outbox.PutTransactItem(event)
+}
+
+// keyID returns the string id from an entity key
+func keyID(entity domain.DynamoEntity) string {
+	if id, ok := entity.GetKey()["id"].(*types.AttributeValueMemberS); ok {
+		return id.Value
+	}
+	return ""
+}
+
+// applyAttributes returns a copy of entity with the update attributes applied, the
+// same result DynamoDB returns for ReturnValues ALL_NEW
+func applyAttributes[T any](entity T, attributes map[string]any) (T, error) {
+	var updated T
+
+	item, err := attributevalue.MarshalMap(entity)
+	if err != nil {
+		return updated, fmt.Errorf("failed to marshal item: %w", err)
+	}
+
+	for key, value := range attributes {
+		if stringer, ok := value.(fmt.Stringer); ok {
+			value = stringer.String()
+		}
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return updated, fmt.Errorf("failed to marshal attribute %s: %w", key, err)
+		}
+		item[key] = av
+	}
+
+	if err := attributevalue.UnmarshalMap(item, &updated); err != nil {
+		return updated, fmt.Errorf("failed to unmarshal updated item: %w", err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+// LeaseRepository hands out leases, so a job or stream shard handled on every
+// instance is only handled by one of them at a time
+type LeaseRepository interface {
+	// Acquire takes or renews the lease of job for owner until ttl passed. It
+	// reports false while another owner holds an unexpired lease.
+	Acquire(ctx context.Context, job string, owner string, ttl time.Duration) (bool, error)
+}
+
+type leaseRepository struct {
+	dynamo *service.DynamoService[domain.JobLease]
+}
+
+func NewLeaseRepository(client *dynamodb.Client) LeaseRepository {
+	const tableName string = "JobLeases"
+	dynamoService := service.NewDynamoService[domain.JobLease](client, tableName)
+
+	exist, err := dynamoService.TableExists(context.Background())
+	if err != nil {
+		log.Fatalf("Error when process TableExists: %v", err)
+	}
+
+	if !exist {
+		if err := dynamoService.CreateTable(context.Background()); err != nil {
+			log.Fatalf("Error when creating JobLeases table: %v", err)
+		}
+		// Leases of stream shards pile up as shards are replaced
+		if err := dynamoService.EnableTimeToLive(context.Background(), "expiresAt"); err != nil {
+			log.Printf("Job leases will not expire: %v", err)
+		}
+	}
+
+	return &leaseRepository{dynamo: dynamoService}
+}
+
+func (r *leaseRepository) Acquire(ctx context.Context, job string, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	update := expression.Set(expression.Name("owner"), expression.Value(owner)).
+		Set(expression.Name("expiresAt"), expression.Value(now.Add(ttl).Unix()))
+	condition := expression.AttributeNotExists(expression.Name("id")).
+		Or(expression.LessThanEqual(expression.Name("expiresAt"), expression.Value(now.Unix()))).
+		Or(expression.Equal(expression.Name("owner"), expression.Value(owner)))
+
+	_, err := r.dynamo.UpdateItemWithBuilder(ctx, service.CreateStringKey(job), update, &condition, types.ReturnValueNone)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return false, nil
+	}
+	return err == nil, err
+}
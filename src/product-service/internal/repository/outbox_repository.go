@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+const OutboxTableName string = "Outbox"
+
+// outboxStatusIndex finds the events of one status in the order they occurred
+const outboxStatusIndex = "status-occurredAt-index"
+
+var (
+	ErrOutboxEventNotFailed = errors.New("outbox event not found or not failed")
+	ErrOutboxEventChanged   = errors.New("outbox event changed since it was read")
+)
+
+type OutboxRepository interface {
+	FindPending(ctx context.Context, limit int, held map[string]bool) ([]domain.OutboxEvent, error)
+	FindFailed(ctx context.Context, limit int) ([]domain.OutboxEvent, error)
+	FailedAggregates(ctx context.Context) (map[string]bool, error)
+	MarkPublished(ctx context.Context, event domain.OutboxEvent) error
+	MarkAttemptFailed(ctx context.Context, event domain.OutboxEvent, cause error, giveUp bool) error
+	Republish(ctx context.Context, id string) error
+	Dismiss(ctx context.Context, id string) error
+}
+
+type outboxRepository struct {
+	dynamo *service.DynamoService[domain.OutboxEvent]
+}
+
+func NewOutboxRepository(client *dynamodb.Client) OutboxRepository {
+	return &outboxRepository{dynamo: newOutboxService(client)}
+}
+
+// newOutboxService makes sure the outbox table exists with its status index and
+// expiry of old events enabled
+func newOutboxService(client *dynamodb.Client) *service.DynamoService[domain.OutboxEvent] {
+	dynamoService := service.NewDynamoService[domain.OutboxEvent](client, OutboxTableName)
+
+	exist, err := dynamoService.TableExists(context.Background())
+	if err != nil {
+		log.Fatalf("Error when process TableExists: %v", err)
+	}
+
+	attributes := []types.AttributeDefinition{
+		{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("occurredAt"), AttributeType: types.ScalarAttributeTypeN},
+	}
+	statusIndex := types.GlobalSecondaryIndex{
+		IndexName: aws.String(outboxStatusIndex),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("occurredAt"), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+
+	if !exist {
+		err := dynamoService.CreateTableWithDefinition(context.Background(), service.TableDefinition{
+			AttributeDefinitions: attributes,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			},
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{statusIndex},
+			BillingMode:            types.BillingModePayPerRequest,
+		})
+		if err != nil {
+			log.Fatalf("Error when creating Outbox table: %v", err)
+		}
+		if err := dynamoService.EnableTimeToLive(context.Background(), "expiresAt"); err != nil {
+			log.Printf("Outbox events will not expire: %v", err)
+		}
+	} else if err := dynamoService.EnsureGlobalSecondaryIndex(context.Background(), statusIndex, attributes); err != nil {
+		log.Fatalf("Error when indexing Outbox table: %v", err)
+	}
+
+	return dynamoService
+}
+
+// FindPending returns the oldest pending events first, skipping those of the held
+// aggregates. Aggregates with a FAILED event are held, see FailedAggregates.
+func (r *outboxRepository) FindPending(ctx context.Context, limit int, held map[string]bool) ([]domain.OutboxEvent, error) {
+	var events []domain.OutboxEvent
+	err := r.dynamo.QueryPages(ctx, service.QueryRequest{
+		IndexName:  outboxStatusIndex,
+		KeyBuilder: expression.Key("status").Equal(expression.Value(domain.OutboxStatusPending)),
+	}, int32(limit), func(page []domain.OutboxEvent) bool {
+		for _, event := range page {
+			if held[event.AggregateID] {
+				continue
+			}
+			events = append(events, event)
+			if len(events) == limit {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FindFailed returns the oldest events the relay gave up on first
+func (r *outboxRepository) FindFailed(ctx context.Context, limit int) ([]domain.OutboxEvent, error) {
+	var events []domain.OutboxEvent
+	err := r.dynamo.QueryPages(ctx, service.QueryRequest{
+		IndexName:  outboxStatusIndex,
+		KeyBuilder: expression.Key("status").Equal(expression.Value(domain.OutboxStatusFailed)),
+	}, int32(limit), func(page []domain.OutboxEvent) bool {
+		events = append(events, page...)
+		if len(events) >= limit {
+			events = events[:limit]
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FailedAggregates returns the aggregates that have an event the relay gave up on.
+// Their later events are held back so consumers never see them before it; they
+// follow once the failed event is republished or dismissed.
+func (r *outboxRepository) FailedAggregates(ctx context.Context) (map[string]bool, error) {
+	projection := expression.NamesList(expression.Name("aggregateId"))
+	failed := make(map[string]bool)
+
+	err := r.dynamo.QueryPages(ctx, service.QueryRequest{
+		IndexName:         outboxStatusIndex,
+		KeyBuilder:        expression.Key("status").Equal(expression.Value(domain.OutboxStatusFailed)),
+		ProjectionBuilder: &projection,
+	}, 100, func(page []domain.OutboxEvent) bool {
+		for _, event := range page {
+			failed[event.AggregateID] = true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// MarkPublished records a delivery. It returns ErrOutboxEventChanged when the event
+// is no longer pending as it was read, e.g. because it was published meanwhile.
+func (r *outboxRepository) MarkPublished(ctx context.Context, event domain.OutboxEvent) error {
+	now := time.Now()
+	update := expression.Set(expression.Name("status"), expression.Value(domain.OutboxStatusPublished)).
+		Set(expression.Name("publishedAt"), expression.Value(now.Unix())).
+		Set(expression.Name("expiresAt"), expression.Value(now.Add(domain.OutboxRetention).Unix())).
+		Add(expression.Name("attempts"), expression.Value(1))
+
+	return r.markAttempt(ctx, event, update)
+}
+
+// MarkAttemptFailed records a failed delivery, giving up parks the event as FAILED.
+// Like MarkPublished, it only applies to the event as it was read.
+func (r *outboxRepository) MarkAttemptFailed(ctx context.Context, event domain.OutboxEvent, cause error, giveUp bool) error {
+	update := expression.Set(expression.Name("lastError"), expression.Value(cause.Error())).
+		Add(expression.Name("attempts"), expression.Value(1))
+	if giveUp {
+		update = update.Set(expression.Name("status"), expression.Value(domain.OutboxStatusFailed))
+	}
+
+	return r.markAttempt(ctx, event, update)
+}
+
+func (r *outboxRepository) markAttempt(ctx context.Context, event domain.OutboxEvent, update expression.UpdateBuilder) error {
+	condition := expression.Equal(expression.Name("status"), expression.Value(domain.OutboxStatusPending)).
+		And(expression.Equal(expression.Name("attempts"), expression.Value(event.Attempts)))
+
+	_, err := r.dynamo.UpdateItemWithBuilder(ctx, event.GetKey(), update, &condition, types.ReturnValueNone)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return ErrOutboxEventChanged
+	}
+	return err
+}
+
+// Republish hands a FAILED event back to the relay with a fresh set of attempts.
+// It keeps its place, so it is still published before the events held behind it.
+func (r *outboxRepository) Republish(ctx context.Context, id string) error {
+	update := expression.Set(expression.Name("status"), expression.Value(domain.OutboxStatusPending)).
+		Set(expression.Name("attempts"), expression.Value(0))
+	return r.resolveFailed(ctx, id, update)
+}
+
+// Dismiss gives up on a FAILED event for good, releasing the events held behind it.
+// It expires like published events.
+func (r *outboxRepository) Dismiss(ctx context.Context, id string) error {
+	update := expression.Set(expression.Name("status"), expression.Value(domain.OutboxStatusDismissed)).
+		Set(expression.Name("expiresAt"), expression.Value(time.Now().Add(domain.OutboxRetention).Unix()))
+	return r.resolveFailed(ctx, id, update)
+}
+
+func (r *outboxRepository) resolveFailed(ctx context.Context, id string, update expression.UpdateBuilder) error {
+	condition := expression.Equal(expression.Name("status"), expression.Value(domain.OutboxStatusFailed))
+
+	_, err := r.dynamo.UpdateItemWithBuilder(ctx, service.CreateStringKey(id), update, &condition, types.ReturnValueNone)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return ErrOutboxEventNotFailed
+	}
+	return err
+}
@@ -3,19 +3,46 @@ package repository
 import (
 	"context"
 	"log"
+	"strconv"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
 	"github.com/quochao170402/ecommerce-aws/product-service/service"
 )
 
+const ProductTableName string = "Products"
+
+// The price indexes find the products of a category or brand in a price range
+const (
+	productCategoryPriceIndex = "categoryId-price-index"
+	productBrandPriceIndex    = "brandId-price-index"
+)
+
 type ProductRepository interface {
 	BaseRepository[domain.Product]
+	Invalidator
 
 	FindByCategory(ctx context.Context, categoryId string) ([]domain.Product, error)
 	FindByBrand(ctx context.Context, brandId string) ([]domain.Product, error)
 	SearchByName(ctx context.Context, keyword string) ([]domain.Product, error)
+	FindByIDs(ctx context.Context, ids []string) ([]domain.Product, error)
+	FindByCategoryNearPrice(ctx context.Context, categoryId string, price, low, high float64, limit int) ([]domain.Product, error)
+	FindByBrandNearPrice(ctx context.Context, brandId string, price, low, high float64, limit int) ([]domain.Product, error)
+	FindByAttributes(ctx context.Context, categoryId string, filters []AttributeFilter) ([]domain.Product, error)
+	ScanPages(ctx context.Context, pageSize int32, fn func(page []domain.Product) error) error
+}
+
+// AttributeFilter matches products on one specification attribute. Equals is compared
+// as string, number and boolean since query strings carry no type; Min and Max are
+// inclusive numeric bounds.
+type AttributeFilter struct {
+	Key    string
+	Equals *string
+	Min    *float64
+	Max    *float64
 }
 
 type productRepository struct {
@@ -23,27 +50,83 @@ type productRepository struct {
 	dynamo *service.DynamoService[domain.Product]
 }
 
-func NewProductRepository(client *dynamodb.Client) ProductRepository {
-	const tableName string = "Products"
-	dynamoService := service.NewDynamoService[domain.Product](client, tableName)
+// NewProductRepository creates the product repository, decorators wrap the base
+// operations (e.g. WithCache) in the order given
+func NewProductRepository(client *dynamodb.Client, decorators ...func(BaseRepository[domain.Product]) BaseRepository[domain.Product]) ProductRepository {
+	dynamoService := service.NewDynamoService[domain.Product](client, ProductTableName)
 
 	exist, err := dynamoService.TableExists(context.Background())
 	if err != nil {
 		log.Fatalf("Error when process TableExists: %v", err)
 	}
 
+	attributes := []types.AttributeDefinition{
+		{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("categoryId"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("brandId"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("price"), AttributeType: types.ScalarAttributeTypeN},
+	}
+	// The related products job scores candidates on category, brand and price alone
+	indexes := []types.GlobalSecondaryIndex{
+		priceIndex(productCategoryPriceIndex, "categoryId", "brandId"),
+		priceIndex(productBrandPriceIndex, "brandId", "categoryId"),
+	}
+
 	if !exist {
-		if err := dynamoService.CreateTable(context.Background()); err != nil {
+		err := dynamoService.CreateTableWithDefinition(context.Background(), service.TableDefinition{
+			AttributeDefinitions: attributes,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			},
+			GlobalSecondaryIndexes: indexes,
+			BillingMode:            types.BillingModePayPerRequest,
+		})
+		if err != nil {
 			log.Fatalf("Error when creating Products table: %v", err)
 		}
+	} else {
+		// DynamoDB builds one new index at a time, the next start adds the other
+		for _, index := range indexes {
+			if err := dynamoService.EnsureGlobalSecondaryIndex(context.Background(), index, attributes); err != nil {
+				log.Printf("Products table index %s is not added yet: %v", aws.ToString(index.IndexName), err)
+			}
+		}
+	}
+
+	base := NewEventedRepository[domain.Product](client, ProductTableName, domain.AggregateProduct)
+	for _, decorate := range decorators {
+		base = decorate(base)
 	}
 
 	return &productRepository{
-		BaseRepository: NewBaseRepository[domain.Product](client, tableName),
+		BaseRepository: base,
 		dynamo:         dynamoService,
 	}
 }
 
+// priceIndex indexes products by key and price, projecting the other grouping attribute
+func priceIndex(name string, key string, other string) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(name),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(key), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("price"), KeyType: types.KeyTypeRange},
+		},
+		Projection: &types.Projection{
+			ProjectionType:   types.ProjectionTypeInclude,
+			NonKeyAttributes: []string{other},
+		},
+	}
+}
+
+// Invalidate implements ProductRepository, a no-op without a cache.
+func (p *productRepository) Invalidate(ctx context.Context, ids ...string) error {
+	if invalidator, ok := p.BaseRepository.(Invalidator); ok {
+		return invalidator.Invalidate(ctx, ids...)
+	}
+	return nil
+}
+
 // SearchByName implements ProductRepository.
 func (p *productRepository) SearchByName(ctx context.Context, keyword string) ([]domain.Product, error) {
 	filtEx := expression.Contains(expression.Name("name"), keyword)
@@ -97,3 +180,129 @@ func (p *productRepository) FindByCategory(ctx context.Context, categoryId strin
 	}
 	return p.dynamo.Scan(ctx, request)
 }
+
+// FindByIDs implements ProductRepository. Unknown ids are skipped.
+func (p *productRepository) FindByIDs(ctx context.Context, ids []string) ([]domain.Product, error) {
+	seen := make(map[string]bool, len(ids))
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		// BatchGetItem rejects duplicate keys
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		keys = append(keys, service.CreateStringKey(id))
+	}
+	return p.dynamo.BatchGetItems(ctx, keys)
+}
+
+// FindByCategoryNearPrice implements ProductRepository. It returns at most limit
+// products of the category priced from low to high, closest to price first, with
+// only their id, category, brand and price.
+func (p *productRepository) FindByCategoryNearPrice(ctx context.Context, categoryId string,
+	price, low, high float64, limit int) ([]domain.Product, error) {
+	return p.findNearPrice(ctx, productCategoryPriceIndex, "categoryId", categoryId, price, low, high, limit)
+}
+
+// FindByBrandNearPrice implements ProductRepository, like FindByCategoryNearPrice for a brand.
+func (p *productRepository) FindByBrandNearPrice(ctx context.Context, brandId string,
+	price, low, high float64, limit int) ([]domain.Product, error) {
+	return p.findNearPrice(ctx, productBrandPriceIndex, "brandId", brandId, price, low, high, limit)
+}
+
+// findNearPrice reads the index outwards from price, up to limit products each way,
+// and merges both sides by distance
+func (p *productRepository) findNearPrice(ctx context.Context, index string, key string, value string,
+	price, low, high float64, limit int) ([]domain.Product, error) {
+	above, err := p.queryPriced(ctx, index, key, value, price, high, false, limit)
+	if err != nil {
+		return nil, err
+	}
+	below, err := p.queryPriced(ctx, index, key, value, low, price, true, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]domain.Product, 0, limit)
+	seen := make(map[string]bool, limit)
+	for len(products) < limit && (len(above) > 0 || len(below) > 0) {
+		var next domain.Product
+		if len(below) == 0 || (len(above) > 0 && above[0].Price-price <= price-below[0].Price) {
+			next, above = above[0], above[1:]
+		} else {
+			next, below = below[0], below[1:]
+		}
+		// Products priced exactly at price are on both sides
+		if !seen[next.ID] {
+			seen[next.ID] = true
+			products = append(products, next)
+		}
+	}
+	return products, nil
+}
+
+func (p *productRepository) queryPriced(ctx context.Context, index string, key string, value string,
+	low, high float64, descending bool, limit int) ([]domain.Product, error) {
+	keyEx := expression.Key(key).Equal(expression.Value(value)).
+		And(expression.Key("price").Between(expression.Value(low), expression.Value(high)))
+	request := service.QueryRequest{IndexName: index, KeyBuilder: keyEx, Descending: descending}
+
+	var products []domain.Product
+	err := p.dynamo.QueryPages(ctx, request, int32(limit), func(page []domain.Product) bool {
+		products = append(products, page...)
+		return len(products) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products[:min(len(products), limit)], nil
+}
+
+// ScanPages implements ProductRepository.
+func (p *productRepository) ScanPages(ctx context.Context, pageSize int32, fn func(page []domain.Product) error) error {
+	return p.dynamo.ScanPages(ctx, service.ScanRequest{}, pageSize, fn)
+}
+
+// FindByAttributes implements ProductRepository.
+func (p *productRepository) FindByAttributes(ctx context.Context, categoryId string, filters []AttributeFilter) ([]domain.Product, error) {
+	var conditions []expression.ConditionBuilder
+
+	if categoryId != "" {
+		conditions = append(conditions, expression.Equal(expression.Name("categoryId"), expression.Value(categoryId)))
+	}
+
+	for _, filter := range filters {
+		// Name splits on dots, so attributes.<key> addresses the nested map entry
+		name := expression.Name("attributes." + filter.Key)
+
+		if filter.Equals != nil {
+			equals := expression.Equal(name, expression.Value(*filter.Equals))
+			if n, err := strconv.ParseFloat(*filter.Equals, 64); err == nil {
+				equals = equals.Or(expression.Equal(name, expression.Value(n)))
+			}
+			if b, err := strconv.ParseBool(*filter.Equals); err == nil {
+				equals = equals.Or(expression.Equal(name, expression.Value(b)))
+			}
+			conditions = append(conditions, equals)
+		}
+		if filter.Min != nil {
+			conditions = append(conditions, expression.GreaterThanEqual(name, expression.Value(*filter.Min)))
+		}
+		if filter.Max != nil {
+			conditions = append(conditions, expression.LessThanEqual(name, expression.Value(*filter.Max)))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return p.ScanItems(ctx)
+	}
+
+	filtEx := conditions[0]
+	if len(conditions) > 1 {
+		filtEx = expression.And(conditions[0], conditions[1], conditions[2:]...)
+	}
+
+	return p.dynamo.Scan(ctx, service.ScanRequest{
+		FilterBuilder: &filtEx,
+	})
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+type RelatedProductRepository interface {
+	BaseRepository[domain.RelatedProducts]
+
+	SetCurated(ctx context.Context, productId string, links []domain.RelatedLink) (*domain.RelatedProducts, error)
+	SetComputed(ctx context.Context, productId string, links []domain.RelatedLink) error
+	FindComputed(ctx context.Context, productIds []string) (map[string][]domain.RelatedLink, error)
+}
+
+type relatedProductRepository struct {
+	BaseRepository[domain.RelatedProducts]
+	dynamo *service.DynamoService[domain.RelatedProducts]
+}
+
+func NewRelatedProductRepository(client *dynamodb.Client) RelatedProductRepository {
+	const tableName string = "RelatedProducts"
+	dynamoService := service.NewDynamoService[domain.RelatedProducts](client, tableName)
+
+	exist, err := dynamoService.TableExists(context.Background())
+	if err != nil {
+		log.Fatalf("Error when process TableExists: %v", err)
+	}
+
+	if !exist {
+		if err := dynamoService.CreateTable(context.Background()); err != nil {
+			log.Fatalf("Error when creating RelatedProducts table: %v", err)
+		}
+	}
+
+	return &relatedProductRepository{
+		BaseRepository: NewBaseRepository[domain.RelatedProducts](client, tableName),
+		dynamo:         dynamoService,
+	}
+}
+
+// SetCurated replaces the curated links only, so it never races with the job
+func (r *relatedProductRepository) SetCurated(ctx context.Context, productId string, links []domain.RelatedLink) (*domain.RelatedProducts, error) {
+	update := expression.Set(expression.Name("curated"), expression.Value(links)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().Unix()))
+
+	return r.dynamo.UpdateItemWithBuilder(ctx, service.CreateStringKey(productId), update, nil, types.ReturnValueAllNew)
+}
+
+// SetComputed replaces the links produced by the similarity job
+func (r *relatedProductRepository) SetComputed(ctx context.Context, productId string, links []domain.RelatedLink) error {
+	now := time.Now().Unix()
+	update := expression.Set(expression.Name("computed"), expression.Value(links)).
+		Set(expression.Name("computedAt"), expression.Value(now)).
+		Set(expression.Name("updatedAt"), expression.Value(now))
+
+	_, err := r.dynamo.UpdateItemWithBuilder(ctx, service.CreateStringKey(productId), update, nil, types.ReturnValueNone)
+	return err
+}
+
+// FindComputed returns the computed links stored for the products, by product id.
+// Products without any are left out.
+func (r *relatedProductRepository) FindComputed(ctx context.Context, productIds []string) (map[string][]domain.RelatedLink, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(productIds))
+	for _, id := range productIds {
+		keys = append(keys, service.CreateStringKey(id))
+	}
+
+	sets, err := r.dynamo.BatchGetItems(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	computed := make(map[string][]domain.RelatedLink, len(sets))
+	for _, set := range sets {
+		computed[set.ID] = set.Computed
+	}
+	return computed, nil
+}
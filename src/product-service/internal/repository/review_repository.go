@@ -0,0 +1,418 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+var (
+	ErrReviewExists        = errors.New("user already reviewed this product")
+	ErrAlreadyVoted        = errors.New("user already voted on this review")
+	ErrReviewNotPublished  = errors.New("review is not published")
+	ErrConcurrentUpdate    = errors.New("entity was modified concurrently")
+	ErrStatusTransition    = errors.New("review status changed concurrently")
+	ErrReviewedProductGone = errors.New("reviewed product not found")
+)
+
+type ReviewRepository interface {
+	BaseRepository[domain.Review]
+
+	FindByProduct(ctx context.Context, productId string, status string) ([]domain.Review, error)
+	FindByUser(ctx context.Context, userId string) ([]domain.Review, error)
+	FindVotedBy(ctx context.Context, userId string) ([]domain.Review, error)
+	Create(ctx context.Context, review *domain.Review) error
+	ChangeStatus(ctx context.Context, review *domain.Review, status string) (*domain.Review, error)
+	Vote(ctx context.Context, reviewId string, userId string, helpful bool) (*domain.Review, error)
+	Anonymize(ctx context.Context, review *domain.Review, userId string) error
+}
+
+type reviewRepository struct {
+	BaseRepository[domain.Review]
+	dynamo   *service.DynamoService[domain.Review]
+	products *service.DynamoService[domain.Product]
+	outbox   *service.DynamoService[domain.OutboxEvent]
+}
+
+// Review indexes. Product pages query theirs by status, erasures query by author.
+const (
+	reviewProductIndex = "productId-status-index"
+	reviewUserIndex    = "userId-index"
+)
+
+func NewReviewRepository(client *dynamodb.Client) ReviewRepository {
+	const tableName string = "Reviews"
+	dynamoService := service.NewDynamoService[domain.Review](client, tableName)
+
+	exist, err := dynamoService.TableExists(context.Background())
+	if err != nil {
+		log.Fatalf("Error when process TableExists: %v", err)
+	}
+
+	attributes := []types.AttributeDefinition{
+		{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("productId"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+		{AttributeName: aws.String("userId"), AttributeType: types.ScalarAttributeTypeS},
+	}
+	// Anonymized reviews have no author, so the user index skips them
+	indexes := []types.GlobalSecondaryIndex{
+		{
+			IndexName: aws.String(reviewProductIndex),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("productId"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("status"), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		},
+		{
+			IndexName: aws.String(reviewUserIndex),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("userId"), KeyType: types.KeyTypeHash},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		},
+	}
+
+	if !exist {
+		err := dynamoService.CreateTableWithDefinition(context.Background(), service.TableDefinition{
+			AttributeDefinitions: attributes,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			},
+			GlobalSecondaryIndexes: indexes,
+			BillingMode:            types.BillingModePayPerRequest,
+		})
+		if err != nil {
+			log.Fatalf("Error when creating Reviews table: %v", err)
+		}
+	} else {
+		// DynamoDB builds one new index at a time, the next start adds the other
+		for _, index := range indexes {
+			if err := dynamoService.EnsureGlobalSecondaryIndex(context.Background(), index, attributes); err != nil {
+				log.Printf("Reviews table index %s is not added yet: %v", aws.ToString(index.IndexName), err)
+			}
+		}
+	}
+
+	return &reviewRepository{
+		BaseRepository: NewBaseRepository[domain.Review](client, tableName),
+		dynamo:         dynamoService,
+		products:       service.NewDynamoService[domain.Product](client, ProductTableName),
+		outbox:         newOutboxService(client),
+	}
+}
+
+// FindByProduct returns the reviews of a product, optionally restricted to one status
+func (r *reviewRepository) FindByProduct(ctx context.Context, productId string, status string) ([]domain.Review, error) {
+	key := expression.Key("productId").Equal(expression.Value(productId))
+	if status != "" {
+		key = key.And(expression.Key("status").Equal(expression.Value(status)))
+	}
+
+	return r.query(ctx, service.QueryRequest{IndexName: reviewProductIndex, KeyBuilder: key})
+}
+
+// FindByUser returns the reviews written by a user, whatever their status
+func (r *reviewRepository) FindByUser(ctx context.Context, userId string) ([]domain.Review, error) {
+	return r.query(ctx, service.QueryRequest{
+		IndexName:  reviewUserIndex,
+		KeyBuilder: expression.Key("userId").Equal(expression.Value(userId)),
+	})
+}
+
+// FindVotedBy returns the reviews a user voted on. Voters are a set no index can
+// key on, so this scans; it only runs for personal data exports and erasures.
+func (r *reviewRepository) FindVotedBy(ctx context.Context, userId string) ([]domain.Review, error) {
+	filtEx := expression.Contains(expression.Name("voters"), userId)
+
+	return r.dynamo.Scan(ctx, service.ScanRequest{
+		FilterBuilder: &filtEx,
+	})
+}
+
+// query returns every review matching request
+func (r *reviewRepository) query(ctx context.Context, request service.QueryRequest) ([]domain.Review, error) {
+	var reviews []domain.Review
+	err := r.dynamo.QueryPages(ctx, request, 100, func(page []domain.Review) bool {
+		reviews = append(reviews, page...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// Create stores a new review. The review id is derived from product and user so a
+// second review by the same user fails the existence condition.
+func (r *reviewRepository) Create(ctx context.Context, review *domain.Review) error {
+	now := time.Now().Unix()
+	review.SetCreatedAt(now)
+	review.SetUpdatedAt(now)
+	review.SetVersion(1)
+
+	if review.Status == domain.ReviewStatusApproved {
+		_, err := r.applyToProduct(ctx, review, func(product *domain.Product) (types.TransactWriteItem, error) {
+			item, err := attributevalue.MarshalMap(review)
+			if err != nil {
+				return types.TransactWriteItem{}, fmt.Errorf("failed to marshal review: %w", err)
+			}
+			product.ApplyRating(review.Rating, 1)
+			return types.TransactWriteItem{Put: &types.Put{
+				TableName:           aws.String(r.dynamo.TableName()),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			}}, nil
+		})
+		return err
+	}
+
+	err := r.dynamo.PutItemIfNotExists(ctx, *review)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return ErrReviewExists
+	}
+	return err
+}
+
+// ChangeStatus moves a review to a new moderation status and adjusts the product's
+// rating statistics in the same transaction when the review enters or leaves APPROVED.
+func (r *reviewRepository) ChangeStatus(ctx context.Context, review *domain.Review, status string) (*domain.Review, error) {
+	if review.Status == status {
+		return review, nil
+	}
+
+	delta := 0
+	if status == domain.ReviewStatusApproved {
+		delta = 1
+	} else if review.Status == domain.ReviewStatusApproved {
+		delta = -1
+	}
+
+	now := time.Now().Unix()
+	update := expression.Set(expression.Name("status"), expression.Value(status)).
+		Set(expression.Name("updatedAt"), expression.Value(now)).
+		Add(expression.Name("version"), expression.Value(1))
+	condition := expression.Equal(expression.Name("status"), expression.Value(review.Status))
+
+	if delta == 0 {
+		updated, err := r.dynamo.UpdateItemWithBuilder(ctx, review.GetKey(), update, &condition, types.ReturnValueAllNew)
+		var conditionalCheckEx *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckEx) {
+			return nil, ErrStatusTransition
+		}
+		return updated, err
+	}
+
+	_, err := r.applyToProduct(ctx, review, func(product *domain.Product) (types.TransactWriteItem, error) {
+		expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+		if err != nil {
+			return types.TransactWriteItem{}, fmt.Errorf("error when build update expression: %v", err)
+		}
+		product.ApplyRating(review.Rating, delta)
+		return types.TransactWriteItem{Update: &types.Update{
+			TableName:                 aws.String(r.dynamo.TableName()),
+			Key:                       review.GetKey(),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindByIDConsistent(ctx, review.ID)
+}
+
+// Vote records a helpful or unhelpful vote, each user may vote once per review.
+// Only APPROVED reviews take votes.
+func (r *reviewRepository) Vote(ctx context.Context, reviewId string, userId string, helpful bool) (*domain.Review, error) {
+	counter := "unhelpfulCount"
+	if helpful {
+		counter = "helpfulCount"
+	}
+
+	update := expression.Add(expression.Name(counter), expression.Value(1)).
+		Add(expression.Name("voters"), expression.Value(&types.AttributeValueMemberSS{Value: []string{userId}}))
+	condition := expression.Equal(expression.Name("status"), expression.Value(domain.ReviewStatusApproved)).
+		And(expression.Not(expression.Contains(expression.Name("voters"), userId)))
+
+	updated, err := r.dynamo.UpdateItemWithBuilder(ctx, service.CreateStringKey(reviewId), update, &condition, types.ReturnValueAllNew)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		// Either condition failed, the review tells which
+		current, err := r.FindByIDConsistent(ctx, reviewId)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || current.Status != domain.ReviewStatusApproved {
+			return nil, ErrReviewNotPublished
+		}
+		return nil, ErrAlreadyVoted
+	}
+	return updated, err
+}
+
+// Anonymize removes a user from a review. Their vote is forgotten on reviews of
+// others. Reviews they wrote are deleted unless APPROVED, the only ones product
+// ratings count. Approved reviews keep their rating, status, verified purchase flag,
+// vote counts and dates, so the statistics of the product do not change, but lose
+// their title and body and move to a random id: the id of a review is derived from
+// its author, see Create. Reviews deleted meanwhile are skipped.
+func (r *reviewRepository) Anonymize(ctx context.Context, review *domain.Review, userId string) error {
+	if review.UserID != userId {
+		return r.forgetVote(ctx, review, userId)
+	}
+
+	// The copy below is only right while the review is as read
+	condition, err := expression.NewBuilder().
+		WithCondition(expression.Equal(expression.Name("version"), expression.Value(review.Version))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error when build condition expression: %v", err)
+	}
+
+	writes := []types.TransactWriteItem{{Delete: &types.Delete{
+		TableName:                 aws.String(r.dynamo.TableName()),
+		Key:                       review.GetKey(),
+		ConditionExpression:       condition.Condition(),
+		ExpressionAttributeNames:  condition.Names(),
+		ExpressionAttributeValues: condition.Values(),
+	}}}
+
+	if review.Status == domain.ReviewStatusApproved {
+		anonymized := *review
+		anonymized.ID = uuid.NewString()
+		anonymized.UserID = ""
+		anonymized.Title = ""
+		anonymized.Body = ""
+		anonymized.Voters = slices.DeleteFunc(slices.Clone(review.Voters), func(voter string) bool { return voter == userId })
+		anonymized.SetUpdatedAt(time.Now().Unix())
+		anonymized.IncrementVersion()
+
+		item, err := attributevalue.MarshalMap(anonymized)
+		if err != nil {
+			return fmt.Errorf("failed to marshal review: %w", err)
+		}
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(r.dynamo.TableName()),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		}})
+	}
+
+	err = r.dynamo.TransactWriteItems(ctx, writes)
+	var canceledEx *types.TransactionCanceledException
+	if errors.As(err, &canceledEx) {
+		return ErrConcurrentUpdate
+	}
+	return err
+}
+
+// forgetVote removes a user from the voters of a review. The vote counts stay.
+func (r *reviewRepository) forgetVote(ctx context.Context, review *domain.Review, userId string) error {
+	update := expression.Delete(expression.Name("voters"), expression.Value(&types.AttributeValueMemberSS{Value: []string{userId}})).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().Unix())).
+		Add(expression.Name("version"), expression.Value(1))
+	condition := expression.AttributeExists(expression.Name("id"))
+
+	_, err := r.dynamo.UpdateItemWithBuilder(ctx, review.GetKey(), update, &condition, types.ReturnValueNone)
+	var conditionalCheckEx *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckEx) {
+		return nil
+	}
+	return err
+}
+
+// applyToProduct runs a review write and the product statistics update in one
+// transaction, guarded by the product version. Conflicting writers are retried.
+func (r *reviewRepository) applyToProduct(ctx context.Context, review *domain.Review,
+	reviewWrite func(product *domain.Product) (types.TransactWriteItem, error)) (*domain.Product, error) {
+
+	for attempt := 0; attempt < service.MaxRetryAttempts; attempt++ {
+		product, err := r.products.GetItemConsistent(ctx, service.CreateStringKey(review.ProductID))
+		if err != nil {
+			return nil, err
+		}
+		if product == nil {
+			return nil, ErrReviewedProductGone
+		}
+
+		version := product.Version
+		write, err := reviewWrite(product)
+		if err != nil {
+			return nil, err
+		}
+
+		product.Version = version + 1
+		product.UpdatedAt = time.Now().Unix()
+
+		update := expression.Set(expression.Name("averageRating"), expression.Value(product.AverageRating)).
+			Set(expression.Name("reviewCount"), expression.Value(product.ReviewCount)).
+			Set(expression.Name("ratingHistogram"), expression.Value(product.RatingHistogram)).
+			Set(expression.Name("version"), expression.Value(product.Version)).
+			Set(expression.Name("updatedAt"), expression.Value(product.UpdatedAt))
+		condition := expression.Equal(expression.Name("version"), expression.Value(version))
+
+		expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+		if err != nil {
+			return nil, fmt.Errorf("error when build update expression: %v", err)
+		}
+
+		event, err := domain.NewOutboxEvent(domain.AggregateProduct, product.ID, domain.ActionUpdated, product)
+		if err != nil {
+			return nil, err
+		}
+		eventPut, err := r.outbox.PutTransactItem(event)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.dynamo.TransactWriteItems(ctx, []types.TransactWriteItem{
+			write,
+			{Update: &types.Update{
+				TableName:                 aws.String(r.products.TableName()),
+				Key:                       product.GetKey(),
+				UpdateExpression:          expr.Update(),
+				ConditionExpression:       expr.Condition(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+			}},
+			eventPut,
+		})
+		if err == nil {
+			return product, nil
+		}
+
+		var canceledEx *types.TransactionCanceledException
+		if !errors.As(err, &canceledEx) {
+			return nil, err
+		}
+
+		// The first cancellation reason belongs to the review write, the second to the product
+		reasons := canceledEx.CancellationReasons
+		if len(reasons) > 0 && aws.ToString(reasons[0].Code) == "ConditionalCheckFailed" {
+			if write.Put != nil {
+				return nil, ErrReviewExists
+			}
+			return nil, ErrStatusTransition
+		}
+	}
+
+	return nil, ErrConcurrentUpdate
+}
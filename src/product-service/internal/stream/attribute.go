@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"fmt"
+
+	dynamotypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// toDynamoItem converts a stream image into the dynamodb attribute types so the
+// regular attributevalue decoder used by DynamoService can unmarshal it
+func toDynamoItem(image map[string]streamtypes.AttributeValue) (map[string]dynamotypes.AttributeValue, error) {
+	item := make(map[string]dynamotypes.AttributeValue, len(image))
+	for name, value := range image {
+		converted, err := toDynamoAttribute(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = converted
+	}
+	return item, nil
+}
+
+func toDynamoAttribute(value streamtypes.AttributeValue) (dynamotypes.AttributeValue, error) {
+	switch v := value.(type) {
+	case *streamtypes.AttributeValueMemberS:
+		return &dynamotypes.AttributeValueMemberS{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberN:
+		return &dynamotypes.AttributeValueMemberN{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberB:
+		return &dynamotypes.AttributeValueMemberB{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberBOOL:
+		return &dynamotypes.AttributeValueMemberBOOL{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberNULL:
+		return &dynamotypes.AttributeValueMemberNULL{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberSS:
+		return &dynamotypes.AttributeValueMemberSS{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberNS:
+		return &dynamotypes.AttributeValueMemberNS{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberBS:
+		return &dynamotypes.AttributeValueMemberBS{Value: v.Value}, nil
+	case *streamtypes.AttributeValueMemberL:
+		list := make([]dynamotypes.AttributeValue, 0, len(v.Value))
+		for _, element := range v.Value {
+			converted, err := toDynamoAttribute(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, converted)
+		}
+		return &dynamotypes.AttributeValueMemberL{Value: list}, nil
+	case *streamtypes.AttributeValueMemberM:
+		m, err := toDynamoItem(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamotypes.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute value type %T", value)
+	}
+}
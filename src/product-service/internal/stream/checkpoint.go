@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+)
+
+// CheckpointStore persists the last processed sequence number per shard
+type CheckpointStore interface {
+	Get(ctx context.Context, consumer string, shardId string) (*domain.StreamCheckpoint, error)
+	Save(ctx context.Context, checkpoint domain.StreamCheckpoint) error
+}
+
+type repositoryCheckpointStore struct {
+	repo repository.BaseRepository[domain.StreamCheckpoint]
+}
+
+// NewCheckpointStore stores checkpoints through the given repository
+func NewCheckpointStore(repo repository.BaseRepository[domain.StreamCheckpoint]) CheckpointStore {
+	return &repositoryCheckpointStore{repo: repo}
+}
+
+func (s *repositoryCheckpointStore) Get(ctx context.Context, consumer string, shardId string) (*domain.StreamCheckpoint, error) {
+	return s.repo.FindByIDConsistent(ctx, checkpointID(consumer, shardId))
+}
+
+func (s *repositoryCheckpointStore) Save(ctx context.Context, checkpoint domain.StreamCheckpoint) error {
+	checkpoint.ID = checkpointID(checkpoint.Consumer, checkpoint.ShardID)
+	checkpoint.UpdatedAt = time.Now().Unix()
+	return s.repo.Save(ctx, &checkpoint)
+}
+
+type localCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]domain.StreamCheckpoint
+}
+
+// NewLocalCheckpointStore keeps checkpoints in memory, for consumers that only care
+// about changes made while the process runs
+func NewLocalCheckpointStore() CheckpointStore {
+	return &localCheckpointStore{checkpoints: make(map[string]domain.StreamCheckpoint)}
+}
+
+func (s *localCheckpointStore) Get(_ context.Context, consumer string, shardId string) (*domain.StreamCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[checkpointID(consumer, shardId)]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *localCheckpointStore) Save(_ context.Context, checkpoint domain.StreamCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint.ID = checkpointID(checkpoint.Consumer, checkpoint.ShardID)
+	checkpoint.UpdatedAt = time.Now().Unix()
+	s.checkpoints[checkpoint.ID] = checkpoint
+	return nil
+}
+
+func checkpointID(consumer string, shardId string) string {
+	return consumer + "#" + shardId
+}
@@ -0,0 +1,439 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+// Stream event names
+const (
+	EventInsert = "INSERT"
+	EventModify = "MODIFY"
+	EventRemove = "REMOVE"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultMaxAttempts  = 5
+	defaultBaseBackoff  = 200 * time.Millisecond
+	getRecordsLimit     = 1000
+
+	// shardLeaseTTL is how long an instance keeps a shard without renewing its lease
+	shardLeaseTTL = 30 * time.Second
+)
+
+// Change is one decoded stream record. NewImage is nil for removals and OldImage
+// is nil for inserts.
+type Change[T any] struct {
+	EventName      string
+	SequenceNumber string
+	CreatedAt      time.Time
+	Keys           map[string]string
+	NewImage       *T
+	OldImage       *T
+}
+
+// Handler reacts to a change. Returning an error retries the change with backoff
+// and eventually sends it to the dead-letter sink.
+type Handler[T any] func(ctx context.Context, change Change[T]) error
+
+type namedHandler[T any] struct {
+	name    string
+	handler Handler[T]
+}
+
+// StreamsClient is the part of the DynamoDB Streams API a consumer reads with;
+// *dynamodbstreams.Client implements it
+type StreamsClient interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// Runner is the type-independent view of a consumer used to start them together
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Consumer reads every shard of one table stream in order, decodes the images into
+// T and dispatches them to the registered handlers. Shards are processed parents
+// first so changes to the same item are delivered in order.
+type Consumer[T any] struct {
+	name         string
+	streamArn    string
+	client       StreamsClient
+	checkpoints  CheckpointStore
+	deadLetters  DeadLetterSink
+	handlers     []namedHandler[T]
+	pollInterval time.Duration
+	maxAttempts  int
+	baseBackoff  time.Duration
+	leases       repository.LeaseRepository
+	owner        string
+}
+
+// NewConsumer creates a consumer; name identifies its checkpoints, so two consumers
+// of the same stream with different names each see every change
+func NewConsumer[T any](name string, streamArn string, client StreamsClient,
+	checkpoints CheckpointStore, deadLetters DeadLetterSink) *Consumer[T] {
+	return &Consumer[T]{
+		name:         name,
+		streamArn:    streamArn,
+		client:       client,
+		checkpoints:  checkpoints,
+		deadLetters:  deadLetters,
+		pollInterval: defaultPollInterval,
+		maxAttempts:  defaultMaxAttempts,
+		baseBackoff:  defaultBaseBackoff,
+	}
+}
+
+// Handle registers a handler under a name used in dead letters
+func (c *Consumer[T]) Handle(name string, handler Handler[T]) *Consumer[T] {
+	c.handlers = append(c.handlers, namedHandler[T]{name: name, handler: handler})
+	return c
+}
+
+// WithRetry overrides how often and how patiently failing handlers are retried
+func (c *Consumer[T]) WithRetry(maxAttempts int, baseBackoff time.Duration) *Consumer[T] {
+	c.maxAttempts = maxAttempts
+	c.baseBackoff = baseBackoff
+	return c
+}
+
+// WithPollInterval overrides the wait between polls of an idle stream
+func (c *Consumer[T]) WithPollInterval(interval time.Duration) *Consumer[T] {
+	c.pollInterval = interval
+	return c
+}
+
+// WithShardLeases lets consumers of the same name on several instances share the
+// stream: each shard is read by the instance holding its lease, the others skip it.
+// The lease is renewed before every checkpoint, a consumer that lost it stops
+// reading the shard, so an instance never moves a checkpoint another one owns.
+func (c *Consumer[T]) WithShardLeases(leases repository.LeaseRepository, owner string) *Consumer[T] {
+	c.leases = leases
+	c.owner = owner
+	return c
+}
+
+// Run polls the stream until ctx is cancelled
+func (c *Consumer[T]) Run(ctx context.Context) error {
+	for {
+		if err := c.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Stream consumer %s failed: %v", c.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// Poll processes everything currently readable from the stream once
+func (c *Consumer[T]) Poll(ctx context.Context) error {
+	shards, err := c.listShards(ctx)
+	if err != nil {
+		return err
+	}
+
+	finished := make(map[string]bool, len(shards))
+	present := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		present[aws.ToString(shard.ShardId)] = true
+	}
+
+	// Shards are listed oldest first; a child waits until its parent is finished,
+	// parents that aged out of the stream no longer block it
+	pending := shards
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		var waiting []streamtypes.Shard
+
+		for _, shard := range pending {
+			parent := aws.ToString(shard.ParentShardId)
+			if parent != "" && present[parent] && !finished[parent] {
+				waiting = append(waiting, shard)
+				continue
+			}
+
+			done, err := c.processShard(ctx, shard)
+			if err != nil {
+				return err
+			}
+			finished[aws.ToString(shard.ShardId)] = done
+			progress = true
+		}
+
+		pending = waiting
+	}
+
+	return nil
+}
+
+func (c *Consumer[T]) listShards(ctx context.Context) ([]streamtypes.Shard, error) {
+	var shards []streamtypes.Shard
+	var startShardId *string
+
+	for {
+		output, err := c.client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(c.streamArn),
+			ExclusiveStartShardId: startShardId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe stream %s: %w", c.streamArn, err)
+		}
+
+		shards = append(shards, output.StreamDescription.Shards...)
+		startShardId = output.StreamDescription.LastEvaluatedShardId
+		if startShardId == nil {
+			return shards, nil
+		}
+	}
+}
+
+// processShard reads the shard from its checkpoint until it is drained, reporting
+// whether the shard is closed and fully processed
+func (c *Consumer[T]) processShard(ctx context.Context, shard streamtypes.Shard) (bool, error) {
+	shardId := aws.ToString(shard.ShardId)
+
+	checkpoint, err := c.checkpoints.Get(ctx, c.name, shardId)
+	if err != nil {
+		return false, fmt.Errorf("failed to load checkpoint of shard %s: %w", shardId, err)
+	}
+	if checkpoint != nil && checkpoint.Finished {
+		return true, nil
+	}
+
+	held, err := c.holdShard(ctx, shardId)
+	if err != nil || !held {
+		return false, err
+	}
+
+	// The checkpoint may have moved before the lease was ours
+	if c.leases != nil {
+		checkpoint, err = c.checkpoints.Get(ctx, c.name, shardId)
+		if err != nil {
+			return false, fmt.Errorf("failed to load checkpoint of shard %s: %w", shardId, err)
+		}
+		if checkpoint != nil && checkpoint.Finished {
+			return true, nil
+		}
+	}
+
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn: aws.String(c.streamArn),
+		ShardId:   shard.ShardId,
+	}
+	if checkpoint != nil && checkpoint.SequenceNumber != "" {
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(checkpoint.SequenceNumber)
+	} else {
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+	}
+
+	iterator, err := c.client.GetShardIterator(ctx, input)
+	if err != nil {
+		var trimmedEx *streamtypes.TrimmedDataAccessException
+		if errors.As(err, &trimmedEx) {
+			// The checkpoint points at data past the retention window, restart at the oldest record
+			input.ShardIteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+			input.SequenceNumber = nil
+			iterator, err = c.client.GetShardIterator(ctx, input)
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get iterator of shard %s: %w", shardId, err)
+		}
+	}
+
+	current := domain.StreamCheckpoint{Consumer: c.name, StreamArn: c.streamArn, ShardID: shardId}
+	if checkpoint != nil {
+		current.SequenceNumber = checkpoint.SequenceNumber
+	}
+
+	next := iterator.ShardIterator
+	for next != nil {
+		output, err := c.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: next,
+			Limit:         aws.Int32(getRecordsLimit),
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to read shard %s: %w", shardId, err)
+		}
+
+		for _, record := range output.Records {
+			if err := c.dispatch(ctx, shardId, record); err != nil {
+				return false, err
+			}
+			current.SequenceNumber = aws.ToString(record.Dynamodb.SequenceNumber)
+		}
+
+		next = output.NextShardIterator
+		if len(output.Records) > 0 || next == nil {
+			// Another instance took the shard over, it redelivers what was not checkpointed
+			if held, err := c.holdShard(ctx, shardId); err != nil || !held {
+				return false, err
+			}
+
+			current.Finished = next == nil
+			if err := c.checkpoints.Save(ctx, current); err != nil {
+				return false, fmt.Errorf("failed to save checkpoint of shard %s: %w", shardId, err)
+			}
+		}
+
+		// An open shard without new records is drained for now
+		if len(output.Records) == 0 {
+			break
+		}
+	}
+
+	return next == nil, nil
+}
+
+// holdShard takes or renews the lease of the shard, always succeeding without leases
+func (c *Consumer[T]) holdShard(ctx context.Context, shardId string) (bool, error) {
+	if c.leases == nil {
+		return true, nil
+	}
+
+	held, err := c.leases.Acquire(ctx, "stream#"+checkpointID(c.name, shardId), c.owner, shardLeaseTTL)
+	if err != nil {
+		return false, fmt.Errorf("failed to lease shard %s: %w", shardId, err)
+	}
+	return held, nil
+}
+
+// dispatch hands a record to every handler. Handler failures are retried and then
+// dead-lettered; only a failing dead-letter sink stops the shard.
+func (c *Consumer[T]) dispatch(ctx context.Context, shardId string, record streamtypes.Record) error {
+	change, err := decodeChange[T](record)
+	if err != nil {
+		return c.deadLetter(ctx, shardId, record, "decode", err, 1)
+	}
+
+	for _, h := range c.handlers {
+		var lastErr error
+		attempt := 0
+		for attempt < c.maxAttempts {
+			attempt++
+			if lastErr = h.handler(ctx, change); lastErr == nil {
+				break
+			}
+
+			if attempt < c.maxAttempts {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(c.baseBackoff * time.Duration(1<<(attempt-1))):
+				}
+			}
+		}
+
+		if lastErr != nil {
+			if err := c.deadLetter(ctx, shardId, record, h.name, lastErr, attempt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer[T]) deadLetter(ctx context.Context, shardId string, record streamtypes.Record,
+	handler string, cause error, attempts int) error {
+
+	keys, _ := json.Marshal(decodeKeys(record.Dynamodb.Keys))
+
+	err := c.deadLetters.Put(ctx, domain.StreamDeadLetter{
+		Consumer:       c.name,
+		Handler:        handler,
+		StreamArn:      c.streamArn,
+		ShardID:        shardId,
+		SequenceNumber: aws.ToString(record.Dynamodb.SequenceNumber),
+		EventName:      string(record.EventName),
+		Keys:           string(keys),
+		Error:          cause.Error(),
+		Attempts:       attempts,
+		CreatedAt:      time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter record %s: %w", aws.ToString(record.Dynamodb.SequenceNumber), err)
+	}
+	return nil
+}
+
+func decodeChange[T any](record streamtypes.Record) (Change[T], error) {
+	change := Change[T]{
+		EventName:      string(record.EventName),
+		SequenceNumber: aws.ToString(record.Dynamodb.SequenceNumber),
+		CreatedAt:      aws.ToTime(record.Dynamodb.ApproximateCreationDateTime),
+		Keys:           decodeKeys(record.Dynamodb.Keys),
+	}
+
+	var err error
+	if change.NewImage, err = decodeImage[T](record.Dynamodb.NewImage); err != nil {
+		return change, fmt.Errorf("failed to decode new image: %w", err)
+	}
+	if change.OldImage, err = decodeImage[T](record.Dynamodb.OldImage); err != nil {
+		return change, fmt.Errorf("failed to decode old image: %w", err)
+	}
+	return change, nil
+}
+
+func decodeImage[T any](image map[string]streamtypes.AttributeValue) (*T, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+
+	item, err := toDynamoItem(image)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded T
+	if err := attributevalue.UnmarshalMap(item, &decoded); err != nil {
+		return nil, err
+	}
+	return &decoded, nil
+}
+
+func decodeKeys(keys map[string]streamtypes.AttributeValue) map[string]string {
+	decoded := make(map[string]string, len(keys))
+	for name, value := range keys {
+		switch v := value.(type) {
+		case *streamtypes.AttributeValueMemberS:
+			decoded[name] = v.Value
+		case *streamtypes.AttributeValueMemberN:
+			decoded[name] = v.Value
+		default:
+			decoded[name] = fmt.Sprintf("%v", v)
+		}
+	}
+	return decoded
+}
+
+// NewTableConsumer enables the stream of table if needed and creates a consumer for it
+func NewTableConsumer[T any](ctx context.Context, name string, table *service.DynamoService[T],
+	client StreamsClient, checkpoints CheckpointStore, deadLetters DeadLetterSink) (*Consumer[T], error) {
+
+	streamArn, err := table.EnsureStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConsumer[T](name, streamArn, client, checkpoints, deadLetters), nil
+}
@@ -0,0 +1,173 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/product-service/service"
+)
+
+// The tests below run against DynamoDB Local, so shard iteration, resuming and
+// checkpoints go through the real Streams API. They are skipped unless
+// DYNAMODB_LOCAL_ENDPOINT is set, e.g. to http://localhost:8000 after
+// `docker compose up dynamodb-local`.
+
+// localTables creates a table with a stream and a checkpoint table on DynamoDB
+// Local, both dropped when the test ends
+type localTables struct {
+	items       *service.DynamoService[testItem]
+	consumer    func(name string) *Consumer[testItem]
+	checkpoints CheckpointStore
+	deadLetters *memoryDeadLetterSink
+}
+
+func newLocalTables(t *testing.T) *localTables {
+	t.Helper()
+
+	endpoint := os.Getenv("DYNAMODB_LOCAL_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_LOCAL_ENDPOINT not set")
+	}
+
+	cfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) { o.BaseEndpoint = aws.String(endpoint) })
+	streamsClient := dynamodbstreams.NewFromConfig(cfg, func(o *dynamodbstreams.Options) { o.BaseEndpoint = aws.String(endpoint) })
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	items := service.NewDynamoService[testItem](client, fmt.Sprintf("StreamTestItems%d", suffix))
+	if err := items.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	t.Cleanup(func() { _ = items.DeleteTable(context.Background()) })
+
+	checkpointTable := fmt.Sprintf("StreamTestCheckpoints%d", suffix)
+	checkpoints := NewCheckpointStore(repository.NewBaseRepository[domain.StreamCheckpoint](client, checkpointTable))
+	t.Cleanup(func() {
+		_ = service.NewDynamoService[domain.StreamCheckpoint](client, checkpointTable).DeleteTable(context.Background())
+	})
+
+	tables := &localTables{items: items, checkpoints: checkpoints, deadLetters: &memoryDeadLetterSink{}}
+	tables.consumer = func(name string) *Consumer[testItem] {
+		consumer, err := NewTableConsumer(ctx, name, items, streamsClient, checkpoints, tables.deadLetters)
+		if err != nil {
+			t.Fatalf("NewTableConsumer: %v", err)
+		}
+		return consumer.WithRetry(2, time.Millisecond)
+	}
+	return tables
+}
+
+func (l *localTables) put(t *testing.T, item testItem) {
+	t.Helper()
+	if err := l.items.PutItem(context.Background(), item); err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+}
+
+// collect polls consumer once and returns the event name and id of every change
+func collect(t *testing.T, consumer *Consumer[testItem]) []string {
+	t.Helper()
+
+	var changes []string
+	consumer.Handle("collect", func(_ context.Context, change Change[testItem]) error {
+		changes = append(changes, change.EventName+" "+change.Keys["id"])
+		return nil
+	})
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	return changes
+}
+
+func TestLocalConsumerReadsFromTrimHorizonAndResumesAfterCheckpoint(t *testing.T) {
+	tables := newLocalTables(t)
+	ctx := context.Background()
+
+	// Enable the stream before writing, records made before it are not streamed
+	first := tables.consumer("local")
+
+	tables.put(t, testItem{ID: "p1", Price: 10})
+	tables.put(t, testItem{ID: "p2", Price: 20})
+	tables.put(t, testItem{ID: "p1", Price: 12})
+	if err := tables.items.DeleteItem(ctx, service.CreateStringKey("p2")); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+
+	want := []string{"INSERT p1", "INSERT p2", "MODIFY p1", "REMOVE p2"}
+	if got := collect(t, first); !slices.Equal(got, want) {
+		t.Fatalf("got changes %v, want %v", got, want)
+	}
+
+	shards, err := first.listShards(ctx)
+	if err != nil {
+		t.Fatalf("listShards: %v", err)
+	}
+	checkpoint, err := tables.checkpoints.Get(ctx, "local", aws.ToString(shards[len(shards)-1].ShardId))
+	if err != nil {
+		t.Fatalf("Get checkpoint: %v", err)
+	}
+	if checkpoint == nil || checkpoint.SequenceNumber == "" || checkpoint.Finished {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	tables.put(t, testItem{ID: "p3", Price: 30})
+
+	// A restarted consumer picks up after its stored checkpoint
+	if got := collect(t, tables.consumer("local")); !slices.Equal(got, []string{"INSERT p3"}) {
+		t.Fatalf("resumed consumer got %v, want only the new change", got)
+	}
+
+	// A consumer under another name has its own checkpoints and starts at the oldest record
+	want = append(want, "INSERT p3")
+	if got := collect(t, tables.consumer("other")); !slices.Equal(got, want) {
+		t.Fatalf("other consumer got %v, want %v", got, want)
+	}
+}
+
+func TestLocalConsumerDeadLettersAndMovesOn(t *testing.T) {
+	tables := newLocalTables(t)
+	consumer := tables.consumer("local")
+
+	tables.put(t, testItem{ID: "p1", Price: 10})
+	tables.put(t, testItem{ID: "p2", Price: 20})
+
+	consumer.Handle("failing", func(_ context.Context, change Change[testItem]) error {
+		if change.Keys["id"] == "p1" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if got := collect(t, consumer); !slices.Equal(got, []string{"INSERT p1", "INSERT p2"}) {
+		t.Fatalf("got changes %v", got)
+	}
+
+	if len(tables.deadLetters.letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(tables.deadLetters.letters))
+	}
+	letter := tables.deadLetters.letters[0]
+	if letter.Handler != "failing" || letter.Attempts != 2 || letter.SequenceNumber == "" {
+		t.Fatalf("unexpected dead letter %+v", letter)
+	}
+
+	// The shard moved past the failed record, nothing is delivered again
+	if got := collect(t, tables.consumer("local")); len(got) != 0 {
+		t.Fatalf("restarted consumer got %v, want nothing", got)
+	}
+}
@@ -0,0 +1,416 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+)
+
+const testStreamArn = "arn:aws:dynamodb:local:000000000000:table/Products/stream/test"
+
+// fakeShard is one shard of a fakeStream; a closed shard ends once its records are read
+type fakeShard struct {
+	id      string
+	parent  string
+	records []streamtypes.Record
+	closed  bool
+}
+
+// fakeStream serves shards from memory. Iterators are "<shardId>#<position>".
+type fakeStream struct {
+	shards    []*fakeShard
+	iterators []streamtypes.ShardIteratorType
+}
+
+func (s *fakeStream) shard(id string) *fakeShard {
+	for _, shard := range s.shards {
+		if shard.id == id {
+			return shard
+		}
+	}
+	return nil
+}
+
+func (s *fakeStream) DescribeStream(_ context.Context, _ *dynamodbstreams.DescribeStreamInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	description := &streamtypes.StreamDescription{}
+	for _, shard := range s.shards {
+		description.Shards = append(description.Shards, streamtypes.Shard{
+			ShardId:       aws.String(shard.id),
+			ParentShardId: aws.String(shard.parent),
+		})
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: description}, nil
+}
+
+func (s *fakeStream) GetShardIterator(_ context.Context, input *dynamodbstreams.GetShardIteratorInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	shard := s.shard(aws.ToString(input.ShardId))
+	s.iterators = append(s.iterators, input.ShardIteratorType)
+
+	position := 0
+	switch input.ShardIteratorType {
+	case streamtypes.ShardIteratorTypeLatest:
+		position = len(shard.records)
+	case streamtypes.ShardIteratorTypeAfterSequenceNumber:
+		position = slices.IndexFunc(shard.records, func(record streamtypes.Record) bool {
+			return aws.ToString(record.Dynamodb.SequenceNumber) == aws.ToString(input.SequenceNumber)
+		}) + 1
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(fmt.Sprintf("%s#%d", shard.id, position))}, nil
+}
+
+func (s *fakeStream) GetRecords(_ context.Context, input *dynamodbstreams.GetRecordsInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	id, position, _ := strings.Cut(aws.ToString(input.ShardIterator), "#")
+	shard := s.shard(id)
+	from, _ := strconv.Atoi(position)
+
+	output := &dynamodbstreams.GetRecordsOutput{Records: shard.records[from:]}
+	if !shard.closed || from < len(shard.records) {
+		output.NextShardIterator = aws.String(fmt.Sprintf("%s#%d", id, len(shard.records)))
+	}
+	return output, nil
+}
+
+type memoryCheckpointStore struct {
+	checkpoints map[string]domain.StreamCheckpoint
+}
+
+func (s *memoryCheckpointStore) Get(_ context.Context, consumer string, shardId string) (*domain.StreamCheckpoint, error) {
+	checkpoint, ok := s.checkpoints[checkpointID(consumer, shardId)]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) Save(_ context.Context, checkpoint domain.StreamCheckpoint) error {
+	s.checkpoints[checkpointID(checkpoint.Consumer, checkpoint.ShardID)] = checkpoint
+	return nil
+}
+
+// memoryLeases grants each lease to the first owner asking, until it is released
+type memoryLeases struct {
+	owners map[string]string
+}
+
+func (l *memoryLeases) Acquire(_ context.Context, job string, owner string, _ time.Duration) (bool, error) {
+	if current, ok := l.owners[job]; ok && current != owner {
+		return false, nil
+	}
+	l.owners[job] = owner
+	return true, nil
+}
+
+type memoryDeadLetterSink struct {
+	letters []domain.StreamDeadLetter
+	err     error
+}
+
+func (s *memoryDeadLetterSink) Put(_ context.Context, letter domain.StreamDeadLetter) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+// testItem stands in for a table entity
+type testItem struct {
+	ID    string            `dynamodbav:"id"`
+	Price float64           `dynamodbav:"price"`
+	Tags  []string          `dynamodbav:"tags"`
+	Attrs map[string]string `dynamodbav:"attrs"`
+}
+
+func record(sequenceNumber string, eventName streamtypes.OperationType, id string,
+	newImage map[string]streamtypes.AttributeValue, oldImage map[string]streamtypes.AttributeValue) streamtypes.Record {
+	return streamtypes.Record{
+		EventName: eventName,
+		Dynamodb: &streamtypes.StreamRecord{
+			SequenceNumber: aws.String(sequenceNumber),
+			Keys:           map[string]streamtypes.AttributeValue{"id": &streamtypes.AttributeValueMemberS{Value: id}},
+			NewImage:       newImage,
+			OldImage:       oldImage,
+		},
+	}
+}
+
+func image(id string, price string) map[string]streamtypes.AttributeValue {
+	return map[string]streamtypes.AttributeValue{
+		"id":    &streamtypes.AttributeValueMemberS{Value: id},
+		"price": &streamtypes.AttributeValueMemberN{Value: price},
+		"tags": &streamtypes.AttributeValueMemberL{Value: []streamtypes.AttributeValue{
+			&streamtypes.AttributeValueMemberS{Value: "new"},
+		}},
+		"attrs": &streamtypes.AttributeValueMemberM{Value: map[string]streamtypes.AttributeValue{
+			"color": &streamtypes.AttributeValueMemberS{Value: "red"},
+		}},
+	}
+}
+
+func newTestConsumer(stream *fakeStream) (*Consumer[testItem], *memoryCheckpointStore, *memoryDeadLetterSink) {
+	checkpoints := &memoryCheckpointStore{checkpoints: map[string]domain.StreamCheckpoint{}}
+	deadLetters := &memoryDeadLetterSink{}
+	consumer := NewConsumer[testItem]("test", testStreamArn, stream, checkpoints, deadLetters).
+		WithRetry(3, time.Millisecond)
+	return consumer, checkpoints, deadLetters
+}
+
+func TestConsumerDecodesImages(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "10.5"), nil),
+		record("2", streamtypes.OperationTypeModify, "p1", image("p1", "12"), image("p1", "10.5")),
+		record("3", streamtypes.OperationTypeRemove, "p1", nil, image("p1", "12")),
+	}}}}
+	consumer, _, _ := newTestConsumer(stream)
+
+	var changes []Change[testItem]
+	consumer.Handle("collect", func(_ context.Context, change Change[testItem]) error {
+		changes = append(changes, change)
+		return nil
+	})
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3", len(changes))
+	}
+
+	insert := changes[0]
+	want := testItem{ID: "p1", Price: 10.5, Tags: []string{"new"}, Attrs: map[string]string{"color": "red"}}
+	if insert.EventName != EventInsert || insert.OldImage != nil || insert.NewImage == nil ||
+		insert.NewImage.ID != want.ID || insert.NewImage.Price != want.Price ||
+		!slices.Equal(insert.NewImage.Tags, want.Tags) || insert.NewImage.Attrs["color"] != "red" {
+		t.Fatalf("unexpected insert %+v", insert)
+	}
+	if insert.Keys["id"] != "p1" || insert.SequenceNumber != "1" {
+		t.Fatalf("unexpected keys %v at %s", insert.Keys, insert.SequenceNumber)
+	}
+
+	modify := changes[1]
+	if modify.EventName != EventModify || modify.NewImage.Price != 12 || modify.OldImage.Price != 10.5 {
+		t.Fatalf("unexpected modify %+v", modify)
+	}
+
+	remove := changes[2]
+	if remove.EventName != EventRemove || remove.NewImage != nil || remove.OldImage == nil || remove.OldImage.Price != 12 {
+		t.Fatalf("unexpected remove %+v", remove)
+	}
+}
+
+func TestConsumerResumesFromCheckpoint(t *testing.T) {
+	shard := &fakeShard{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "1"), nil),
+		record("2", streamtypes.OperationTypeInsert, "p2", image("p2", "2"), nil),
+	}}
+	stream := &fakeStream{shards: []*fakeShard{shard}}
+	consumer, checkpoints, _ := newTestConsumer(stream)
+
+	var seen []string
+	consumer.Handle("collect", func(_ context.Context, change Change[testItem]) error {
+		seen = append(seen, change.SequenceNumber)
+		return nil
+	})
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	checkpoint := checkpoints.checkpoints[checkpointID("test", "shard-1")]
+	if checkpoint.SequenceNumber != "2" || checkpoint.Finished {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	shard.records = append(shard.records, record("3", streamtypes.OperationTypeInsert, "p3", image("p3", "3"), nil))
+	shard.closed = true
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if !slices.Equal(seen, []string{"1", "2", "3"}) {
+		t.Fatalf("delivered %v, want every record once", seen)
+	}
+	if stream.iterators[1] != streamtypes.ShardIteratorTypeAfterSequenceNumber {
+		t.Fatalf("second poll started at %s, want after the checkpoint", stream.iterators[1])
+	}
+
+	checkpoint = checkpoints.checkpoints[checkpointID("test", "shard-1")]
+	if checkpoint.SequenceNumber != "3" || !checkpoint.Finished {
+		t.Fatalf("closed shard was not finished: %+v", checkpoint)
+	}
+
+	// A finished shard is not read again
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if len(stream.iterators) != 2 {
+		t.Fatalf("finished shard was read again")
+	}
+}
+
+func TestConsumerReadsParentShardFirst(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{
+		{id: "child", parent: "parent", records: []streamtypes.Record{
+			record("2", streamtypes.OperationTypeModify, "p1", image("p1", "2"), image("p1", "1")),
+		}, closed: true},
+		{id: "parent", records: []streamtypes.Record{
+			record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "1"), nil),
+		}, closed: true},
+	}}
+	consumer, _, _ := newTestConsumer(stream)
+
+	var seen []string
+	consumer.Handle("collect", func(_ context.Context, change Change[testItem]) error {
+		seen = append(seen, change.SequenceNumber)
+		return nil
+	})
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if !slices.Equal(seen, []string{"1", "2"}) {
+		t.Fatalf("delivered %v, want the parent shard first", seen)
+	}
+}
+
+func TestConsumerRetriesFailingHandler(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "1"), nil),
+	}}}}
+	consumer, _, deadLetters := newTestConsumer(stream)
+
+	calls := 0
+	consumer.Handle("flaky", func(context.Context, Change[testItem]) error {
+		calls++
+		if calls < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if calls != 3 || len(deadLetters.letters) != 0 {
+		t.Fatalf("handler called %d times with dead letters %+v, want a success on the third attempt", calls, deadLetters.letters)
+	}
+}
+
+func TestConsumerDeadLettersAndMovesOn(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "1"), nil),
+		record("2", streamtypes.OperationTypeInsert, "p2", map[string]streamtypes.AttributeValue{
+			"id":    &streamtypes.AttributeValueMemberS{Value: "p2"},
+			"price": &streamtypes.AttributeValueMemberS{Value: "not a number"},
+		}, nil),
+		record("3", streamtypes.OperationTypeInsert, "p3", image("p3", "3"), nil),
+	}}}}
+	consumer, checkpoints, deadLetters := newTestConsumer(stream)
+
+	var failing, healthy []string
+	consumer.
+		Handle("failing", func(_ context.Context, change Change[testItem]) error {
+			failing = append(failing, change.SequenceNumber)
+			if change.SequenceNumber == "1" {
+				return errors.New("broken")
+			}
+			return nil
+		}).
+		Handle("healthy", func(_ context.Context, change Change[testItem]) error {
+			healthy = append(healthy, change.SequenceNumber)
+			return nil
+		})
+
+	if err := consumer.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	if !slices.Equal(failing, []string{"1", "1", "1", "3"}) || !slices.Equal(healthy, []string{"1", "3"}) {
+		t.Fatalf("failing handler got %v and healthy one %v", failing, healthy)
+	}
+
+	if len(deadLetters.letters) != 2 {
+		t.Fatalf("got dead letters %+v, want the handler failure and the undecodable record", deadLetters.letters)
+	}
+	handlerFailure, decodeFailure := deadLetters.letters[0], deadLetters.letters[1]
+	if handlerFailure.Handler != "failing" || handlerFailure.SequenceNumber != "1" || handlerFailure.Attempts != 3 ||
+		handlerFailure.Error != "broken" || handlerFailure.Keys != `{"id":"p1"}` {
+		t.Fatalf("unexpected dead letter %+v", handlerFailure)
+	}
+	if decodeFailure.Handler != "decode" || decodeFailure.SequenceNumber != "2" || decodeFailure.Attempts != 1 {
+		t.Fatalf("unexpected dead letter %+v", decodeFailure)
+	}
+
+	if checkpoint := checkpoints.checkpoints[checkpointID("test", "shard-1")]; checkpoint.SequenceNumber != "3" {
+		t.Fatalf("checkpoint stopped at %s, want past the dead letters", checkpoint.SequenceNumber)
+	}
+}
+
+func TestConsumerStopsWhenDeadLetterSinkFails(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "1"), nil),
+		record("2", streamtypes.OperationTypeInsert, "p2", image("p2", "2"), nil),
+	}}}}
+	consumer, checkpoints, deadLetters := newTestConsumer(stream)
+	deadLetters.err = errors.New("sink unavailable")
+
+	var seen []string
+	consumer.Handle("failing", func(_ context.Context, change Change[testItem]) error {
+		seen = append(seen, change.SequenceNumber)
+		return errors.New("broken")
+	})
+
+	if err := consumer.Poll(context.Background()); err == nil {
+		t.Fatal("Poll succeeded although the record could not be dead-lettered")
+	}
+	if slices.Contains(seen, "2") {
+		t.Fatal("the shard moved past a record that was neither handled nor dead-lettered")
+	}
+	if _, ok := checkpoints.checkpoints[checkpointID("test", "shard-1")]; ok {
+		t.Fatal("the checkpoint moved past a record that was neither handled nor dead-lettered")
+	}
+}
+
+func TestConsumerOnlyReadsLeasedShards(t *testing.T) {
+	stream := &fakeStream{shards: []*fakeShard{{id: "shard-1", records: []streamtypes.Record{
+		record("1", streamtypes.OperationTypeInsert, "p1", image("p1", "10"), nil),
+	}}}}
+	leases := &memoryLeases{owners: map[string]string{}}
+
+	first, checkpoints, deadLetters := newTestConsumer(stream)
+	first.WithShardLeases(leases, "first")
+	second := NewConsumer[testItem]("test", testStreamArn, stream, checkpoints, deadLetters).WithShardLeases(leases, "second")
+
+	var handled []string
+	for _, consumer := range []*Consumer[testItem]{first, second} {
+		consumer.Handle("collect", func(_ context.Context, change Change[testItem]) error {
+			handled = append(handled, change.Keys["id"])
+			return nil
+		})
+	}
+
+	if err := first.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	checkpoints.checkpoints = map[string]domain.StreamCheckpoint{}
+	if err := second.Poll(context.Background()); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	if !slices.Equal(handled, []string{"p1"}) {
+		t.Fatalf("got changes %v, want only those of the lease holder", handled)
+	}
+	if len(checkpoints.checkpoints) != 0 {
+		t.Fatalf("consumer without the lease saved checkpoints %v", checkpoints.checkpoints)
+	}
+}
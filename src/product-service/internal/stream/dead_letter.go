@@ -0,0 +1,37 @@
+package stream
+
+import (
+	"context"
+	"log"
+
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/domain"
+	"github.com/quochao170402/ecommerce-aws/product-service/internal/repository"
+)
+
+// DeadLetterSink receives records a handler kept failing on, so the shard can move on
+type DeadLetterSink interface {
+	Put(ctx context.Context, letter domain.StreamDeadLetter) error
+}
+
+// LogDeadLetterSink only logs dead letters, for local development
+type LogDeadLetterSink struct{}
+
+func (LogDeadLetterSink) Put(ctx context.Context, letter domain.StreamDeadLetter) error {
+	log.Printf("Dead letter from %s/%s at %s (%s %s): %s",
+		letter.Consumer, letter.Handler, letter.SequenceNumber, letter.EventName, letter.Keys, letter.Error)
+	return nil
+}
+
+type repositoryDeadLetterSink struct {
+	repo repository.BaseRepository[domain.StreamDeadLetter]
+}
+
+// NewDeadLetterSink keeps dead letters in the given repository for inspection and replay
+func NewDeadLetterSink(repo repository.BaseRepository[domain.StreamDeadLetter]) DeadLetterSink {
+	return &repositoryDeadLetterSink{repo: repo}
+}
+
+func (s *repositoryDeadLetterSink) Put(ctx context.Context, letter domain.StreamDeadLetter) error {
+	letter.ID = letter.Consumer + "#" + letter.Handler + "#" + letter.SequenceNumber
+	return s.repo.Save(ctx, &letter)
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+)
+
+// Permitted authenticates the caller by access token or API key and allows only
+// those carrying permission, for use on the catalog write routes
+func Permitted(permission string) []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		authmw.AuthOrAPIKeyMiddleware(),
+		authmw.RequirePermission(permission),
+	}
+}
@@ -17,6 +17,7 @@ import (
 const (
 	// DynamoDB limits
 	MaxBatchWriteItems = 25
+	MaxBatchGetItems   = 100
 	MaxRetryAttempts   = 3
 
 	// Table creation timeout
@@ -253,6 +254,32 @@ func (s *DynamoService[T]) GetItemConsistent(ctx context.Context, key map[string
 	return &item, nil
 }
 
+// DeleteItemIfVersion removes an item only while it still has the expected version
+func (s *DynamoService[T]) DeleteItemIfVersion(ctx context.Context, key map[string]types.AttributeValue, version int) error {
+	expr, err := expression.NewBuilder().WithCondition(versionCondition(version)).Build()
+	if err != nil {
+		return fmt.Errorf("error when build condition expression: %v", err)
+	}
+
+	_, err = s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	if err != nil {
+		var conditionalCheckEx *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckEx) {
+			return fmt.Errorf("delete condition check failed: %w", err)
+		}
+		return fmt.Errorf("failed to delete item from table %s: %w", s.tableName, err)
+	}
+
+	return nil
+}
+
 // DeleteItem removes an item from the table
 func (s *DynamoService[T]) DeleteItem(ctx context.Context, key map[string]types.AttributeValue) error {
 	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
@@ -274,33 +301,23 @@ type UpdateItemOptions struct {
 	ConditionExpression  *string
 	ExpressionAttributes map[string]any
 	ReturnValues         types.ReturnValue
+	// ExpectedVersion makes the update fail unless the stored version still matches
+	ExpectedVersion *int
 }
 
 // UpdateItem updates an item with comprehensive options
 func (s *DynamoService[T]) UpdateItem(ctx context.Context, opts UpdateItemOptions) (*T, error) {
-	update := expression.UpdateBuilder{}
-
-	for key, value := range opts.ExpressionAttributes {
-		switch v := value.(type) {
-		case int, int64:
-			update = update.Set(expression.Name(key), expression.Value(v))
-		case float64:
-			update = update.Set(expression.Name(key), expression.Value(v))
-		default:
-			update = update.Set(expression.Name(key), expression.Value(fmt.Sprintf("%v", v)))
-		}
-	}
-
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	expr, err := buildUpdateExpression(opts.ExpressionAttributes, opts.ExpectedVersion)
 
 	if err != nil {
-		return nil, fmt.Errorf("error when build update expression: %v", err)
+		return nil, err
 	}
 
 	input := &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(s.tableName),
 		Key:                       opts.Key,
 		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		ReturnValues:              opts.ReturnValues,
@@ -327,6 +344,48 @@ func (s *DynamoService[T]) UpdateItem(ctx context.Context, opts UpdateItemOption
 	return nil, nil
 }
 
+// buildUpdateExpression turns attribute values into a SET update expression, guarded
+// by the expected version when one is given. Nil values REMOVE their attribute.
+func buildUpdateExpression(attributes map[string]any, expectedVersion *int) (expression.Expression, error) {
+	update := expression.UpdateBuilder{}
+
+	for key, value := range attributes {
+		switch v := value.(type) {
+		case nil:
+			update = update.Remove(expression.Name(key))
+		case int, int64:
+			update = update.Set(expression.Name(key), expression.Value(v))
+		case float64:
+			update = update.Set(expression.Name(key), expression.Value(v))
+		case string, bool:
+			update = update.Set(expression.Name(key), expression.Value(v))
+		case fmt.Stringer:
+			update = update.Set(expression.Name(key), expression.Value(v.String()))
+		default:
+			// Lists, maps and structs are stored as native DynamoDB types
+			update = update.Set(expression.Name(key), expression.Value(v))
+		}
+	}
+
+	builder := expression.NewBuilder().WithUpdate(update)
+	if expectedVersion != nil {
+		builder = builder.WithCondition(versionCondition(*expectedVersion))
+	}
+
+	expr, err := builder.Build()
+
+	if err != nil {
+		return expression.Expression{}, fmt.Errorf("error when build update expression: %v", err)
+	}
+
+	return expr, nil
+}
+
+// versionCondition matches items that still have the given version
+func versionCondition(version int) expression.ConditionBuilder {
+	return expression.Equal(expression.Name("version"), expression.Value(version))
+}
+
 // Helper function to create a simple key for string IDs
 func CreateStringKey(id string) map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{
@@ -497,3 +556,386 @@ func (s *DynamoService[T]) PutItem(ctx context.Context, data T) error {
 
 	return nil
 }
+
+// TableName returns the name of the table backing this service
+func (s *DynamoService[T]) TableName() string {
+	return s.tableName
+}
+
+// PutItemIfNotExists adds a single item only when no item with the same id exists
+func (s *DynamoService[T]) PutItemIfNotExists(ctx context.Context, data T) error {
+	item, err := attributevalue.MarshalMap(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to add item to table %s: %w", s.tableName, err)
+	}
+
+	return nil
+}
+
+// UpdateItemWithBuilder updates an item using a prepared update and optional condition
+func (s *DynamoService[T]) UpdateItemWithBuilder(ctx context.Context,
+	key map[string]types.AttributeValue,
+	update expression.UpdateBuilder,
+	condition *expression.ConditionBuilder,
+	returnValues types.ReturnValue) (*T, error) {
+
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("error when build update expression: %v", err)
+	}
+
+	result, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              returnValues,
+	})
+	if err != nil {
+		var conditionalCheckEx *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckEx) {
+			return nil, fmt.Errorf("update condition check failed: %w", err)
+		}
+		return nil, fmt.Errorf("failed to update item in table %s: %w", s.tableName, err)
+	}
+
+	if returnValues != types.ReturnValueNone && result.Attributes != nil {
+		var updated T
+		if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal updated item: %w", err)
+		}
+		return &updated, nil
+	}
+
+	return nil, nil
+}
+
+// TransactWriteItems applies all write operations atomically, possibly across tables
+func (s *DynamoService[T]) TransactWriteItems(ctx context.Context, items []types.TransactWriteItem) error {
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	if err != nil {
+		return fmt.Errorf("transaction on table %s failed: %w", s.tableName, err)
+	}
+
+	return nil
+}
+
+// ScanPages walks the table one page at a time, handing each page to fn. It keeps
+// memory bounded for jobs that have to visit every item.
+func (s *DynamoService[T]) ScanPages(ctx context.Context, request ScanRequest, pageSize int32, fn func(page []T) error) error {
+	expressionBuilder := expression.NewBuilder()
+	hasExpression := false
+
+	if request.FilterBuilder != nil {
+		expressionBuilder = expressionBuilder.WithFilter(*request.FilterBuilder)
+		hasExpression = true
+	}
+
+	if request.ProjectionBuilder != nil {
+		expressionBuilder = expressionBuilder.WithProjection(*request.ProjectionBuilder)
+		hasExpression = true
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(s.tableName),
+		Limit:     aws.Int32(pageSize),
+	}
+
+	if hasExpression {
+		expr, err := expressionBuilder.Build()
+		if err != nil {
+			return fmt.Errorf("couldn't build expressions for scan: %w", err)
+		}
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+		input.FilterExpression = expr.Filter()
+		input.ProjectionExpression = expr.Projection()
+	}
+
+	scanPaginator := dynamodb.NewScanPaginator(s.client, input)
+	for scanPaginator.HasMorePages() {
+		response, err := scanPaginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan table %s: %w", s.tableName, err)
+		}
+
+		var itemPage []T
+		if err := attributevalue.UnmarshalListOfMaps(response.Items, &itemPage); err != nil {
+			return fmt.Errorf("failed to unmarshal scan page: %w", err)
+		}
+
+		if err := fn(itemPage); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueryRequest selects items by key condition, on the table or on IndexName
+type QueryRequest struct {
+	IndexName         string
+	KeyBuilder        expression.KeyConditionBuilder
+	FilterBuilder     *expression.ConditionBuilder
+	ProjectionBuilder *expression.ProjectionBuilder
+	Descending        bool // read in descending sort key order
+}
+
+// QueryPages runs the query one page at a time in sort key order, ascending unless
+// the request says otherwise, handing each page to fn until it returns false or
+// the results end
+func (s *DynamoService[T]) QueryPages(ctx context.Context, request QueryRequest, pageSize int32, fn func(page []T) bool) error {
+	expressionBuilder := expression.NewBuilder().WithKeyCondition(request.KeyBuilder)
+	if request.FilterBuilder != nil {
+		expressionBuilder = expressionBuilder.WithFilter(*request.FilterBuilder)
+	}
+	if request.ProjectionBuilder != nil {
+		expressionBuilder = expressionBuilder.WithProjection(*request.ProjectionBuilder)
+	}
+
+	expr, err := expressionBuilder.Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expressions for query: %w", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int32(pageSize),
+	}
+	if request.IndexName != "" {
+		input.IndexName = aws.String(request.IndexName)
+	}
+	if request.Descending {
+		input.ScanIndexForward = aws.Bool(false)
+	}
+
+	queryPaginator := dynamodb.NewQueryPaginator(s.client, input)
+	for queryPaginator.HasMorePages() {
+		response, err := queryPaginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query table %s: %w", s.tableName, err)
+		}
+
+		var itemPage []T
+		if err := attributevalue.UnmarshalListOfMaps(response.Items, &itemPage); err != nil {
+			return fmt.Errorf("failed to unmarshal query page: %w", err)
+		}
+
+		if !fn(itemPage) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// BatchGetItems retrieves many items by key (handles DynamoDB 100-key limit).
+// Missing keys are skipped, the result order is not guaranteed.
+func (s *DynamoService[T]) BatchGetItems(ctx context.Context, keys []map[string]types.AttributeValue) ([]T, error) {
+	var items []T
+
+	for start := 0; start < len(keys); start += MaxBatchGetItems {
+		end := start + MaxBatchGetItems
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		requestItems := map[string]types.KeysAndAttributes{
+			s.tableName: {Keys: keys[start:end]},
+		}
+
+		for attempt := 0; attempt < MaxRetryAttempts && len(requestItems) > 0; attempt++ {
+			if attempt > 0 {
+				backoff := time.Duration(attempt*attempt) * 100 * time.Millisecond
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(backoff):
+				}
+			}
+
+			result, err := s.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: requestItems,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("batch get failed on table %s: %w", s.tableName, err)
+			}
+
+			var page []T
+			if err := attributevalue.UnmarshalListOfMaps(result.Responses[s.tableName], &page); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+			}
+			items = append(items, page...)
+
+			requestItems = result.UnprocessedKeys
+		}
+
+		if len(requestItems) > 0 {
+			return nil, fmt.Errorf("failed to get all items after %d attempts, %d keys remain unprocessed",
+				MaxRetryAttempts, len(requestItems[s.tableName].Keys))
+		}
+	}
+
+	return items, nil
+}
+
+// PutTransactItem prepares a put of data for use in TransactWriteItems
+func (s *DynamoService[T]) PutTransactItem(data T) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(data)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("failed to marshal item: %w", err)
+	}
+
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	}}, nil
+}
+
+// UpdateTransactItem prepares the same update as UpdateItem for use in TransactWriteItems
+func (s *DynamoService[T]) UpdateTransactItem(opts UpdateItemOptions) (types.TransactWriteItem, error) {
+	expr, err := buildUpdateExpression(opts.ExpressionAttributes, opts.ExpectedVersion)
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	return types.TransactWriteItem{Update: &types.Update{
+		TableName:                 aws.String(s.tableName),
+		Key:                       opts.Key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}}, nil
+}
+
+// DeleteTransactItem prepares a delete for use in TransactWriteItems, guarded by the
+// expected version when one is given
+func (s *DynamoService[T]) DeleteTransactItem(key map[string]types.AttributeValue, expectedVersion *int) (types.TransactWriteItem, error) {
+	input := &types.Delete{
+		TableName: aws.String(s.tableName),
+		Key:       key,
+	}
+
+	if expectedVersion != nil {
+		expr, err := expression.NewBuilder().WithCondition(versionCondition(*expectedVersion)).Build()
+		if err != nil {
+			return types.TransactWriteItem{}, fmt.Errorf("error when build condition expression: %v", err)
+		}
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
+	return types.TransactWriteItem{Delete: input}, nil
+}
+
+// EnableTimeToLive lets DynamoDB expire items once the epoch seconds in attribute have passed
+func (s *DynamoService[T]) EnableTimeToLive(ctx context.Context, attribute string) error {
+	_, err := s.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(s.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL on table %s: %w", s.tableName, err)
+	}
+
+	return nil
+}
+
+// EnsureStream enables a NEW_AND_OLD_IMAGES stream on the table if none is active
+// and returns the ARN of the latest stream
+func (s *DynamoService[T]) EnsureStream(ctx context.Context) (string, error) {
+	table, err := s.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe table %s: %w", s.tableName, err)
+	}
+
+	spec := table.Table.StreamSpecification
+	if spec != nil && aws.ToBool(spec.StreamEnabled) && table.Table.LatestStreamArn != nil {
+		return aws.ToString(table.Table.LatestStreamArn), nil
+	}
+
+	updated, err := s.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(s.tableName),
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewAndOldImages,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enable stream on table %s: %w", s.tableName, err)
+	}
+
+	if err := s.waitForTableActive(ctx); err != nil {
+		return "", err
+	}
+
+	return aws.ToString(updated.TableDescription.LatestStreamArn), nil
+}
+
+// EnsureGlobalSecondaryIndex adds index to the table unless it has it. DynamoDB
+// builds the index in the background; queries on it fail until it is active.
+func (s *DynamoService[T]) EnsureGlobalSecondaryIndex(ctx context.Context, index types.GlobalSecondaryIndex,
+	attributes []types.AttributeDefinition) error {
+	table, err := s.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.tableName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe table %s: %w", s.tableName, err)
+	}
+
+	for _, existing := range table.Table.GlobalSecondaryIndexes {
+		if aws.ToString(existing.IndexName) == aws.ToString(index.IndexName) {
+			return nil
+		}
+	}
+
+	_, err = s.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(s.tableName),
+		AttributeDefinitions: attributes,
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+			Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:             index.IndexName,
+				KeySchema:             index.KeySchema,
+				Projection:            index.Projection,
+				ProvisionedThroughput: index.ProvisionedThroughput,
+			},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create index %s on table %s: %w", aws.ToString(index.IndexName), s.tableName, err)
+	}
+	return nil
+}
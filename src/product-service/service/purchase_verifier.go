@@ -0,0 +1,15 @@
+package service
+
+import "context"
+
+// PurchaseVerifier answers whether a user has bought a product, used to flag verified reviews
+type PurchaseVerifier interface {
+	HasPurchased(ctx context.Context, userId string, productId string) (bool, error)
+}
+
+// NoopPurchaseVerifier never verifies a purchase, used until order history is available
+type NoopPurchaseVerifier struct{}
+
+func (NoopPurchaseVerifier) HasPurchased(ctx context.Context, userId string, productId string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// APIKeyHeader carries the API key of machine clients
+const APIKeyHeader = "X-API-Key"
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid or expired api key")
+	ErrNoAPIKeyVerifier  = errors.New("no api key verifier configured")
+	ErrAPIKeyRateLimited = errors.New("too many unknown api keys")
+)
+
+// APIKeyVerifier resolves an API key to claims shaped like those of an access token
+// issued to an OAuth client: the key id is the client id, and the scopes and
+// permissions are those of the key.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (jwt.MapClaims, error)
+}
+
+var (
+	apiKeyVerifierMu sync.RWMutex
+	apiKeyVerifier   APIKeyVerifier
+)
+
+// SetAPIKeyVerifier installs the verifier VerifyAPIKey uses. Services accepting API
+// keys call it once at startup.
+func SetAPIKeyVerifier(v APIKeyVerifier) {
+	apiKeyVerifierMu.Lock()
+	defer apiKeyVerifierMu.Unlock()
+	apiKeyVerifier = v
+}
+
+// VerifyAPIKey returns the claims of key
+func VerifyAPIKey(ctx context.Context, key string) (jwt.MapClaims, error) {
+	apiKeyVerifierMu.RLock()
+	v := apiKeyVerifier
+	apiKeyVerifierMu.RUnlock()
+
+	if v == nil {
+		return nil, ErrNoAPIKeyVerifier
+	}
+	return v.VerifyAPIKey(ctx, key)
+}
+
+type apiKeyClientKey struct{}
+
+// WithAPIKeyClient returns a copy of ctx naming the client, usually its IP, that
+// presented an API key. Verifiers budget the keys they do not know per client.
+func WithAPIKeyClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, apiKeyClientKey{}, client)
+}
+
+// apiKeyClient returns the client named by WithAPIKeyClient, empty when none was
+func apiKeyClient(ctx context.Context) string {
+	client, _ := ctx.Value(apiKeyClientKey{}).(string)
+	return client
+}
+
+const (
+	// apiKeyCacheCapacity bounds how many answers are cached, least recently used first out
+	apiKeyCacheCapacity = 10000
+	// apiKeyMissRate and apiKeyMissBurst bound how often per second each client may
+	// send keys missing from the cache to the issuing service, so a client cycling
+	// through random keys can neither flood it nor use up the budget of others
+	apiKeyMissRate  = 5
+	apiKeyMissBurst = 20
+	// apiKeyMissClients bounds how many clients budgets are kept for. Clients whose
+	// budget refilled are forgotten first; while every budget is in use, unknown
+	// clients are refused.
+	apiKeyMissClients = 10000
+)
+
+// missBudget holds the tokens a client has left for cache misses
+type missBudget struct {
+	tokens   float64
+	refilled time.Time
+}
+
+// refill adds the tokens earned since the last refill, up to apiKeyMissBurst
+func (b *missBudget) refill(now time.Time) {
+	b.tokens = min(apiKeyMissBurst, b.tokens+now.Sub(b.refilled).Seconds()*apiKeyMissRate)
+	b.refilled = now
+}
+
+// cachedAPIKey is the answer of the issuing service about one key
+type cachedAPIKey struct {
+	cacheKey  string
+	claims    jwt.MapClaims // nil for invalid keys
+	expiresAt time.Time
+}
+
+// RemoteAPIKeyVerifier asks the service issuing API keys about every key, and
+// caches the answers for ttl. A revoked key keeps working until its answer expires.
+// Concurrent requests with the same key share one call, and keys missing from the
+// cache are budgeted per client.
+type RemoteAPIKeyVerifier struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	group  singleflight.Group
+
+	mu    sync.Mutex
+	cache map[string]*list.Element
+	order *list.List // most recently used first
+
+	// budgets for cache misses by client, refilled at apiKeyMissRate up to apiKeyMissBurst
+	misses map[string]*missBudget
+}
+
+func NewRemoteAPIKeyVerifier(url string, ttl time.Duration) *RemoteAPIKeyVerifier {
+	return &RemoteAPIKeyVerifier{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  make(map[string]*list.Element),
+		order:  list.New(),
+		misses: make(map[string]*missBudget),
+	}
+}
+
+func (v *RemoteAPIKeyVerifier) VerifyAPIKey(ctx context.Context, key string) (jwt.MapClaims, error) {
+	// Keys are only held hashed, even in memory
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	cached, found := v.get(cacheKey, time.Now())
+	if !found {
+		// Budgeted before joining a shared call, so every caller pays for its own misses
+		if !v.allowMiss(apiKeyClient(ctx), time.Now()) {
+			return nil, ErrAPIKeyRateLimited
+		}
+
+		// The call is shared, so it must not fail because the caller starting it went away
+		result, err, _ := v.group.Do(cacheKey, func() (any, error) {
+			claims, err := v.fetch(context.WithoutCancel(ctx), key)
+			if err != nil && !errors.Is(err, ErrInvalidAPIKey) {
+				return nil, err
+			}
+
+			cached := &cachedAPIKey{cacheKey: cacheKey, claims: claims, expiresAt: time.Now().Add(v.ttl)}
+			v.set(cached)
+			return cached, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		cached = result.(*cachedAPIKey)
+	}
+
+	if cached.claims == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return cached.claims, nil
+}
+
+// get returns the unexpired answer about cacheKey, marking it recently used
+func (v *RemoteAPIKeyVerifier) get(cacheKey string, now time.Time) (*cachedAPIKey, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	element, ok := v.cache[cacheKey]
+	if !ok {
+		return nil, false
+	}
+
+	cached := element.Value.(*cachedAPIKey)
+	if !now.Before(cached.expiresAt) {
+		v.remove(element)
+		return nil, false
+	}
+
+	v.order.MoveToFront(element)
+	return cached, true
+}
+
+// set caches an answer, evicting the least recently used ones beyond the capacity
+func (v *RemoteAPIKeyVerifier) set(cached *cachedAPIKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if element, ok := v.cache[cached.cacheKey]; ok {
+		v.remove(element)
+	}
+	v.cache[cached.cacheKey] = v.order.PushFront(cached)
+
+	for v.order.Len() > apiKeyCacheCapacity {
+		v.remove(v.order.Back())
+	}
+}
+
+func (v *RemoteAPIKeyVerifier) remove(element *list.Element) {
+	v.order.Remove(element)
+	delete(v.cache, element.Value.(*cachedAPIKey).cacheKey)
+}
+
+// allowMiss takes a token of client for sending a key to the issuing service, if
+// one is left
+func (v *RemoteAPIKeyVerifier) allowMiss(client string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	budget, ok := v.misses[client]
+	if !ok {
+		if len(v.misses) >= apiKeyMissClients {
+			v.pruneMisses(now)
+		}
+		if len(v.misses) >= apiKeyMissClients {
+			return false
+		}
+		budget = &missBudget{tokens: apiKeyMissBurst, refilled: now}
+		v.misses[client] = budget
+	}
+
+	budget.refill(now)
+	if budget.tokens < 1 {
+		return false
+	}
+	budget.tokens--
+	return true
+}
+
+// pruneMisses forgets the clients whose budget refilled, they start over full anyway
+func (v *RemoteAPIKeyVerifier) pruneMisses(now time.Time) {
+	for client, budget := range v.misses {
+		budget.refill(now)
+		if budget.tokens >= apiKeyMissBurst {
+			delete(v.misses, client)
+		}
+	}
+}
+
+func (v *RemoteAPIKeyVerifier) fetch(ctx context.Context, key string) (jwt.MapClaims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(APIKeyHeader, key)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrInvalidAPIKey
+	default:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var claims jwt.MapClaims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode api key claims: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// An unknown kid triggers a refetch at most this often, so tokens with made up
+// key ids cannot be used to hammer the issuer
+const minJWKSRefreshInterval = time.Minute
+
+// JWKSVerifier verifies tokens against the key set published by the issuing service.
+// Keys are cached for ttl and refetched early when a token names a key not seen yet,
+// which is how newly rotated keys are picked up. The key set is fetched by one
+// caller at a time and outside the lock; only callers needing a key not cached yet
+// wait for it.
+type JWKSVerifier struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	group  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWKSVerifier(url string, ttl time.Duration) *JWKSVerifier {
+	return &JWKSVerifier{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *JWKSVerifier) Verify(tokenStr string) (jwt.MapClaims, error) {
+	return ParseSigned(tokenStr, v.key)
+}
+
+func (v *JWKSVerifier) key(kid string) (crypto.PublicKey, error) {
+	key, found, stale := v.cached(kid)
+
+	switch {
+	case stale && found:
+		// An expired key set is refreshed in the background, its keys are still good
+		v.group.DoChan("", v.refreshIfStale(kid))
+	case stale:
+		v.group.Do("", v.refreshIfStale(kid))
+		key, found, _ = v.cached(kid)
+	}
+
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// refreshIfStale returns the refresh run for kid, unless another caller refreshed
+// since this one looked
+func (v *JWKSVerifier) refreshIfStale(kid string) func() (any, error) {
+	return func() (any, error) {
+		if _, _, stale := v.cached(kid); !stale {
+			return nil, nil
+		}
+		if err := v.refresh(); err != nil {
+			// Keep verifying with the cached keys while the issuer is unreachable
+			log.Printf("failed to refresh JWKS from %s: %v", v.url, err)
+		}
+		return nil, nil
+	}
+}
+
+// cached returns the cached key kid, and whether the key set should be refetched
+// for it
+func (v *JWKSVerifier) cached(kid string) (key crypto.PublicKey, found bool, stale bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	key, found = v.keys[kid]
+	return key, found, (!found && age >= minJWKSRefreshInterval) || age >= v.ttl
+}
+
+func (v *JWKSVerifier) refresh() error {
+	// Set before fetching so a failing issuer is retried at the refresh interval, not per request
+	v.mu.Lock()
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		public, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("skipping JWKS key: %v", err)
+			continue
+		}
+		keys[jwk.Kid] = public
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
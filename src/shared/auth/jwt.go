@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Prepare claim names
+const (
+	ClaimUserID      = "user_id"
+	ClaimUserName    = "user_name"
+	ClaimUserEmail   = "user_email"
+	ClaimRole        = "role"
+	ClaimRoles       = "roles"
+	ClaimGrantRoles  = "grant_roles"
+	ClaimPermissions = "permissions"
+	ClaimExp         = "exp"
+	ClaimIssuedAt    = "iat"
+	ClaimTokenID     = "jti"
+	ClaimSessionID   = "sid"
+	ClaimTokenUse    = "token_use"
+	ClaimClientID    = "client_id"
+	ClaimScope       = "scope"
+	ClaimAPIKeyID    = "api_key_id"
+)
+
+// TokenUseAccess marks access tokens. Other signed tokens, like login challenges,
+// carry a different use and are refused by the auth middleware.
+const TokenUseAccess = "access"
+
+// Role names shared by every service
+const (
+	RoleAdmin    = "ADMIN"
+	RoleEmployee = "EMPLOYEE"
+	RoleCustomer = "CUSTOMER"
+)
+
+// Permission names shared by every service. Roles hold permissions, and tokens carry
+// the permissions of every role the user holds, inherited ones included.
+const (
+	PermissionReviewWrite          = "review:write"
+	PermissionReviewModerate       = "review:moderate"
+	PermissionProductWrite         = "product:write"
+	PermissionCategoryWrite        = "category:write"
+	PermissionBrandWrite           = "brand:write"
+	PermissionUserManage           = "user:manage"
+	PermissionRoleManage           = "role:manage"
+	PermissionOAuthClientManage    = "oauth_client:manage"
+	PermissionServiceAccountManage = "service_account:manage"
+	PermissionPersonalDataManage   = "personal_data:manage"
+	PermissionMetricsRead          = "metrics:read"
+	PermissionOutboxManage         = "outbox:manage"
+)
+
+// Signing algorithms tokens may use. Symmetric algorithms are never accepted, so
+// verifying services only ever hold public keys.
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid or expired token")
+	ErrUnknownKey    = errors.New("token signed with unknown key")
+	ErrNoVerifier    = errors.New("no token verifier configured")
+	validSigningAlgs = []string{AlgRS256, AlgEdDSA}
+)
+
+// Verifier checks a token signature and returns its claims
+type Verifier interface {
+	Verify(tokenStr string) (jwt.MapClaims, error)
+}
+
+var (
+	verifierMu sync.RWMutex
+	verifier   Verifier
+)
+
+// SetVerifier installs the verifier ParseToken uses. Each service calls it once at startup.
+func SetVerifier(v Verifier) {
+	verifierMu.Lock()
+	defer verifierMu.Unlock()
+	verifier = v
+}
+
+// Parse token → return claims
+func ParseToken(tokenStr string) (jwt.MapClaims, error) {
+	verifierMu.RLock()
+	v := verifier
+	verifierMu.RUnlock()
+
+	if v == nil {
+		return nil, ErrNoVerifier
+	}
+	return v.Verify(tokenStr)
+}
+
+// ParseSigned verifies tokenStr with the public key lookup returns for its kid header
+func ParseSigned(tokenStr string, lookup func(kid string) (crypto.PublicKey, error)) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+		return lookup(kid)
+	}, jwt.WithValidMethods(validSigningAlgs))
+
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, ErrUnknownKey
+	}
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("failed to parse claims")
+	}
+	return claims, nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	revokedTokenPrefix = "auth:revoked:"
+	issuedBeforePrefix = "auth:issued-before:"
+)
+
+// RedisRevocationStore shares revocations between every service verifying tokens.
+// Entries expire on their own once the tokens they revoke have expired.
+type RedisRevocationStore struct {
+	client       *redis.Client
+	watermarkTTL time.Duration
+}
+
+func NewRedisRevocationStore(client *redis.Client, watermarkTTL time.Duration) *RedisRevocationStore {
+	return &RedisRevocationStore{client: client, watermarkTTL: watermarkTTL}
+}
+
+func (s *RedisRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, revokedTokenPrefix+tokenID, 1, ttl).Err()
+}
+
+func (s *RedisRevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	count, err := s.client.Exists(ctx, revokedTokenPrefix+tokenID).Result()
+	return count > 0, err
+}
+
+func (s *RedisRevocationStore) SetIssuedBefore(ctx context.Context, userID string, at time.Time) error {
+	return s.client.Set(ctx, issuedBeforePrefix+userID, at.Unix(), s.watermarkTTL).Err()
+}
+
+func (s *RedisRevocationStore) IssuedBefore(ctx context.Context, userID string) (time.Time, error) {
+	seconds, err := s.client.Get(ctx, issuedBeforePrefix+userID).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
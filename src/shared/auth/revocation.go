@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore records access tokens revoked before their expiry. Single tokens
+// are revoked by jti, the tokens of one session by SessionRevocationID. Every token
+// of a user issued before a watermark is revoked at once after a password change,
+// and every token carrying a role, see RoleRevocationID, after a change to the role.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	SetIssuedBefore(ctx context.Context, userID string, at time.Time) error
+	IssuedBefore(ctx context.Context, userID string) (time.Time, error)
+}
+
+var (
+	revocationMu sync.RWMutex
+	revocations  RevocationStore
+)
+
+// SetRevocationStore installs the store CheckRevoked consults. Without one no
+// token is treated as revoked.
+func SetRevocationStore(store RevocationStore) {
+	revocationMu.Lock()
+	defer revocationMu.Unlock()
+	revocations = store
+}
+
+// SessionRevocationID is the id RevokeToken takes to revoke every access token of a
+// session, until the last of them expires
+func SessionRevocationID(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+// RoleRevocationID is the id SetIssuedBefore takes to revoke every access token
+// carrying the role, held directly or inherited
+func RoleRevocationID(role string) string {
+	return "role:" + role
+}
+
+// CheckRevoked returns ErrTokenRevoked when the token was revoked by jti, belongs to
+// a revoked session or was issued before the watermark of its user or of one of
+// its roles
+func CheckRevoked(ctx context.Context, claims jwt.MapClaims) error {
+	revocationMu.RLock()
+	store := revocations
+	revocationMu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	if tokenID, _ := claims[ClaimTokenID].(string); tokenID != "" {
+		revoked, err := store.IsRevoked(ctx, tokenID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	if sessionID, _ := claims[ClaimSessionID].(string); sessionID != "" {
+		revoked, err := store.IsRevoked(ctx, SessionRevocationID(sessionID))
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	var watermarks []string
+	if userID, _ := claims[ClaimUserID].(string); userID != "" {
+		watermarks = append(watermarks, userID)
+	}
+	for _, role := range tokenRoles(claims) {
+		watermarks = append(watermarks, RoleRevocationID(role))
+	}
+
+	for _, id := range watermarks {
+		watermark, err := store.IssuedBefore(ctx, id)
+		if err != nil {
+			return err
+		}
+		if watermark.IsZero() {
+			continue
+		}
+
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil || issuedAt.Unix() < watermark.Unix() {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// tokenRoles returns the roles the grants of the token were resolved from: its role,
+// the roles it holds and, for tokens of OAuth clients, the roles of their user
+func tokenRoles(claims jwt.MapClaims) []string {
+	var roles []string
+	if role, _ := claims[ClaimRole].(string); role != "" {
+		roles = append(roles, role)
+	}
+
+	for _, name := range []string{ClaimRoles, ClaimGrantRoles} {
+		var values []any
+		switch claim := claims[name].(type) {
+		case []any:
+			values = claim
+		case []string:
+			for _, value := range claim {
+				values = append(values, value)
+			}
+		}
+
+		for _, value := range values {
+			if role, ok := value.(string); ok && !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+// MemoryRevocationStore keeps revocations in process, for a single instance
+type MemoryRevocationStore struct {
+	mu           sync.Mutex
+	tokens       map[string]time.Time
+	watermarks   map[string]memoryWatermark
+	watermarkTTL time.Duration
+}
+
+type memoryWatermark struct {
+	at        time.Time
+	expiresAt time.Time
+}
+
+// NewMemoryRevocationStore keeps watermarks for watermarkTTL, the access token
+// lifetime, after which every token they revoke has expired anyway
+func NewMemoryRevocationStore(watermarkTTL time.Duration) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:       make(map[string]time.Time),
+		watermarks:   make(map[string]memoryWatermark),
+		watermarkTTL: watermarkTTL,
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(_ context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, found := s.tokens[tokenID]
+	return found && time.Now().Before(expiresAt), nil
+}
+
+func (s *MemoryRevocationStore) SetIssuedBefore(_ context.Context, userID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(time.Now())
+	s.watermarks[userID] = memoryWatermark{at: at, expiresAt: at.Add(s.watermarkTTL)}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IssuedBefore(_ context.Context, userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watermark, found := s.watermarks[userID]
+	if !found || !time.Now().Before(watermark.expiresAt) {
+		return time.Time{}, nil
+	}
+	return watermark.at, nil
+}
+
+// purge drops entries that no longer revoke anything
+func (s *MemoryRevocationStore) purge(now time.Time) {
+	for tokenID, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, tokenID)
+		}
+	}
+	for userID, watermark := range s.watermarks {
+		if !now.Before(watermark.expiresAt) {
+			delete(s.watermarks, userID)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+// Context keys the authenticated claims are stored under
+const (
+	ContextUserID = "user_id"
+	ContextEmail  = "email"
+	ContextName   = "name"
+	ContextRole   = "role"
+	ContextClaims = "claims"
+)
+
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticateBearer(c) {
+			c.Next()
+		}
+	}
+}
+
+// AuthOrAPIKeyMiddleware authenticates machine clients by the API key in the
+// X-API-Key header, and everyone else like AuthMiddleware. API keys act like tokens
+// issued to OAuth clients, so RequireScope and RequireFirstParty apply to them.
+func AuthOrAPIKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticate(c) {
+			c.Next()
+		}
+	}
+}
+
+// authenticate verifies the API key of the request, or else its bearer token, and
+// stores the claims. It aborts the request and returns false when neither is valid.
+func authenticate(c *gin.Context) bool {
+	key := c.GetHeader(auth.APIKeyHeader)
+	if key == "" {
+		return authenticateBearer(c)
+	}
+
+	claims, err := auth.VerifyAPIKey(auth.WithAPIKeyClient(c.Request.Context(), c.ClientIP()), key)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired api key"})
+		} else if errors.Is(err, auth.ErrAPIKeyRateLimited) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify api key"})
+		}
+		return false
+	}
+
+	setClaims(c, claims)
+	return true
+}
+
+// authenticateBearer verifies the bearer token of the request and stores its claims.
+// It aborts the request and returns false when the token is missing or invalid.
+func authenticateBearer(c *gin.Context) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
+		c.Abort()
+		return false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+		c.Abort()
+		return false
+	}
+
+	claims, err := auth.ParseToken(parts[1])
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	if use, found := claims[auth.ClaimTokenUse]; found && use != auth.TokenUseAccess {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		c.Abort()
+		return false
+	}
+
+	if err := auth.CheckRevoked(c.Request.Context(), claims); err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+		} else {
+			// Fail closed, a revoked token must not pass while the store is unreachable
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify token"})
+		}
+		c.Abort()
+		return false
+	}
+
+	setClaims(c, claims)
+	return true
+}
+
+// setClaims stores the authenticated claims in the context
+func setClaims(c *gin.Context, claims jwt.MapClaims) {
+	c.Set(ContextUserID, claims[auth.ClaimUserID])
+	c.Set(ContextEmail, claims[auth.ClaimUserEmail])
+	c.Set(ContextName, claims[auth.ClaimUserName])
+	c.Set(ContextRole, claims[auth.ClaimRole])
+	c.Set(ContextClaims, claims)
+}
+
+// RequireRole allows the request when the authenticated user holds one of roles.
+// Roles inherited through the role hierarchy count, so ADMIN passes where EMPLOYEE
+// is required.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get(ContextClaims); !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if !slices.ContainsFunc(Roles(c), func(role string) bool { return slices.Contains(roles, role) }) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden – requires " + strings.Join(roles, " or ")})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request when the token carries every one of permissions
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get(ContextClaims); !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden – requires permission " + permission})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermissionWhen guards a public route for the requests applies picks: those
+// are authenticated like AuthOrAPIKeyMiddleware and need permission, the rest pass
+// anonymously.
+func RequirePermissionWhen(applies func(c *gin.Context) bool, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !applies(c) {
+			c.Next()
+			return
+		}
+		if !authenticate(c) {
+			return
+		}
+
+		if !HasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden – requires permission " + permission})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope allows tokens an OAuth client obtained only when they were granted
+// scope. Tokens from our own login carry no client and pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Claims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if clientID, _ := claims[auth.ClaimClientID].(string); clientID != "" {
+			granted, _ := claims[auth.ClaimScope].(string)
+			if !slices.Contains(strings.Fields(granted), scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden – requires scope " + scope})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireFirstParty refuses tokens issued to OAuth clients, for account management
+// no client may be delegated
+func RequireFirstParty() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Claims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if clientID, _ := claims[auth.ClaimClientID].(string); clientID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden – not available to third-party clients"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UserID returns the authenticated user id set by AuthMiddleware
+func UserID(c *gin.Context) (string, bool) {
+	value, exists := c.Get(ContextUserID)
+	if !exists {
+		return "", false
+	}
+	id, ok := value.(string)
+	return id, ok && id != ""
+}
+
+// Claims returns every claim of the authenticated token
+func Claims(c *gin.Context) (jwt.MapClaims, bool) {
+	value, exists := c.Get(ContextClaims)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(jwt.MapClaims)
+	return claims, ok
+}
+
+// Role returns the authenticated role set by AuthMiddleware
+func Role(c *gin.Context) string {
+	return c.GetString(ContextRole)
+}
+
+// Roles returns every role the authenticated user holds, inherited ones included.
+// Tokens without the roles claim only hold their role.
+func Roles(c *gin.Context) []string {
+	claims, _ := Claims(c)
+	if roles := stringsClaim(claims, auth.ClaimRoles); len(roles) > 0 {
+		return roles
+	}
+	if role := Role(c); role != "" {
+		return []string{role}
+	}
+	return nil
+}
+
+// Permissions returns the permissions of the authenticated token
+func Permissions(c *gin.Context) []string {
+	claims, _ := Claims(c)
+	return stringsClaim(claims, auth.ClaimPermissions)
+}
+
+// HasPermission reports whether the authenticated token carries permission, for
+// checks that depend on the resource, like editing what someone else owns
+func HasPermission(c *gin.Context, permission string) bool {
+	return slices.Contains(Permissions(c), permission)
+}
+
+// stringsClaim returns a claim holding a list of strings
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch values := claims[name].(type) {
+	case []string:
+		return values
+	case []any:
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			if str, ok := value.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -1,17 +1,23 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 )
 
-var jwtSecret = []byte(getEnv("JWT_SECRET", "supersecret"))
-
 var accessExpire = func() time.Duration {
 	minutes, err := strconv.Atoi(getEnv("JWT_ACCESS_EXPIRE", "20"))
 	if err != nil {
@@ -28,63 +34,136 @@ var refreshExpire = func() time.Duration {
 	return time.Duration(days) * 24 * time.Hour
 }()
 
-// Prepare claim names
-const (
-	ClaimUserID    = "user_id"
-	ClaimUserName  = "user_name"
-	ClaimUserEmail = "user_email"
-	ClaimRole      = "role"
-	ClaimExp       = "exp"
-)
+// TokenRetention is the lifetime of the longest lived signed token, how long a
+// retired signing key must stay published
+func TokenRetention() time.Duration {
+	return accessExpire
+}
 
-// Generate access & refresh tokens
-func GenerateTokens(user models.User, role string) (string, string, error) {
+// RefreshTokenLifetime is how long a refresh token can be used
+func RefreshTokenLifetime() time.Duration {
+	return refreshExpire
+}
 
+// GenerateAccessToken signs a short-lived access token for user in the session
+// sessionID, carrying the roles and permissions of its grants
+func GenerateAccessToken(keys *KeyRing, user models.User, grants Grants, sessionID uuid.UUID) (string, error) {
 	accessClaims := jwt.MapClaims{
-		ClaimUserID:    user.ID,
-		ClaimUserEmail: user.Email,
-		ClaimUserName:  user.Name,
-		ClaimRole:      user.Role.Name,
-		"exp":          time.Now().Add(time.Minute * accessExpire).Unix(),
-		"iat":          time.Now().Unix(),
+		auth.ClaimUserID:      user.ID,
+		auth.ClaimUserEmail:   user.Email,
+		auth.ClaimUserName:    user.Name,
+		auth.ClaimRole:        user.Role.Name,
+		auth.ClaimRoles:       grants.Roles,
+		auth.ClaimPermissions: grants.Permissions,
+		auth.ClaimExp:         time.Now().Add(accessExpire).Unix(),
+		auth.ClaimIssuedAt:    time.Now().Unix(),
+		auth.ClaimTokenID:     uuid.NewString(),
+		auth.ClaimSessionID:   sessionID,
+		auth.ClaimTokenUse:    auth.TokenUseAccess,
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString(jwtSecret)
-	if err != nil {
-		return "", "", err
+	return keys.Sign(accessClaims)
+}
+
+// GenerateScopedAccessToken signs an access token issued to an OAuth client. It acts
+// with the role its scopes map onto, see ScopeRole, and carries the permissions of
+// its scopes the user holds, in the session sessionID of its refresh token family.
+// user is nil for tokens a client obtained for itself through the client credentials
+// grant; those carry every permission of the scopes.
+func GenerateScopedAccessToken(keys *KeyRing, user *models.User, grants Grants, clientID string, scopes []string, sessionID uuid.UUID) (string, error) {
+	permissions := ScopePermissions(scopes)
+	if user != nil {
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+			return !grants.HasPermission(permission)
+		})
 	}
 
-	// Refresh token
-	refreshClaims := jwt.MapClaims{
-		ClaimUserID: user.ID,
-		"exp":       time.Now().Add(refreshExpire * 24 * time.Hour).Unix(),
-		"iat":       time.Now().Unix(),
+	claims := jwt.MapClaims{
+		"sub":                 clientID,
+		auth.ClaimRole:        ScopeRole(scopes),
+		auth.ClaimPermissions: permissions,
+		auth.ClaimClientID:    clientID,
+		auth.ClaimScope:       strings.Join(scopes, " "),
+		auth.ClaimExp:         time.Now().Add(accessExpire).Unix(),
+		auth.ClaimIssuedAt:    time.Now().Unix(),
+		auth.ClaimTokenID:     uuid.NewString(),
+		auth.ClaimTokenUse:    auth.TokenUseAccess,
 	}
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString(jwtSecret)
-	if err != nil {
-		return "", "", err
+
+	if user != nil {
+		claims["sub"] = user.ID.String()
+		claims[auth.ClaimUserID] = user.ID
+		claims[auth.ClaimUserEmail] = user.Email
+		claims[auth.ClaimUserName] = user.Name
+		claims[auth.ClaimSessionID] = sessionID
+		// Not roles the token acts with, only whose changes revoke it
+		claims[auth.ClaimGrantRoles] = grants.Roles
 	}
 
-	return accessToken, refreshToken, nil
+	return keys.Sign(claims)
 }
 
-// Parse token → return claims
-func ParseToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid or expired token")
+// AccessTokenLifetime is how long an access token is valid
+func AccessTokenLifetime() time.Duration {
+	return accessExpire
+}
+
+// Uses of MFA challenge tokens. A challenge proves the password was right and is
+// exchanged for the token pair once the second factor is checked.
+const (
+	TokenUseMFA           = "mfa"
+	TokenUseMFAEnrollment = "mfa_enrollment"
+)
+
+var ErrInvalidChallenge = errors.New("invalid or expired mfa token")
+
+// MFAChallengeLifetime is how long the second login step may take
+const MFAChallengeLifetime = 5 * time.Minute
+
+// GenerateMFAChallenge signs a short-lived challenge token of the given use for user
+func GenerateMFAChallenge(keys *KeyRing, user models.User, use string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":              user.ID.String(),
+		auth.ClaimExp:      time.Now().Add(MFAChallengeLifetime).Unix(),
+		auth.ClaimIssuedAt: time.Now().Unix(),
+		auth.ClaimTokenID:  uuid.NewString(),
+		auth.ClaimTokenUse: use,
+	}
+
+	return keys.Sign(claims)
+}
+
+// ParseMFAChallenge verifies a challenge token of the given use and returns its user id
+func ParseMFAChallenge(keys *KeyRing, tokenStr string, use string) (uuid.UUID, error) {
+	claims, err := keys.Verify(tokenStr)
+	if err != nil || claims[auth.ClaimTokenUse] != use {
+		return uuid.Nil, ErrInvalidChallenge
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("failed to parse claims")
+	subject, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		return uuid.Nil, ErrInvalidChallenge
 	}
-	return claims, nil
+	return userID, nil
+}
+
+// NewOpaqueToken returns a random token and the hash to store for it. Refresh and
+// password reset tokens are opaque, so they can never be presented as access tokens.
+func NewOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func getEnv(key, fallback string) string {
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+var ErrNoSigningKey = errors.New("no signing key is active")
+
+// SigningKey is one private key of the ring. A key signs between NotBefore and
+// NotAfter and is published from the moment it is loaded until every token it
+// signed has expired, which gives verifiers overlapping validity on both ends of
+// a rotation.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	NotBefore time.Time
+	NotAfter  time.Time // zero means the key signs until a newer key takes over
+}
+
+// KeyRing holds the signing keys of the service and verifies the tokens they signed
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []SigningKey
+
+	// retention is how long a retired key is still published, the lifetime of the longest lived token
+	retention time.Duration
+}
+
+func NewKeyRing(retention time.Duration, keys ...SigningKey) *KeyRing {
+	ring := &KeyRing{retention: retention}
+	ring.Replace(keys)
+	return ring
+}
+
+// Replace swaps the keys of the ring, used when the key manifest is reloaded
+func (r *KeyRing) Replace(keys []SigningKey) {
+	sorted := append([]SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].NotBefore.After(sorted[j].NotBefore)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = sorted
+}
+
+// Active returns the newest key allowed to sign at now
+func (r *KeyRing) Active(now time.Time) (SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if now.Before(key.NotBefore) {
+			continue
+		}
+		if !key.NotAfter.IsZero() && !now.Before(key.NotAfter) {
+			continue
+		}
+		return key, nil
+	}
+	return SigningKey{}, ErrNoSigningKey
+}
+
+// Sign signs claims with the active key and names it in the kid header
+func (r *KeyRing) Sign(claims jwt.MapClaims) (string, error) {
+	key, err := r.Active(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Verify checks a token signed by one of the published keys
+func (r *KeyRing) Verify(tokenStr string) (jwt.MapClaims, error) {
+	return auth.ParseSigned(tokenStr, func(kid string) (crypto.PublicKey, error) {
+		for _, key := range r.published(time.Now()) {
+			if key.ID == kid {
+				return key.Private.Public(), nil
+			}
+		}
+		return nil, auth.ErrUnknownKey
+	})
+}
+
+// JWKS returns the public keys verifiers should trust at now
+func (r *KeyRing) JWKS() (auth.JSONWebKeySet, error) {
+	set := auth.JSONWebKeySet{Keys: []auth.JSONWebKey{}}
+	for _, key := range r.published(time.Now()) {
+		jwk, err := auth.NewJSONWebKey(key.ID, key.Private.Public())
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// published returns upcoming keys, the active key and retired keys whose tokens may still be valid
+func (r *KeyRing) published(now time.Time) []SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	published := make([]SigningKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter.Add(r.retention)) {
+			continue
+		}
+		published = append(published, key)
+	}
+	return published
+}
+
+// keyManifest lists the signing keys of the ring, for example
+//
+//	{"keys": [{"kid": "2026-10", "file": "2026-10.pem", "notBefore": "2026-10-01T00:00:00Z"}]}
+//
+// Key files are PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) PEM files, relative to the manifest.
+type keyManifest struct {
+	Keys []struct {
+		Kid       string    `json:"kid"`
+		File      string    `json:"file"`
+		NotBefore time.Time `json:"notBefore"`
+		NotAfter  time.Time `json:"notAfter"`
+	} `json:"keys"`
+}
+
+// LoadSigningKeys reads the keys listed in the manifest at path
+func LoadSigningKeys(path string) ([]SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key manifest: %w", err)
+	}
+
+	var manifest keyManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse key manifest: %w", err)
+	}
+
+	keys := make([]SigningKey, 0, len(manifest.Keys))
+	for _, entry := range manifest.Keys {
+		if entry.Kid == "" {
+			return nil, errors.New("key manifest entry without kid")
+		}
+
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+
+		private, algorithm, err := readPrivateKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", entry.Kid, err)
+		}
+
+		keys = append(keys, SigningKey{
+			ID:        entry.Kid,
+			Algorithm: algorithm,
+			Private:   private,
+			NotBefore: entry.NotBefore,
+			NotAfter:  entry.NotAfter,
+		})
+	}
+
+	return keys, nil
+}
+
+func readPrivateKey(file string) (crypto.Signer, string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", errors.New("no PEM block found")
+	}
+
+	var parsed any
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, "", errors.New("RSA keys must be at least 2048 bits")
+		}
+		return key, auth.AlgRS256, nil
+	case ed25519.PrivateKey:
+		return key, auth.AlgEdDSA, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+// NewEphemeralSigningKey generates an Ed25519 key that lives as long as the process,
+// for local development without a key manifest
+func NewEphemeralSigningKey() (SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return SigningKey{
+		ID:        "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+		Algorithm: auth.AlgEdDSA,
+		Private:   private,
+		NotBefore: time.Now(),
+	}, nil
+}
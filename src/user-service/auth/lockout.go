@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy decides how long a client has to wait after consecutive failed
+// logins. The first FreeAttempts failures cost nothing, further failures back off
+// exponentially from BaseDelay, and MaxAttempts failures lock for LockoutDuration.
+type LockoutPolicy struct {
+	FreeAttempts    int
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+
+	// Window is how long failures are remembered. A failure after a quiet
+	// period starts counting from one again.
+	Window time.Duration
+}
+
+// Delay returns how long to refuse logins after the given number of consecutive failures
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.Locks(failures) {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locks reports whether the number of consecutive failures locks the client out
+func (p LockoutPolicy) Locks(failures int) bool {
+	return p.MaxAttempts > 0 && failures >= p.MaxAttempts
+}
+
+// attemptState is the failure history of one client
+type attemptState struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// AttemptLimiter tracks attempts per key in memory, such as the failed logins of a
+// client IP. Accounts are tracked in the database instead, so their lockout
+// survives restarts and is shared by every instance.
+type AttemptLimiter struct {
+	mu        sync.Mutex
+	policy    LockoutPolicy
+	attempts  map[string]*attemptState
+	lastPrune time.Time
+}
+
+func NewAttemptLimiter(policy LockoutPolicy) *AttemptLimiter {
+	return &AttemptLimiter{
+		policy:   policy,
+		attempts: make(map[string]*attemptState),
+	}
+}
+
+// RetryAfter returns how long key has to wait before its next attempt, zero when it may try now
+func (l *AttemptLimiter) RetryAfter(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, found := l.attempts[key]
+	if !found || !now.Before(state.lockedUntil) {
+		return 0
+	}
+	return state.lockedUntil.Sub(now)
+}
+
+// Fail records a failed attempt of key and returns the number of consecutive failures
+func (l *AttemptLimiter) Fail(key string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	state, found := l.attempts[key]
+	if !found || now.Sub(state.lastFailure) > l.policy.Window {
+		state = &attemptState{}
+		l.attempts[key] = state
+	}
+
+	state.failures++
+	state.lastFailure = now
+	state.lockedUntil = now.Add(l.policy.Delay(state.failures))
+	return state.failures
+}
+
+// Reset forgets the failures of key
+func (l *AttemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// prune drops clients whose failures are outside the window, at most once a minute
+func (l *AttemptLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	for key, state := range l.attempts {
+		if now.Sub(state.lastFailure) > l.policy.Window && !now.Before(state.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// LoginAttemptKey is the key failed logins with email are tracked under, the hash
+// of the normalised address
+func LoginAttemptKey(email string) string {
+	return HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Provider keys are cached like our own JWKS is by other services
+const oidcKeyCacheTTL = time.Hour
+
+// OIDCProviderConfig is one external identity provider. Endpoints are discovered
+// from the issuer unless set explicitly, for providers without complete discovery.
+type OIDCProviderConfig struct {
+	Name            string   `json:"name"`
+	Issuer          string   `json:"issuer"`
+	ClientID        string   `json:"clientId"`
+	ClientSecretEnv string   `json:"clientSecretEnv"` // environment variable holding the client secret
+	RedirectURL     string   `json:"redirectUrl"`
+	Scopes          []string `json:"scopes"`
+
+	AuthorizationEndpoint string `json:"authorizationEndpoint"`
+	TokenEndpoint         string `json:"tokenEndpoint"`
+	JWKSURI               string `json:"jwksUri"`
+}
+
+// OIDCClaims is the identity an ID token asserts
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against one provider
+type OIDCProvider struct {
+	config       OIDCProviderConfig
+	clientSecret string
+	client       *http.Client
+
+	mu       sync.Mutex
+	verifier *auth.JWKSVerifier // set once discovery succeeded
+}
+
+func NewOIDCProvider(config OIDCProviderConfig) *OIDCProvider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &OIDCProvider{
+		config:       config,
+		clientSecret: os.Getenv(config.ClientSecretEnv),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// LoadOIDCProviders reads the providers listed in the JSON file at path, keyed by name
+func LoadOIDCProviders(path string) (map[string]*OIDCProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oidc providers: %w", err)
+	}
+
+	var configs []OIDCProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse oidc providers: %w", err)
+	}
+
+	providers := make(map[string]*OIDCProvider, len(configs))
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider %q needs name, issuer, clientId and redirectUrl", config.Name)
+		}
+		providers[config.Name] = NewOIDCProvider(config)
+	}
+	return providers, nil
+}
+
+// discover fills in the endpoints missing from the config from the issuer discovery document
+func (p *OIDCProvider) discover(ctx context.Context) (*auth.JWKSVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.verifier != nil {
+		return p.verifier, nil
+	}
+
+	if p.config.AuthorizationEndpoint == "" || p.config.TokenEndpoint == "" || p.config.JWKSURI == "" {
+		var document struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			JWKSURI               string `json:"jwks_uri"`
+		}
+
+		discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := p.getJSON(ctx, discoveryURL, &document); err != nil {
+			return nil, fmt.Errorf("failed to discover %s: %w", p.config.Name, err)
+		}
+		if document.Issuer != p.config.Issuer {
+			return nil, fmt.Errorf("discovery of %s returned issuer %s", p.config.Name, document.Issuer)
+		}
+
+		p.config.AuthorizationEndpoint = firstNonEmpty(p.config.AuthorizationEndpoint, document.AuthorizationEndpoint)
+		p.config.TokenEndpoint = firstNonEmpty(p.config.TokenEndpoint, document.TokenEndpoint)
+		p.config.JWKSURI = firstNonEmpty(p.config.JWKSURI, document.JWKSURI)
+	}
+
+	p.verifier = auth.NewJWKSVerifier(p.config.JWKSURI, oidcKeyCacheTTL)
+	return p.verifier, nil
+}
+
+// AuthorizationURL returns where to send the user to sign in with the provider
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.config.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.config.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity its ID token asserts.
+// The ID token must be signed by the provider, issued for our client and carry nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (OIDCClaims, error) {
+	verifier, err := p.discover(ctx)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return OIDCClaims{}, fmt.Errorf("failed to redeem code with %s: %w", p.config.Name, err)
+	}
+
+	claims, err := verifier.Verify(tokens.IDToken)
+	if err != nil {
+		return OIDCClaims{}, ErrInvalidIDToken
+	}
+
+	return p.validateIDToken(claims, nonce)
+}
+
+// validateIDToken checks the claims the signature check leaves to the relying party
+func (p *OIDCProvider) validateIDToken(claims jwt.MapClaims, nonce string) (OIDCClaims, error) {
+	issuer, _ := claims.GetIssuer()
+	audience, _ := claims.GetAudience()
+	subject, _ := claims.GetSubject()
+	tokenNonce, _ := claims["nonce"].(string)
+
+	if issuer != p.config.Issuer || !slices.Contains(audience, p.config.ClientID) || subject == "" || tokenNonce != nonce {
+		return OIDCClaims{}, ErrInvalidIDToken
+	}
+
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+
+	// Some providers send email_verified as a string
+	var emailVerified bool
+	switch value := claims["email_verified"].(type) {
+	case bool:
+		emailVerified = value
+	case string:
+		emailVerified = value == "true"
+	}
+
+	return OIDCClaims{
+		Subject:       subject,
+		Email:         strings.ToLower(email),
+		EmailVerified: emailVerified,
+		Name:          name,
+	}, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return p.doJSON(req, target)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, target any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// NewPKCEVerifier returns a PKCE code verifier and its S256 challenge (RFC 7636)
+func NewPKCEVerifier() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "shop"
+	testRedirectURL = "https://shop.example/auth/callback"
+	testCode        = "code-123"
+)
+
+// mockProvider is an identity provider serving discovery, its JWKS and a token
+// endpoint that redeems testCode for an ID token with the claims of idToken
+type mockProvider struct {
+	server    *httptest.Server
+	keys      *KeyRing // published in the JWKS
+	signer    *KeyRing // signs ID tokens, keys unless a test swaps it
+	challenge string   // the code challenge the authorization request was made with
+	idToken   func(issuer string) jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("NewEphemeralSigningKey: %v", err)
+	}
+	mock := &mockProvider{keys: NewKeyRing(time.Hour, key)}
+	mock.signer = mock.keys
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := mock.keys.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, jwks)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != testCode ||
+			r.PostForm.Get("client_id") != testClientID ||
+			r.PostForm.Get("redirect_uri") != testRedirectURL ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != mock.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		idToken, err := mock.signer.Sign(mock.idToken(mock.server.URL))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// claims returns the ID token claims a provider sends for a successful login
+func claims(issuer string, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"nonce":          nonce,
+		"email":          "Jane.Doe@Example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+}
+
+// login runs the flow against mock the way OIDCHandler does and returns the claims
+func login(t *testing.T, mock *mockProvider) (OIDCClaims, error) {
+	t.Helper()
+
+	provider := NewOIDCProvider(OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      mock.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("NewPKCEVerifier: %v", err)
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(context.Background(), "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatalf("invalid authorization url %q: %v", authorizationURL, err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("client_id") != testClientID || query.Get("state") != "state-1" ||
+		query.Get("nonce") != "nonce-1" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization url %q", authorizationURL)
+	}
+	mock.challenge = query.Get("code_challenge")
+
+	return provider.Exchange(context.Background(), testCode, verifier, "nonce-1")
+}
+
+func TestOIDCProviderLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.idToken = func(issuer string) jwt.MapClaims { return claims(issuer, "nonce-1") }
+
+	got, err := login(t, mock)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := OIDCClaims{Subject: "subject-1", Email: "jane.doe@example.com", EmailVerified: true, Name: "Jane Doe"}
+	if got != want {
+		t.Fatalf("Exchange returned %+v, want %+v", got, want)
+	}
+}
+
+func TestOIDCProviderEmailVerifiedString(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.idToken = func(issuer string) jwt.MapClaims {
+		token := claims(issuer, "nonce-1")
+		token["email_verified"] = "false"
+		return token
+	}
+
+	got, err := login(t, mock)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got.EmailVerified {
+		t.Fatal("email_verified \"false\" was read as verified")
+	}
+}
+
+func TestOIDCProviderRejectsIDToken(t *testing.T) {
+	otherKey, err := NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("NewEphemeralSigningKey: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(mock *mockProvider, token jwt.MapClaims)
+	}{
+		{"wrong nonce", func(_ *mockProvider, token jwt.MapClaims) { token["nonce"] = "nonce-2" }},
+		{"missing nonce", func(_ *mockProvider, token jwt.MapClaims) { delete(token, "nonce") }},
+		{"wrong audience", func(_ *mockProvider, token jwt.MapClaims) { token["aud"] = "another-client" }},
+		{"wrong issuer", func(_ *mockProvider, token jwt.MapClaims) { token["iss"] = "https://evil.example" }},
+		{"missing subject", func(_ *mockProvider, token jwt.MapClaims) { delete(token, "sub") }},
+		{"expired", func(_ *mockProvider, token jwt.MapClaims) { token["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"unknown key", func(mock *mockProvider, _ jwt.MapClaims) { mock.signer = NewKeyRing(time.Hour, otherKey) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+			mock.idToken = func(issuer string) jwt.MapClaims {
+				token := claims(issuer, "nonce-1")
+				tt.modify(mock, token)
+				return token
+			}
+
+			if _, err := login(t, mock); !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Exchange returned %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderWrongCodeVerifier(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.idToken = func(issuer string) jwt.MapClaims { return claims(issuer, "nonce-1") }
+
+	provider := NewOIDCProvider(OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      mock.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+	_, challenge, _ := NewPKCEVerifier()
+	mock.challenge = challenge
+
+	if _, err := provider.Exchange(context.Background(), testCode, "not-the-verifier", "nonce-1"); err == nil {
+		t.Fatal("Exchange succeeded with a code verifier not matching the challenge")
+	}
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	mock := newMockProvider(t)
+
+	provider := NewOIDCProvider(OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      mock.server.URL + "/",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+
+	if _, err := provider.AuthorizationURL(context.Background(), "state-1", "nonce-1", "challenge"); err == nil {
+		t.Fatal("AuthorizationURL accepted a discovery document for another issuer")
+	}
+}
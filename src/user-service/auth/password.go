@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes is the longest password bcrypt hashes, it refuses longer ones
+const maxPasswordBytes = 72
+
+// minPersonalInfoLength is the shortest part of an email or name a password may not contain
+const minPersonalInfoLength = 3
+
+// breachPrefixLength is how many hex digits of a hash a breach range query reveals
+const breachPrefixLength = 5
+
+// Codes of the rules a password can break
+const (
+	PasswordTooShort         = "too_short"
+	PasswordTooLong          = "too_long"
+	PasswordTooFewClasses    = "too_few_character_classes"
+	PasswordContainsPersonal = "contains_personal_info"
+	PasswordBreached         = "breached"
+)
+
+// PasswordViolation is a rule a password breaks, with a message for people
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BreachedPasswords answers k-anonymity range queries over SHA-1 hashes of breached
+// passwords: given the first five hex digits of a hash, it returns the remaining
+// digits of every breached hash starting with them. The Pwned Passwords range API
+// has the same shape, so the password never has to leave the caller.
+type BreachedPasswords interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// PasswordPolicy decides which passwords users may choose and how they are hashed
+type PasswordPolicy struct {
+	MinLength int // in characters
+
+	// MinClasses is how many of lowercase letters, uppercase letters, digits and
+	// symbols a password must mix
+	MinClasses int
+
+	Breached BreachedPasswords // nil skips the breach check
+
+	// BcryptCost hashes new passwords. With RehashOnLogin, hashes of another cost
+	// are replaced when their user logs in, so a cost change reaches every account.
+	BcryptCost    int
+	RehashOnLogin bool
+}
+
+// Check returns the rules password breaks for the account with email and name
+func (p PasswordPolicy) Check(ctx context.Context, password string, email string, name string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d bytes long", maxPasswordBytes),
+		})
+	}
+	if characterClasses(password) < p.MinClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooFewClasses,
+			Message: fmt.Sprintf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses),
+		})
+	}
+	if containsPersonalInfo(password, email, name) {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordContainsPersonal,
+			Message: "password must not contain your email or name",
+		})
+	}
+
+	if p.Breached != nil {
+		breached, err := isBreached(ctx, p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "password appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// Hash hashes password with the cost of the policy
+func (p PasswordPolicy) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), p.cost())
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// NeedsRehash reports whether a verified hash should be replaced on login, because
+// it was made with another cost than the policy uses
+func (p PasswordPolicy) NeedsRehash(hash string) bool {
+	if !p.RehashOnLogin {
+		return false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost != p.cost()
+}
+
+func (p PasswordPolicy) cost() int {
+	if p.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return p.BcryptCost
+}
+
+// characterClasses counts the kinds of characters password mixes
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// containsPersonalInfo reports whether password contains the local part of email
+// or a word of name, ignoring case. Parts too short to matter are skipped.
+func containsPersonalInfo(password string, email string, name string) bool {
+	password = strings.ToLower(password)
+
+	localPart, _, _ := strings.Cut(email, "@")
+	parts := append(strings.Fields(name), localPart)
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBreached looks password up by the prefix of its SHA-1 hash only
+func isBreached(ctx context.Context, breached BreachedPasswords, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := breached.Range(ctx, hash[:breachPrefixLength])
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(suffixes, hash[breachPrefixLength:]), nil
+}
+
+// BreachedPasswordFile is a breached password corpus held in memory
+type BreachedPasswordFile struct {
+	ranges map[string][]string
+}
+
+// LoadBreachedPasswords reads a corpus in the format of the Pwned Passwords
+// downloads: one SHA-1 hash in hex per line, optionally followed by ":count". Blank
+// lines and lines starting with # are skipped.
+func LoadBreachedPasswords(path string) (*BreachedPasswordFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	corpus := &BreachedPasswordFile{ranges: make(map[string][]string)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(entry, ":")
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d: invalid SHA-1 hash", line)
+		}
+
+		hash = strings.ToUpper(hash)
+		prefix := hash[:breachPrefixLength]
+		corpus.ranges[prefix] = append(corpus.ranges[prefix], hash[breachPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return corpus, nil
+}
+
+// Range returns the suffixes of the breached hashes starting with prefix
+func (f *BreachedPasswordFile) Range(_ context.Context, prefix string) ([]string, error) {
+	return f.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Size returns how many hashes the corpus holds
+func (f *BreachedPasswordFile) Size() int {
+	size := 0
+	for _, suffixes := range f.ranges {
+		size += len(suffixes)
+	}
+	return size
+}
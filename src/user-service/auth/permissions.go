@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+)
+
+// DefaultPermission is a built-in permission and the built-in role seeded with it
+type DefaultPermission struct {
+	Name        string
+	Description string
+	Role        string
+}
+
+// DefaultPermissions are seeded once. Roles inherit from their parent, so each
+// permission is only given to the lowest role that needs it.
+var DefaultPermissions = []DefaultPermission{
+	{Name: auth.PermissionReviewWrite, Description: "Write and vote on product reviews", Role: auth.RoleCustomer},
+	{Name: auth.PermissionReviewModerate, Description: "Approve and reject product reviews", Role: auth.RoleEmployee},
+	{Name: auth.PermissionProductWrite, Description: "Create, update and delete products", Role: auth.RoleEmployee},
+	{Name: auth.PermissionCategoryWrite, Description: "Create, update and delete categories", Role: auth.RoleEmployee},
+	{Name: auth.PermissionBrandWrite, Description: "Create, update and delete brands", Role: auth.RoleEmployee},
+	{Name: auth.PermissionUserManage, Description: "Manage user accounts", Role: auth.RoleAdmin},
+	{Name: auth.PermissionRoleManage, Description: "Manage roles and their permissions", Role: auth.RoleAdmin},
+	{Name: auth.PermissionOAuthClientManage, Description: "Register and remove OAuth clients", Role: auth.RoleAdmin},
+	{Name: auth.PermissionServiceAccountManage, Description: "Manage service accounts and their API keys", Role: auth.RoleAdmin},
+	{Name: auth.PermissionPersonalDataManage, Description: "Export and erase the personal data services hold about users", Role: auth.RoleAdmin},
+	{Name: auth.PermissionMetricsRead, Description: "Read the operational metrics of services", Role: auth.RoleAdmin},
+	{Name: auth.PermissionOutboxManage, Description: "Republish and dismiss catalog events the relay gave up on", Role: auth.RoleAdmin},
+}
+
+// DefaultRoleParents is the built-in role hierarchy
+var DefaultRoleParents = map[string]string{
+	auth.RoleEmployee: auth.RoleCustomer,
+	auth.RoleAdmin:    auth.RoleEmployee,
+}
+
+// Grants are the roles a user holds, inherited ones included, and the permissions
+// those roles carry
+type Grants struct {
+	Roles       []string
+	Permissions []string
+}
+
+// HasRole reports whether role is among the grants
+func (g Grants) HasRole(role string) bool {
+	return slices.Contains(g.Roles, role)
+}
+
+// HasPermission reports whether permission is among the grants
+func (g Grants) HasPermission(permission string) bool {
+	return slices.Contains(g.Permissions, permission)
+}
+
+// ResolveGrants expands the primary and additional roles of user along the role
+// hierarchy. roles must hold every role with its permissions loaded.
+func ResolveGrants(user models.User, roles []models.Role) Grants {
+	byID := make(map[uuid.UUID]models.Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	assigned := []uuid.UUID{user.RoleID}
+	for _, role := range user.Roles {
+		assigned = append(assigned, role.ID)
+	}
+
+	var grants Grants
+	visited := make(map[uuid.UUID]bool)
+	for _, id := range assigned {
+		// Walk up to the root, stopping at roles already expanded so a cycle cannot loop
+		for current, found := byID[id]; found && !visited[current.ID]; {
+			visited[current.ID] = true
+			grants.Roles = append(grants.Roles, current.Name)
+			for _, permission := range current.Permissions {
+				if !slices.Contains(grants.Permissions, permission.Name) {
+					grants.Permissions = append(grants.Permissions, permission.Name)
+				}
+			}
+
+			if current.ParentID == nil {
+				break
+			}
+			current, found = byID[*current.ParentID]
+		}
+	}
+
+	slices.Sort(grants.Permissions)
+	return grants
+}
+
+// RoleDescendants returns the id of the role and of every role inheriting from it,
+// the roles a change to its permissions affects
+func RoleDescendants(roles []models.Role, id uuid.UUID) []uuid.UUID {
+	result := []uuid.UUID{id}
+	for i := 0; i < len(result); i++ {
+		for _, role := range roles {
+			if role.ParentID != nil && *role.ParentID == result[i] && !slices.Contains(result, role.ID) {
+				result = append(result, role.ID)
+			}
+		}
+	}
+	return result
+}
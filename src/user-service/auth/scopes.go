@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+// Scope is what an OAuth client can be granted. Every scope maps onto the role a
+// token holding it acts with and the permissions it carries, so a delegated token
+// never acts with more than its scopes allow.
+type Scope struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// Scopes clients can request
+var Scopes = []Scope{
+	{Name: "profile", Description: "Read your name and email address", Role: auth.RoleCustomer},
+	{Name: "reviews:write", Description: "Write product reviews on your behalf", Role: auth.RoleCustomer,
+		Permissions: []string{auth.PermissionReviewWrite}},
+	{Name: "catalog:write", Description: "Manage brands, categories and products", Role: auth.RoleEmployee,
+		Permissions: []string{auth.PermissionProductWrite, auth.PermissionCategoryWrite, auth.PermissionBrandWrite}},
+	// Lets a service erase and export user data without acting as an admin anywhere else
+	{Name: "privacy", Description: "Export and erase the personal data of users", Role: auth.RoleCustomer,
+		Permissions: []string{auth.PermissionPersonalDataManage}},
+	{Name: "admin", Description: "Full administrative access", Role: auth.RoleAdmin,
+		Permissions: []string{
+			auth.PermissionReviewWrite, auth.PermissionReviewModerate,
+			auth.PermissionProductWrite, auth.PermissionCategoryWrite, auth.PermissionBrandWrite,
+			auth.PermissionUserManage, auth.PermissionRoleManage, auth.PermissionOAuthClientManage,
+			auth.PermissionServiceAccountManage, auth.PermissionPersonalDataManage, auth.PermissionMetricsRead,
+			auth.PermissionOutboxManage,
+		}},
+}
+
+var roleRank = map[string]int{
+	auth.RoleCustomer: 1,
+	auth.RoleEmployee: 2,
+	auth.RoleAdmin:    3,
+}
+
+// FindScope returns the scope with name
+func FindScope(name string) (Scope, bool) {
+	index := slices.IndexFunc(Scopes, func(scope Scope) bool { return scope.Name == name })
+	if index < 0 {
+		return Scope{}, false
+	}
+	return Scopes[index], true
+}
+
+// ParseScopes splits a space separated scope parameter, dropping duplicates
+func ParseScopes(scope string) []string {
+	var scopes []string
+	for _, name := range strings.Fields(scope) {
+		if !slices.Contains(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+	return scopes
+}
+
+// AllowsScope reports whether a user with the grants may delegate scope. Users can
+// only delegate what they could do themselves: they hold the role of the scope and
+// every permission it carries.
+func (g Grants) AllowsScope(scope string) bool {
+	definition, found := FindScope(scope)
+	if !found || !g.HasRole(definition.Role) {
+		return false
+	}
+	return !slices.ContainsFunc(definition.Permissions, func(permission string) bool {
+		return !g.HasPermission(permission)
+	})
+}
+
+// ScopePermissions returns the permissions scopes carry
+func ScopePermissions(scopes []string) []string {
+	var permissions []string
+	for _, name := range scopes {
+		definition, _ := FindScope(name)
+		for _, permission := range definition.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions
+}
+
+// ScopeRole returns the role a token with scopes acts with, the highest role any of
+// them maps onto
+func ScopeRole(scopes []string) string {
+	role := auth.RoleCustomer
+	for _, name := range scopes {
+		if definition, found := FindScope(name); found && roleRank[definition.Role] > roleRank[role] {
+			role = definition.Role
+		}
+	}
+	return role
+}
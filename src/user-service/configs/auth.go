@@ -0,0 +1,220 @@
+package configs
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"time"
+
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/handler"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SetupKeyRing loads the signing keys and makes them the verifier of this service.
+// Keys are reloaded periodically, so a rotation only needs the manifest updated.
+func SetupKeyRing(cfg *Config) *auth.KeyRing {
+	var keys []auth.SigningKey
+
+	if cfg.Auth.KeysFile == "" {
+		if cfg.App.AppEnv == "production" {
+			log.Fatal("JWT_KEYS_FILE is required in production")
+		}
+
+		key, err := auth.NewEphemeralSigningKey()
+		if err != nil {
+			log.Fatalf("Error when generating signing key: %v", err)
+		}
+		log.Printf("JWT_KEYS_FILE not set, signing with ephemeral key %s", key.ID)
+		keys = append(keys, key)
+	} else {
+		loaded, err := auth.LoadSigningKeys(cfg.Auth.KeysFile)
+		if err != nil {
+			log.Fatalf("Error when loading signing keys: %v", err)
+		}
+		keys = loaded
+	}
+
+	ring := auth.NewKeyRing(auth.TokenRetention(), keys...)
+	if _, err := ring.Active(time.Now()); err != nil {
+		log.Fatalf("Error when loading signing keys: %v", err)
+	}
+
+	if cfg.Auth.KeysFile != "" {
+		go reloadKeyRing(ring, cfg.Auth.KeysFile, cfg.Auth.KeysReloadInterval)
+	}
+
+	sharedauth.SetVerifier(ring)
+	return ring
+}
+
+// SetupRevocationStore creates the access token revocation store and makes the
+// auth middleware consult it. Production requires redis: revocations kept in memory
+// never reach other instances or services.
+func SetupRevocationStore(cfg *Config) sharedauth.RevocationStore {
+	var store sharedauth.RevocationStore
+
+	if cfg.Revocation.Store != "redis" && cfg.App.AppEnv == "production" {
+		log.Fatal("REVOCATION_STORE=redis is required in production")
+	}
+
+	switch cfg.Revocation.Store {
+	case "redis":
+		client := redis.NewClient(&redis.Options{Addr: cfg.Revocation.RedisAddr})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Error when connecting to redis: %v", err)
+		}
+		store = sharedauth.NewRedisRevocationStore(client, auth.TokenRetention())
+	case "", "memory":
+		log.Print("REVOCATION_STORE is not redis, revoked access tokens are only rejected by this instance")
+		store = sharedauth.NewMemoryRevocationStore(auth.TokenRetention())
+	default:
+		log.Fatalf("Unknown revocation store %q", cfg.Revocation.Store)
+	}
+
+	sharedauth.SetRevocationStore(store)
+	return store
+}
+
+// SetupOIDCProviders loads the social login providers. Without OIDC_PROVIDERS_FILE
+// social login is disabled.
+func SetupOIDCProviders(cfg *Config) map[string]*auth.OIDCProvider {
+	if cfg.Auth.OIDCProvidersFile == "" {
+		return map[string]*auth.OIDCProvider{}
+	}
+
+	providers, err := auth.LoadOIDCProviders(cfg.Auth.OIDCProvidersFile)
+	if err != nil {
+		log.Fatalf("Error when loading oidc providers: %v", err)
+	}
+	return providers
+}
+
+// SetupSecretBox creates the box sealing TOTP secrets from MFA_ENCRYPTION_KEY. The
+// key must survive restarts, or every enrolled authenticator stops working.
+func SetupSecretBox(cfg *Config) *auth.SecretBox {
+	if cfg.MFA.EncryptionKey == "" {
+		if cfg.App.AppEnv == "production" {
+			log.Fatal("MFA_ENCRYPTION_KEY is required in production")
+		}
+
+		box, err := auth.NewEphemeralSecretBox()
+		if err != nil {
+			log.Fatalf("Error when generating mfa encryption key: %v", err)
+		}
+		log.Print("MFA_ENCRYPTION_KEY not set, TOTP enrolments will not survive a restart")
+		return box
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cfg.MFA.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Error when decoding MFA_ENCRYPTION_KEY: %v", err)
+	}
+
+	box, err := auth.NewSecretBox(key)
+	if err != nil {
+		log.Fatalf("Error when loading MFA_ENCRYPTION_KEY: %v", err)
+	}
+	return box
+}
+
+// SetupLoginProtection builds the lockout policies of the login endpoint. Email
+// addresses back off after a few failures and lock at LOGIN_MAX_ATTEMPTS; client IPs get more
+// room, as many users can share one address.
+func SetupLoginProtection(cfg *Config, attempts repository.ILoginAttemptRepository, notifier handler.LockoutNotifier) handler.LoginProtection {
+	account := auth.LockoutPolicy{
+		FreeAttempts:    min(3, cfg.Login.MaxAttempts-1),
+		MaxAttempts:     cfg.Login.MaxAttempts,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutDuration: cfg.Login.LockoutDuration,
+		Window:          time.Hour,
+	}
+
+	ip := auth.LockoutPolicy{
+		FreeAttempts:    cfg.Login.IPMaxAttempts / 2,
+		MaxAttempts:     cfg.Login.IPMaxAttempts,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: cfg.Login.LockoutDuration,
+		Window:          time.Hour,
+	}
+
+	return handler.LoginProtection{
+		Account:  account,
+		Attempts: attempts,
+		IP:       auth.NewAttemptLimiter(ip),
+		Notifier: notifier,
+	}
+}
+
+// SetupPasswordResetProtection builds the cooldowns of the forgot-password endpoint.
+// An address waits PASSWORD_RESET_COOLDOWN after each request, doubling up to an
+// hour; client IPs get PASSWORD_RESET_IP_MAX_REQUESTS requests before backing off.
+func SetupPasswordResetProtection(cfg *Config, requests repository.IPasswordResetRequestRepository) handler.PasswordResetProtection {
+	email := auth.LockoutPolicy{
+		BaseDelay: cfg.PasswordReset.Cooldown,
+		MaxDelay:  time.Hour,
+		Window:    24 * time.Hour,
+	}
+
+	ip := auth.LockoutPolicy{
+		FreeAttempts: cfg.PasswordReset.IPMaxRequests,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+
+	return handler.PasswordResetProtection{
+		Email:    email,
+		Requests: requests,
+		IP:       auth.NewAttemptLimiter(ip),
+	}
+}
+
+// SetupPasswordPolicy builds the password policy, loading the breached password
+// corpus of PASSWORD_BREACHED_FILE when one is configured
+func SetupPasswordPolicy(cfg *Config) auth.PasswordPolicy {
+	if cfg.Password.BcryptCost < bcrypt.MinCost || cfg.Password.BcryptCost > bcrypt.MaxCost {
+		log.Fatalf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	policy := auth.PasswordPolicy{
+		MinLength:     cfg.Password.MinLength,
+		MinClasses:    cfg.Password.MinClasses,
+		BcryptCost:    cfg.Password.BcryptCost,
+		RehashOnLogin: cfg.Password.RehashOnLogin,
+	}
+
+	if cfg.Password.BreachedFile == "" {
+		log.Print("PASSWORD_BREACHED_FILE not set, passwords are not checked against breaches")
+		return policy
+	}
+
+	breached, err := auth.LoadBreachedPasswords(cfg.Password.BreachedFile)
+	if err != nil {
+		log.Fatalf("Error when loading breached passwords: %v", err)
+	}
+	log.Printf("Loaded %d breached password hashes", breached.Size())
+
+	policy.Breached = breached
+	return policy
+}
+
+func reloadKeyRing(ring *auth.KeyRing, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		keys, err := auth.LoadSigningKeys(path)
+		if err != nil {
+			// Keep signing with the keys already loaded
+			log.Printf("Error when reloading signing keys: %v", err)
+			continue
+		}
+		ring.Replace(keys)
+	}
+}
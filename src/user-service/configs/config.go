@@ -3,22 +3,106 @@ package configs
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 type AppConfig struct {
-	AppEnv  string
-	AppPort string
+	AppEnv                      string
+	AppPort                     string
+	RefreshTokenCleanupInterval time.Duration
+}
+
+// AuthConfig locates the token signing keys and the social login providers
+type AuthConfig struct {
+	KeysFile           string // JSON manifest of the signing keys, see auth.LoadSigningKeys
+	KeysReloadInterval time.Duration
+	OIDCProvidersFile  string // JSON list of OpenID Connect providers, see auth.LoadOIDCProviders
+}
+
+// RevocationConfig selects where revoked access tokens are recorded. Other
+// services only see revocations through the redis store.
+type RevocationConfig struct {
+	Store     string // memory or redis
+	RedisAddr string
+}
+
+// MailConfig selects how emails are delivered
+type MailConfig struct {
+	Driver       string // smtp, file or console
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	FilePath     string // file driver only
+}
+
+// PasswordResetConfig configures the links mailed by the forgot-password flow
+type PasswordResetConfig struct {
+	URL           string
+	TTL           time.Duration
+	Cooldown      time.Duration // between two links mailed to one address
+	IPMaxRequests int           // requests a client IP makes before it has to wait
+}
+
+// EmailVerificationConfig configures the links mailed on registration
+type EmailVerificationConfig struct {
+	URL      string
+	TTL      time.Duration
+	Required bool // block login until the email is verified
+}
+
+// LoginConfig configures brute-force protection of the login endpoint
+type LoginConfig struct {
+	MaxAttempts     int // failed logins that lock an account
+	LockoutDuration time.Duration
+	IPMaxAttempts   int // failed logins that block a client IP
+}
+
+// PasswordConfig configures the passwords users may choose and how they are hashed
+type PasswordConfig struct {
+	MinLength     int
+	MinClasses    int    // of lowercase letters, uppercase letters, digits and symbols
+	BreachedFile  string // SHA-1 hashes of breached passwords, see auth.LoadBreachedPasswords
+	BcryptCost    int
+	RehashOnLogin bool // rehash passwords of another cost on login
+}
+
+// PrivacyConfig configures data-subject requests: exports and account deletion
+type PrivacyConfig struct {
+	DeletionGracePeriod time.Duration // between a deletion request and the erasure
+	ErasureInterval     time.Duration
+	Hooks               string // services holding personal data, see privacy.ParseHooks
+	HookAPIKey          string // API key the hooks are called with
+}
+
+// MFAConfig configures TOTP two-factor authentication
+type MFAConfig struct {
+	EncryptionKey string // base64 AES-256 key sealing the TOTP secrets
+	Issuer        string // account issuer shown by authenticator apps
 }
 
 type Config struct {
-	App      AppConfig
-	Database *gorm.DB
+	App               AppConfig
+	Auth              AuthConfig
+	Revocation        RevocationConfig
+	Mail              MailConfig
+	PasswordReset     PasswordResetConfig
+	EmailVerification EmailVerificationConfig
+	Login             LoginConfig
+	Password          PasswordConfig
+	Privacy           PrivacyConfig
+	MFA               MFAConfig
+	Database          *gorm.DB
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,16 +116,117 @@ func LoadConfig() (*Config, error) {
 	database := SetupDatabase()
 
 	appConfig := AppConfig{
-		AppEnv:  os.Getenv("APP_ENV"),
-		AppPort: os.Getenv("USER_SERVICE_PORT"),
+		AppEnv:                      os.Getenv("APP_ENV"),
+		AppPort:                     os.Getenv("USER_SERVICE_PORT"),
+		RefreshTokenCleanupInterval: getEnvMinutes("REFRESH_TOKEN_CLEANUP_INTERVAL", 60),
+	}
+
+	authConfig := AuthConfig{
+		KeysFile:           os.Getenv("JWT_KEYS_FILE"),
+		KeysReloadInterval: getEnvMinutes("JWT_KEYS_RELOAD_INTERVAL", 5),
+		OIDCProvidersFile:  os.Getenv("OIDC_PROVIDERS_FILE"),
+	}
+
+	revocationConfig := RevocationConfig{
+		Store:     os.Getenv("REVOCATION_STORE"),
+		RedisAddr: os.Getenv("REDIS_ADDR"),
+	}
+
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	mailConfig := MailConfig{
+		Driver:       os.Getenv("MAIL_DRIVER"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		From:         os.Getenv("MAIL_FROM"),
+		FilePath:     os.Getenv("MAIL_FILE_PATH"),
+	}
+
+	passwordResetConfig := PasswordResetConfig{
+		URL:           os.Getenv("PASSWORD_RESET_URL"),
+		TTL:           getEnvMinutes("PASSWORD_RESET_TTL", 30),
+		Cooldown:      getEnvMinutes("PASSWORD_RESET_COOLDOWN", 1),
+		IPMaxRequests: getEnvInt("PASSWORD_RESET_IP_MAX_REQUESTS", 10),
+	}
+
+	emailVerificationConfig := EmailVerificationConfig{
+		URL:      os.Getenv("EMAIL_VERIFICATION_URL"),
+		TTL:      getEnvMinutes("EMAIL_VERIFICATION_TTL", 24*60),
+		Required: os.Getenv("EMAIL_VERIFICATION_REQUIRED") == "true",
+	}
+
+	loginConfig := LoginConfig{
+		MaxAttempts:     getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LockoutDuration: getEnvMinutes("LOGIN_LOCKOUT_DURATION", 15),
+		IPMaxAttempts:   getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+	}
+
+	passwordConfig := PasswordConfig{
+		MinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 10),
+		MinClasses:    getEnvInt("PASSWORD_MIN_CHARACTER_CLASSES", 3),
+		BreachedFile:  os.Getenv("PASSWORD_BREACHED_FILE"),
+		BcryptCost:    getEnvInt("PASSWORD_BCRYPT_COST", bcrypt.DefaultCost),
+		RehashOnLogin: os.Getenv("PASSWORD_REHASH_ON_LOGIN") == "true",
+	}
+
+	privacyConfig := PrivacyConfig{
+		DeletionGracePeriod: getEnvDays("ACCOUNT_DELETION_GRACE_PERIOD", 30),
+		ErasureInterval:     getEnvMinutes("ACCOUNT_ERASURE_INTERVAL", 60),
+		Hooks:               os.Getenv("PRIVACY_HOOKS"),
+		HookAPIKey:          os.Getenv("PRIVACY_HOOK_API_KEY"),
+	}
+
+	mfaConfig := MFAConfig{
+		EncryptionKey: os.Getenv("MFA_ENCRYPTION_KEY"),
+		Issuer:        os.Getenv("MFA_ISSUER"),
+	}
+	if mfaConfig.Issuer == "" {
+		mfaConfig.Issuer = "Ecommerce"
 	}
 
 	return &Config{
-		App:      appConfig,
-		Database: database,
+		App:               appConfig,
+		Auth:              authConfig,
+		Revocation:        revocationConfig,
+		Mail:              mailConfig,
+		PasswordReset:     passwordResetConfig,
+		EmailVerification: emailVerificationConfig,
+		Login:             loginConfig,
+		Password:          passwordConfig,
+		Privacy:           privacyConfig,
+		MFA:               mfaConfig,
+		Database:          database,
 	}, nil
 }
 
+// getEnvInt reads a positive number, falling back on missing or bad values
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// getEnvMinutes reads a duration given in minutes, falling back on missing or bad values
+func getEnvMinutes(key string, fallback int) time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || minutes <= 0 {
+		minutes = fallback
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// getEnvDays reads a duration given in days, falling back on missing or bad values
+func getEnvDays(key string, fallback int) time.Duration {
+	days, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || days <= 0 {
+		days = fallback
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 func SetupDatabase() *gorm.DB {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=require TimeZone=Asia/Ho_Chi_Minh",
@@ -62,27 +247,95 @@ func SetupDatabase() *gorm.DB {
 
 func InitDatabase(db *gorm.DB) {
 
-	err := db.AutoMigrate(&models.User{}, &models.Role{}, &models.RefreshToken{})
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		panic(fmt.Sprintf("failed to migrate: %v", err))
+	}
+	if err := runMigrations(db, preMigrations); err != nil {
+		panic(fmt.Sprintf("failed to migrate: %v", err))
+	}
+
+	err := db.AutoMigrate(
+		&models.User{},
+		&models.Role{},
+		&models.Permission{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.LoginAttempt{},
+		&models.PasswordResetRequest{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OIDCAuthRequest{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorizationCode{},
+		&models.OAuthConsent{},
+		&models.ServiceAccount{},
+		&models.APIKey{},
+		&models.Address{},
+	)
 
 	if err != nil {
 		panic(fmt.Sprintf("failed to migrate: %v", err))
 	}
 
+	if err := runMigrations(db, postMigrations); err != nil {
+		panic(fmt.Sprintf("failed to migrate: %v", err))
+	}
+
 	SeedDatabase(db)
 }
 
 func SeedDatabase(db *gorm.DB) {
 	var count int64
 	db.Model(&models.Role{}).Count(&count)
-	if count > 0 {
-		return
+	if count == 0 {
+		roles := []models.Role{
+			{ID: uuid.New(), Name: "CUSTOMER", Description: "Default customer role"},
+			{ID: uuid.New(), Name: "EMPLOYEE", Description: "Employee role with limited access"},
+			{ID: uuid.New(), Name: "ADMIN", Description: "Administrator role with full access"},
+		}
+
+		db.Create(roles)
+	}
+
+	seedPermissions(db)
+}
+
+// seedPermissions creates the built-in permissions missing from the database and
+// gives each to its default role. The first run also links the built-in role
+// hierarchy; changes made through the API afterwards are left alone.
+func seedPermissions(db *gorm.DB) {
+	var count int64
+	db.Model(&models.Permission{}).Count(&count)
+	firstRun := count == 0
+
+	var roles []models.Role
+	db.Find(&roles)
+
+	byName := make(map[string]*models.Role, len(roles))
+	for i := range roles {
+		byName[roles[i].Name] = &roles[i]
 	}
 
-	roles := []models.Role{
-		{ID: uuid.New(), Name: "CUSTOMER", Description: "Default customer role"},
-		{ID: uuid.New(), Name: "EMPLOYEE", Description: "Employee role with limited access"},
-		{ID: uuid.New(), Name: "ADMIN", Description: "Administrator role with full access"},
+	if firstRun {
+		for child, parent := range auth.DefaultRoleParents {
+			role, parentRole := byName[child], byName[parent]
+			if role != nil && parentRole != nil && role.ParentID == nil {
+				db.Model(role).Update("parent_id", parentRole.ID)
+			}
+		}
 	}
 
-	db.Create(roles)
+	for _, definition := range auth.DefaultPermissions {
+		permission := models.Permission{Name: definition.Name, Description: definition.Description}
+		result := db.Where(models.Permission{Name: definition.Name}).FirstOrCreate(&permission)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		if role := byName[definition.Role]; role != nil {
+			db.Model(role).Association("Permissions").Append(&permission)
+		}
+	}
 }
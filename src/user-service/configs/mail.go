@@ -0,0 +1,45 @@
+package configs
+
+import (
+	"log"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+)
+
+// SetupMailer creates the mailer selected by MAIL_DRIVER. Without a driver emails
+// are printed to the console, which is only allowed outside production.
+func SetupMailer(cfg *Config) mailer.Mailer {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" || cfg.Mail.SMTPPort == 0 || cfg.Mail.From == "" {
+			log.Fatal("SMTP_HOST, SMTP_PORT and MAIL_FROM are required by the smtp mail driver")
+		}
+		return mailer.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	case "file":
+		return mailer.NewFileMailer(cfg.Mail.FilePath)
+	case "", "console":
+		if cfg.App.AppEnv == "production" {
+			log.Fatal("MAIL_DRIVER is required in production")
+		}
+		return mailer.NewFileMailer("")
+	default:
+		log.Fatalf("Unknown mail driver %q", cfg.Mail.Driver)
+		return nil
+	}
+}
+
+// passwordResetURL is the page reset links point to, defaulting to the local frontend
+func passwordResetURL(cfg *Config) string {
+	if cfg.PasswordReset.URL == "" {
+		return "http://localhost:3000/reset-password"
+	}
+	return cfg.PasswordReset.URL
+}
+
+// emailVerificationURL is the page verification links point to, defaulting to the local frontend
+func emailVerificationURL(cfg *Config) string {
+	if cfg.EmailVerification.URL == "" {
+		return "http://localhost:3000/verify-email"
+	}
+	return cfg.EmailVerification.URL
+}
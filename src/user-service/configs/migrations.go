@@ -0,0 +1,119 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is a schema or data change AutoMigrate cannot make by itself, like a
+// backfill, or a NOT NULL column added to a table that already holds rows. Each
+// runs once, in its own transaction, and is recorded in schema_migrations.
+type migration struct {
+	ID  string
+	Run func(tx *gorm.DB) error
+}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	ID        string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations run before AutoMigrate, preparing existing tables for the new columns
+var preMigrations = []migration{
+	{ID: "reset_unhashed_refresh_tokens", Run: resetUnhashedRefreshTokens},
+}
+
+// Migrations run after AutoMigrate, filling the new columns
+var postMigrations = []migration{
+	{ID: "lowercase_user_emails", Run: lowercaseUserEmails},
+	{ID: "backfill_sessions", Run: backfillSessions},
+	{ID: "backfill_email_verified_at", Run: backfillEmailVerifiedAt},
+}
+
+// runMigrations applies the migrations not recorded yet, in order
+func runMigrations(db *gorm.DB, migrations []migration) error {
+	for _, m := range migrations {
+		var applied int64
+		if err := db.Model(&schemaMigration{}).Where("id = ?", m.ID).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// resetUnhashedRefreshTokens empties refresh_tokens while it still has the first
+// schema, one raw JWT per row with no user, family or expiry. Those rows would be
+// read as hashes and block the NOT NULL columns, and cannot be rotated anyway, so
+// their users simply sign in again.
+func resetUnhashedRefreshTokens(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable("refresh_tokens") || tx.Migrator().HasColumn("refresh_tokens", "family_id") {
+		return nil
+	}
+	return tx.Exec("TRUNCATE TABLE refresh_tokens").Error
+}
+
+// lowercaseUserEmails stores emails lowercase, as registration now does, and indexes
+// the case-insensitive lookup. Accounts whose email only differs by case from
+// another one are left alone for an admin to merge.
+func lowercaseUserEmails(tx *gorm.DB) error {
+	if err := tx.Exec(`
+		UPDATE users SET email = LOWER(email)
+		WHERE email <> LOWER(email)
+		AND NOT EXISTS (
+			SELECT 1 FROM users other
+			WHERE other.id <> users.id AND LOWER(other.email) = LOWER(users.email)
+		)`).Error; err != nil {
+		return err
+	}
+	return tx.Exec("CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error
+}
+
+// backfillSessions records a session for every active first-party refresh token
+// family started before sessions were, so users can see and revoke it. Only the
+// active token of a family is left, it holds the device and user agent; the device
+// name and IP address were never recorded.
+func backfillSessions(tx *gorm.DB) error {
+	return tx.Exec(`
+		INSERT INTO sessions (id, user_id, device_id, device_name, user_agent, ip_address, created_at, last_used_at)
+		SELECT DISTINCT ON (t.family_id)
+			t.family_id, t.user_id, COALESCE(t.device_id, ''), '', COALESCE(t.user_agent, ''), '',
+			(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id),
+			t.created_at
+		FROM refresh_tokens t
+		WHERE COALESCE(t.client_id, '') = ''
+		AND t.revoked_at IS NULL
+		AND t.expires_at > NOW()
+		AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = t.family_id)
+		ORDER BY t.family_id, t.created_at DESC`).Error
+}
+
+// backfillEmailVerifiedAt marks the emails of accounts registered before email
+// verification existed as verified, so requiring verification does not lock them
+// out. Accounts that were ever sent a verification link registered after it and
+// keep their state.
+func backfillEmailVerifiedAt(tx *gorm.DB) error {
+	return tx.Exec(`
+		UPDATE users SET email_verified_at = created_at
+		WHERE email_verified_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM email_verification_tokens t WHERE t.user_id = users.id)`).Error
+}
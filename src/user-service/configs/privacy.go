@@ -0,0 +1,26 @@
+package configs
+
+import (
+	"log"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/privacy"
+)
+
+// SetupPrivacyHooks creates the client of the services listed in PRIVACY_HOOKS, which
+// export and erase the personal data they hold. Without hooks only the data of this
+// service is covered, which is only allowed outside production.
+func SetupPrivacyHooks(cfg *Config) *privacy.Hooks {
+	hooks, err := privacy.ParseHooks(cfg.Privacy.Hooks)
+	if err != nil {
+		log.Fatalf("Invalid PRIVACY_HOOKS: %v", err)
+	}
+
+	if len(hooks) == 0 && cfg.App.AppEnv == "production" {
+		log.Fatal("PRIVACY_HOOKS is required in production")
+	}
+	if len(hooks) > 0 && cfg.Privacy.HookAPIKey == "" {
+		log.Fatal("PRIVACY_HOOK_API_KEY is required by PRIVACY_HOOKS")
+	}
+
+	return privacy.NewHooks(hooks, cfg.Privacy.HookAPIKey)
+}
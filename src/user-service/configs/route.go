@@ -1,11 +1,14 @@
 package configs
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/handler"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/job"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
 )
 
@@ -24,20 +27,92 @@ func SetupRoutes(router *gin.Engine, cfg *Config) {
 	})
 
 	roleRepo := repository.NewRoleRepository(cfg.Database)
+	permissionRepo := repository.NewPermissionRepository(cfg.Database)
+	addressRepo := repository.NewAddressRepository(cfg.Database)
 	userRepo := repository.NewUserRepository(cfg.Database)
 	refreshToken := repository.NewRefreshTokenRepository(cfg.Database)
+	session := repository.NewSessionRepository(cfg.Database)
+	keyRing := SetupKeyRing(cfg)
+	revocations := SetupRevocationStore(cfg)
+	passwordResetToken := repository.NewPasswordResetTokenRepository(cfg.Database)
+	emailVerificationToken := repository.NewEmailVerificationTokenRepository(cfg.Database)
+	recoveryCode := repository.NewRecoveryCodeRepository(cfg.Database)
+	secretBox := SetupSecretBox(cfg)
+	userIdentity := repository.NewUserIdentityRepository(cfg.Database)
+	oidcAuthRequest := repository.NewOIDCAuthRequestRepository(cfg.Database)
+	oidcProviders := SetupOIDCProviders(cfg)
+	oauthClient := repository.NewOAuthClientRepository(cfg.Database)
+	oauthAuthorizationCode := repository.NewOAuthAuthorizationCodeRepository(cfg.Database)
+	oauthConsent := repository.NewOAuthConsentRepository(cfg.Database)
+	serviceAccount := repository.NewServiceAccountRepository(cfg.Database)
+	apiKey := repository.NewAPIKeyRepository(cfg.Database)
+	loginAttempt := repository.NewLoginAttemptRepository(cfg.Database)
+	passwordResetRequest := repository.NewPasswordResetRequestRepository(cfg.Database)
+	apiKeyVerifier := handler.NewAPIKeyVerifier(apiKey, serviceAccount, userRepo, roleRepo)
+	mail := SetupMailer(cfg)
+	loginProtection := SetupLoginProtection(cfg, loginAttempt, handler.NewMailLockoutNotifier(mail))
+	passwordPolicy := SetupPasswordPolicy(cfg)
+	privacyHooks := SetupPrivacyHooks(cfg)
+
+	sharedauth.SetAPIKeyVerifier(apiKeyVerifier)
+
+	go job.NewRefreshTokenCleanupJob(refreshToken, session, loginAttempt, passwordResetRequest, cfg.App.RefreshTokenCleanupInterval).Start(context.Background())
+	go job.NewAccountErasureJob(userRepo, revocations, privacyHooks, cfg.Privacy.ErasureInterval).Start(context.Background())
+
+	handler.RegisterJWKSRoutes(router, keyRing)
+	handler.RegisterOAuthRoutes(router.Group("/oauth"), oauthClient, oauthAuthorizationCode, oauthConsent, userRepo, roleRepo, refreshToken, keyRing, revocations)
 
 	v1 := router.Group("/api/v1")
 	{
 		auth := v1.Group("/auth")
 		{
 
-			handler.RegisterAuthRoutes(auth, userRepo, roleRepo, refreshToken)
+			emailVerification := handler.EmailVerificationOptions{
+				URL:      emailVerificationURL(cfg),
+				TTL:      cfg.EmailVerification.TTL,
+				Required: cfg.EmailVerification.Required,
+			}
+
+			handler.RegisterAuthRoutes(auth, userRepo, roleRepo, refreshToken, session, emailVerificationToken, recoveryCode, keyRing, secretBox, revocations, mail, emailVerification, loginProtection, passwordPolicy)
+			handler.RegisterEmailVerificationRoutes(auth, userRepo, emailVerificationToken, mail, emailVerification)
+			handler.RegisterMFARoutes(auth.Group("/mfa"), userRepo, roleRepo, recoveryCode, session, keyRing, secretBox, cfg.MFA.Issuer, loginProtection)
+			handler.RegisterOIDCRoutes(auth.Group("/oidc"), oidcProviders, userRepo, roleRepo, userIdentity, oidcAuthRequest, refreshToken, session, revocations, keyRing)
+			handler.RegisterPasswordResetRoutes(auth, userRepo, passwordResetToken, refreshToken, revocations, mail, handler.PasswordResetOptions{
+				URL: passwordResetURL(cfg),
+				TTL: cfg.PasswordReset.TTL,
+			}, SetupPasswordResetProtection(cfg, passwordResetRequest), passwordPolicy)
+		}
+
+		users := v1.Group("/users")
+		{
+			handler.RegisterUserRoutes(users, userRepo, roleRepo, refreshToken, revocations)
+			handler.RegisterAddressRoutes(users.Group("/me/addresses"), addressRepo)
+			handler.RegisterPrivacyRoutes(users, userRepo, addressRepo, session, userIdentity, oauthConsent, apiKey, recoveryCode, secretBox, privacyHooks, mail, cfg.Privacy.DeletionGracePeriod, loginProtection)
+		}
+
+		oauth := v1.Group("/oauth")
+		{
+			handler.RegisterOAuthClientRoutes(oauth, oauthClient, oauthConsent, refreshToken)
 		}
 
 		roles := v1.Group("/roles")
 		{
-			handler.RegisterRoleRoutes(roles, roleRepo, userRepo)
+			handler.RegisterRoleRoutes(roles, roleRepo, permissionRepo, userRepo, revocations)
+		}
+
+		permissions := v1.Group("/permissions")
+		{
+			handler.RegisterPermissionRoutes(permissions, permissionRepo)
+		}
+
+		apiKeys := v1.Group("/api-keys")
+		{
+			handler.RegisterAPIKeyRoutes(apiKeys, apiKey, roleRepo, userRepo, apiKeyVerifier)
+		}
+
+		serviceAccounts := v1.Group("/service-accounts")
+		{
+			handler.RegisterServiceAccountRoutes(serviceAccounts, serviceAccount, apiKey, roleRepo)
 		}
 
 	}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
+)
+
+// countryVietnam is the country whose addresses use administrative divisions
+const countryVietnam = "VN"
+
+var (
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+	// Vietnamese mobile numbers start with 3, 5, 7, 8 or 9 and landlines with 2 after
+	// the trunk prefix 0 or the country code 84
+	vietnamPhonePattern = regexp.MustCompile(`^(?:\+?84|0)([35789]\d{8}|2\d{9})$`)
+
+	// E.164: a country code and at most 15 digits in total
+	e164Pattern = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// AddressRequest is the body of address create and update requests
+type AddressRequest struct {
+	Label             string `json:"label" binding:"max=50"`
+	RecipientName     string `json:"recipientName" binding:"required,max=100"`
+	Phone             string `json:"phone" binding:"required,max=30"`
+	CountryCode       string `json:"countryCode" binding:"max=2"` // defaults to VN
+	AddressLine1      string `json:"addressLine1" binding:"required,max=255"`
+	AddressLine2      string `json:"addressLine2" binding:"max=255"`
+	Province          string `json:"province" binding:"max=100"`
+	District          string `json:"district" binding:"max=100"`
+	Ward              string `json:"ward" binding:"max=100"`
+	City              string `json:"city" binding:"max=100"`
+	State             string `json:"state" binding:"max=100"`
+	PostalCode        string `json:"postalCode" binding:"max=20"`
+	IsDefaultShipping bool   `json:"isDefaultShipping"`
+	IsDefaultBilling  bool   `json:"isDefaultBilling"`
+}
+
+// toAddress validates the request and returns the address it describes
+func (r AddressRequest) toAddress() (models.Address, error) {
+	country := strings.ToUpper(strings.TrimSpace(r.CountryCode))
+	if country == "" {
+		country = countryVietnam
+	}
+	if !countryCodePattern.MatchString(country) {
+		return models.Address{}, errors.New("countryCode must be an ISO 3166-1 alpha-2 code")
+	}
+
+	phone, err := normalizePhone(country, r.Phone)
+	if err != nil {
+		return models.Address{}, err
+	}
+
+	address := models.Address{
+		Label:             strings.TrimSpace(r.Label),
+		RecipientName:     strings.TrimSpace(r.RecipientName),
+		Phone:             phone,
+		CountryCode:       country,
+		AddressLine1:      strings.TrimSpace(r.AddressLine1),
+		AddressLine2:      strings.TrimSpace(r.AddressLine2),
+		IsDefaultShipping: r.IsDefaultShipping,
+		IsDefaultBilling:  r.IsDefaultBilling,
+	}
+
+	if country == countryVietnam {
+		address.Province = strings.TrimSpace(r.Province)
+		address.District = strings.TrimSpace(r.District)
+		address.Ward = strings.TrimSpace(r.Ward)
+		if address.Province == "" || address.District == "" || address.Ward == "" {
+			return models.Address{}, errors.New("province, district and ward are required for addresses in Vietnam")
+		}
+	} else {
+		address.City = strings.TrimSpace(r.City)
+		address.State = strings.TrimSpace(r.State)
+		address.PostalCode = strings.TrimSpace(r.PostalCode)
+		if address.City == "" {
+			return models.Address{}, errors.New("city is required")
+		}
+	}
+
+	if address.RecipientName == "" || address.AddressLine1 == "" {
+		return models.Address{}, errors.New("recipientName and addressLine1 cannot be blank")
+	}
+	return address, nil
+}
+
+// normalizePhone validates a phone number and returns it in E.164. Numbers in
+// Vietnam may be given in the national format, like 0912 345 678.
+func normalizePhone(country string, phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+
+	if country == countryVietnam {
+		if match := vietnamPhonePattern.FindStringSubmatch(phone); match != nil {
+			return "+84" + match[1], nil
+		}
+		if !strings.HasPrefix(phone, "+") || strings.HasPrefix(phone, "+84") {
+			return "", errors.New("invalid Vietnamese phone number")
+		}
+	}
+
+	if !e164Pattern.MatchString(phone) {
+		return "", errors.New("phone must be in international format, like +14155550123")
+	}
+	return phone, nil
+}
+
+type AddressHandler struct {
+	addressRepo repository.IAddressRepository
+}
+
+func NewAddressHandler(addressRepo repository.IAddressRepository) *AddressHandler {
+	return &AddressHandler{
+		addressRepo: addressRepo,
+	}
+}
+
+func RegisterAddressRoutes(rg *gin.RouterGroup, addressRepo repository.IAddressRepository) {
+	handler := NewAddressHandler(addressRepo)
+
+	rg.Use(authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	rg.GET("", handler.GetAddresses)
+	rg.POST("", handler.AddAddress)
+	rg.GET("/:id", middleware.UUIDParamMiddleware("id"), handler.GetAddressById)
+	rg.PUT("/:id", middleware.UUIDParamMiddleware("id"), handler.UpdateAddress)
+	rg.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteAddress)
+}
+
+// GET /users/me/addresses
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	addresses, err := h.addressRepo.GetByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch addresses"})
+		return
+	}
+	c.JSON(http.StatusOK, addresses)
+}
+
+// POST /users/me/addresses
+func (h *AddressHandler) AddAddress(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	address, err := req.toAddress()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address.ID = uuid.New()
+	address.UserID = userID
+	if err := h.addressRepo.Create(c.Request.Context(), &address); err != nil {
+		if errors.Is(err, repository.ErrAddressBookFull) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create address"})
+		return
+	}
+	c.JSON(http.StatusCreated, address)
+}
+
+// GET /users/me/addresses/:id
+func (h *AddressHandler) GetAddressById(c *gin.Context) {
+	address, ok := h.ownAddress(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, address)
+}
+
+// PUT /users/me/addresses/:id
+// UpdateAddress replaces the address. The response shows the defaults it kept,
+// the only address of a user cannot give them up.
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, ok := h.ownAddress(c)
+	if !ok {
+		return
+	}
+
+	address, err := req.toAddress()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address.ID = current.ID
+	address.UserID = current.UserID
+	address.CreatedAt = current.CreatedAt
+	if err := h.addressRepo.Update(c.Request.Context(), &address); err != nil {
+		if errors.Is(err, repository.ErrAddressNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
+		return
+	}
+	c.JSON(http.StatusOK, address)
+}
+
+// DELETE /users/me/addresses/:id
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	id := c.MustGet("id").(uuid.UUID)
+	if err := h.addressRepo.DeleteForUser(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, repository.ErrAddressNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete address"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ownAddress loads the address named by the id path parameter, when it belongs to
+// the authenticated user
+func (h *AddressHandler) ownAddress(c *gin.Context) (*models.Address, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	id := c.MustGet("id").(uuid.UUID)
+	address, err := h.addressRepo.GetForUser(c.Request.Context(), userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch address"})
+		return nil, false
+	}
+	if address == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		return nil, false
+	}
+	return address, true
+}
@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
+)
+
+// apiKeyTouchInterval is how often the last use of a busy key is written
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyRequest is the body of API key create requests
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"` // never expires when empty
+}
+
+// APIKeyResponse is an API key as listed to its owner, without the key itself
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Active     bool       `json:"active"`
+}
+
+// CreatedAPIKeyResponse is returned once, when the key is created
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+		Active:     key.IsActive(time.Now()),
+	}
+}
+
+func newAPIKeyResponses(keys []models.APIKey) []APIKeyResponse {
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, newAPIKeyResponse(key))
+	}
+	return response
+}
+
+// APIKeyVerifier verifies API keys against the database. It authenticates X-API-Key
+// requests to this service, and answers the verify endpoint other services ask.
+type APIKeyVerifier struct {
+	apiKeyRepo         repository.IAPIKeyRepository
+	serviceAccountRepo repository.IServiceAccountRepository
+	userRepo           repository.IUserRepository
+	roleRepo           repository.IRoleRepository
+}
+
+func NewAPIKeyVerifier(apiKeyRepo repository.IAPIKeyRepository,
+	serviceAccountRepo repository.IServiceAccountRepository,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository) *APIKeyVerifier {
+	return &APIKeyVerifier{
+		apiKeyRepo:         apiKeyRepo,
+		serviceAccountRepo: serviceAccountRepo,
+		userRepo:           userRepo,
+		roleRepo:           roleRepo,
+	}
+}
+
+// VerifyAPIKey returns the claims of an active key whose owner is enabled. Grants are
+// resolved on every call, so role changes of the owner apply at once.
+func (v *APIKeyVerifier) VerifyAPIKey(ctx context.Context, key string) (jwt.MapClaims, error) {
+	apiKey, err := v.apiKeyRepo.GetByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || !apiKey.IsActive(time.Now()) {
+		return nil, sharedauth.ErrInvalidAPIKey
+	}
+
+	var (
+		user    *models.User
+		account *models.ServiceAccount
+		grants  auth.Grants
+	)
+	switch {
+	case apiKey.UserID != nil:
+		user, err = v.userRepo.GetByID(ctx, *apiKey.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || user.DisabledAt != nil {
+			return nil, sharedauth.ErrInvalidAPIKey
+		}
+		grants, err = resolveGrants(ctx, v.roleRepo, user)
+	case apiKey.ServiceAccountID != nil:
+		account, err = v.serviceAccountRepo.GetByID(ctx, *apiKey.ServiceAccountID)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, sharedauth.ErrInvalidAPIKey
+		}
+		grants, err = serviceAccountGrants(ctx, v.roleRepo, account)
+	default:
+		return nil, sharedauth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.apiKeyRepo.TouchLastUsed(ctx, apiKey.ID, apiKeyTouchInterval); err != nil {
+		log.Printf("failed to record use of api key %s: %v", apiKey.ID, err)
+	}
+
+	return auth.APIKeyClaims(*apiKey, user, account, grants), nil
+}
+
+// serviceAccountGrants resolves the roles and permissions of the role a service account holds
+func serviceAccountGrants(ctx context.Context, roleRepo repository.IRoleRepository, account *models.ServiceAccount) (auth.Grants, error) {
+	return resolveGrants(ctx, roleRepo, &models.User{RoleID: account.RoleID})
+}
+
+type APIKeyHandler struct {
+	apiKeyRepo repository.IAPIKeyRepository
+	roleRepo   repository.IRoleRepository
+	userRepo   repository.IUserRepository
+	verifier   *APIKeyVerifier
+}
+
+func NewAPIKeyHandler(apiKeyRepo repository.IAPIKeyRepository,
+	roleRepo repository.IRoleRepository,
+	userRepo repository.IUserRepository,
+	verifier *APIKeyVerifier) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyRepo: apiKeyRepo,
+		roleRepo:   roleRepo,
+		userRepo:   userRepo,
+		verifier:   verifier,
+	}
+}
+
+// RegisterAPIKeyRoutes lets users manage their own API keys, and other services
+// verify the keys they receive
+func RegisterAPIKeyRoutes(rg *gin.RouterGroup,
+	apiKeyRepo repository.IAPIKeyRepository,
+	roleRepo repository.IRoleRepository,
+	userRepo repository.IUserRepository,
+	verifier *APIKeyVerifier) {
+
+	handler := NewAPIKeyHandler(apiKeyRepo, roleRepo, userRepo, verifier)
+
+	rg.POST("/verify", handler.VerifyAPIKey)
+
+	keys := rg.Group("", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	keys.GET("", handler.GetAPIKeys)
+	keys.POST("", handler.AddAPIKey)
+	keys.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.RevokeAPIKey)
+}
+
+// ---------- API KEYS ----------
+// GET /api-keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyRepo.GetByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch api keys"})
+		return
+	}
+	c.JSON(http.StatusOK, newAPIKeyResponses(keys))
+}
+
+// POST /api-keys
+// AddAPIKey issues a key acting as the authenticated user within the requested
+// scopes. The key is only returned here, we keep its hash.
+func (h *APIKeyHandler) AddAPIKey(c *gin.Context) {
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
+		return
+	}
+
+	issueAPIKey(c, h.apiKeyRepo, req, grants, models.APIKey{UserID: &user.ID})
+}
+
+// DELETE /api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.MustGet("id").(uuid.UUID)
+
+	key, err := h.apiKeyRepo.GetByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch api key"})
+		return
+	}
+	if key == nil || key.UserID == nil || *key.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+
+	if err := h.apiKeyRepo.Revoke(ctx, key.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
+
+// POST /api-keys/verify
+// VerifyAPIKey returns the claims of the key in the X-API-Key header, for services
+// authenticating the keys they receive. It tells nothing about a key to anyone who
+// does not hold it already.
+func (h *APIKeyHandler) VerifyAPIKey(c *gin.Context) {
+	key := c.GetHeader(sharedauth.APIKeyHeader)
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api key header required"})
+		return
+	}
+
+	claims, err := h.verifier.VerifyAPIKey(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, sharedauth.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify api key"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, claims)
+}
+
+// issueAPIKey validates req against the grants of the owner set on key, stores the
+// key and responds with it
+func issueAPIKey(c *gin.Context, apiKeyRepo repository.IAPIKeyRepository, req APIKeyRequest, grants auth.Grants, key models.APIKey) {
+	scopes := auth.ParseScopes(strings.Join(req.Scopes, " "))
+	for _, scope := range scopes {
+		if _, found := auth.FindScope(scope); !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+		// A key never acts with more than its owner
+		if !grants.AllowsScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "scope not allowed: " + scope})
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	secret, prefix, keyHash, err := auth.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate api key"})
+		return
+	}
+
+	key.ID = uuid.New()
+	key.Name = req.Name
+	key.Prefix = prefix
+	key.KeyHash = keyHash
+	key.Scopes = scopes
+	key.ExpiresAt = req.ExpiresAt
+
+	if err := apiKeyRepo.Create(c.Request.Context(), &key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create api key"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, CreatedAPIKeyResponse{
+		APIKeyResponse: newAPIKeyResponse(key),
+		Key:            secret,
+	})
+}
@@ -2,14 +2,21 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
 	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,30 +24,76 @@ type AuthHandler struct {
 	userRepo         repository.IUserRepository
 	roleRepo         repository.IRoleRepository
 	refreshTokenRepo repository.IRefreshTokenRepository
+	sessionRepo      repository.ISessionRepository
+	keys             *auth.KeyRing
+	revocations      sharedauth.RevocationStore
+	verifier         *emailVerifier
+	mfa              *mfaVerifier
+	sessions         *sessionIssuer
+	protection       LoginProtection
+	guard            *loginGuard
+	passwords        auth.PasswordPolicy
+	dummyHash        []byte
 }
 
 func NewAuthHandler(userRepo repository.IUserRepository,
 	roleRepo repository.IRoleRepository,
-	refreshTokenRepo repository.IRefreshTokenRepository) *AuthHandler {
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	sessionRepo repository.ISessionRepository,
+	verificationTokenRepo repository.IEmailVerificationTokenRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	keys *auth.KeyRing,
+	secrets *auth.SecretBox,
+	revocations sharedauth.RevocationStore,
+	mailer mailer.Mailer,
+	verification EmailVerificationOptions,
+	protection LoginProtection,
+	passwords auth.PasswordPolicy) *AuthHandler {
 	return &AuthHandler{
 		userRepo:         userRepo,
 		roleRepo:         roleRepo,
 		refreshTokenRepo: refreshTokenRepo,
+		sessionRepo:      sessionRepo,
+		keys:             keys,
+		revocations:      revocations,
+		verifier:         &emailVerifier{tokenRepo: verificationTokenRepo, mailer: mailer, options: verification},
+		mfa:              &mfaVerifier{userRepo: userRepo, recoveryCodeRepo: recoveryCodeRepo, secrets: secrets},
+		sessions:         &sessionIssuer{userRepo: userRepo, roleRepo: roleRepo, sessionRepo: sessionRepo, keys: keys},
+		protection:       protection,
+		guard:            &loginGuard{userRepo: userRepo, protection: protection},
+		passwords:        passwords,
+		dummyHash:        newDummyPasswordHash(passwords),
 	}
 }
 
 func RegisterAuthRoutes(rg *gin.RouterGroup,
 	userRepo repository.IUserRepository,
 	roleRepo repository.IRoleRepository,
-	refreshTokenRepo repository.IRefreshTokenRepository) {
-
-	handler := NewAuthHandler(userRepo, roleRepo, refreshTokenRepo)
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	sessionRepo repository.ISessionRepository,
+	verificationTokenRepo repository.IEmailVerificationTokenRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	keys *auth.KeyRing,
+	secrets *auth.SecretBox,
+	revocations sharedauth.RevocationStore,
+	mailer mailer.Mailer,
+	verification EmailVerificationOptions,
+	protection LoginProtection,
+	passwords auth.PasswordPolicy) {
+
+	handler := NewAuthHandler(userRepo, roleRepo, refreshTokenRepo, sessionRepo, verificationTokenRepo, recoveryCodeRepo, keys, secrets, revocations, mailer, verification, protection, passwords)
 
 	rg.POST("/login", handler.Login)
+	rg.POST("/login/mfa", handler.LoginMFA)
 	rg.POST("/register", handler.Register)
-	rg.POST("/reset-password", handler.ResetPassword)
-	rg.POST("/forgot-password", handler.ForgotPassword)
+	rg.POST("/change-password", authmw.AuthMiddleware(), authmw.RequireFirstParty(), handler.ChangePassword)
 	rg.POST("/refresh-token", handler.RefreshToken)
+	rg.POST("/logout", handler.Logout)
+	rg.POST("/logout-all", authmw.AuthMiddleware(), authmw.RequireFirstParty(), handler.LogoutAll)
+
+	sessions := rg.Group("/sessions", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	sessions.GET("", handler.GetSessions)
+	sessions.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.RevokeSession)
 }
 
 // ---------- LOGIN ----------
@@ -48,6 +101,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
+		DeviceID string `json:"deviceId" binding:"max=100"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -55,32 +109,80 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByEmail(c.Request.Context(), req.Email)
+	ctx := c.Request.Context()
+	now := time.Now()
+	clientIP := c.ClientIP()
+
+	if retryAfter := h.protection.IP.RetryAfter(clientIP, now); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	// Backoff is tracked by address, so unknown emails back off like accounts do
+	emailHash := auth.LoginAttemptKey(req.Email)
+	retryAfter, err := h.guard.lockedFor(ctx, emailHash, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts"})
+		return
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	user, err := h.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil || user == nil {
+		// Spend the same bcrypt time as a wrong password, so unknown emails do not answer faster
+		_ = bcrypt.CompareHashAndPassword(h.dummyHash, []byte(req.Password))
+		h.protection.IP.Fail(clientIP, now)
+		h.guard.recordFailure(ctx, emailHash, nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	// Check password
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+	// Accounts without a password sign in through a provider, they fail like unknown emails
+	hash := []byte(user.Password)
+	if user.Password == "" {
+		hash = h.dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil {
+		h.protection.IP.Fail(clientIP, now)
+		h.guard.recordFailure(ctx, emailHash, user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
+	rehashPassword(ctx, h.userRepo, h.passwords, user, req.Password)
+
+	// Checked after the password, so disabled and unverified accounts are not revealed to guessers
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+	if h.verifier.options.Required && user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+		return
+	}
 
-	accessToken, refreshToken, err := auth.GenerateTokens(*user, user.Role.Name)
+	// Failed logins are only cleared once the second factor passed too, otherwise
+	// every correct password would reset the guesses made at the code
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
 		return
 	}
 
-	h.refreshTokenRepo.Create(c.Request.Context(), &models.RefreshToken{
-		Token: refreshToken,
-	})
+	if user.TOTPEnabledAt != nil || requiresMFA(grants) {
+		respondMFAChallenge(c, h.keys, user)
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"accessToken":  accessToken,
-		"refreshToken": refreshToken,
-	})
+	tokens, err := h.sessions.start(c, user, req.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
 }
 
 // ---------- REGISTER ----------
@@ -95,9 +197,15 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Emails are stored lowercase, so one address cannot open two accounts
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	if !checkNewPassword(c, h.passwords, req.Password, req.Email, req.Name) {
+		return
+	}
 
 	// Hash password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashed, err := h.passwords.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
@@ -118,7 +226,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	user := models.User{
 		ID:       uuid.New(),
 		Email:    req.Email,
-		Password: string(hashed),
+		Password: hashed,
 		Name:     req.Name,
 		RoleID:   customerRole.ID,
 	}
@@ -127,75 +235,308 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
 		return
 	}
+	user.Role = *customerRole
 
-	c.JSON(http.StatusCreated, user)
+	// The account exists either way, the user can ask for another link
+	if err := h.verifier.send(c.Request.Context(), &user); err != nil {
+		log.Printf("failed to send verification email for user %s: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, newUserResponse(user))
 }
 
 // ---------- REFRESH TOKEN ----------
+// Refresh tokens are single use. Presenting one that was already rotated means it
+// leaked, so the whole family is revoked and every holder has to log in again.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refreshToken" binding:"required"`
+		DeviceID     string `json:"deviceId"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	claims, err := auth.ParseToken(req.RefreshToken)
+	ctx := c.Request.Context()
+
+	current, err := h.refreshTokenRepo.GetByHash(ctx, auth.HashToken(req.RefreshToken))
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load refresh token"})
+		return
+	}
+	// Tokens delegated to OAuth clients are only refreshed at the token endpoint
+	if current == nil || current.ClientID != "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
 		return
 	}
 
-	userID, ok := claims[auth.ClaimUserID].(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
+	if current.RevokedAt != nil {
+		h.revokeFamily(c, current.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
 		return
 	}
 
-	uid, err := uuid.Parse(userID)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+	if current.IsExpired(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired"})
+		return
+	}
+
+	// A token bound to a device is only honoured on that device
+	if current.DeviceID != "" && current.DeviceID != req.DeviceID {
+		h.revokeFamily(c, current.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
 		return
 	}
 
-	user, err := h.userRepo.GetByID(context.Background(), uid)
+	user, err := h.userRepo.GetByID(ctx, current.UserID)
 	if err != nil || user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 		return
 	}
+	if user.DisabledAt != nil {
+		h.revokeFamily(c, current.FamilyID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+
+	// Grants are resolved again, so a refresh picks up role and permission changes
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
+		return
+	}
 
-	accessToken, refreshToken, err := auth.GenerateTokens(*user, user.Role.Name)
+	accessToken, err := auth.GenerateAccessToken(h.keys, *user, grants, current.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
 		return
 	}
 
+	refreshToken, next, err := newRefreshToken(c, user.ID, current.FamilyID, current.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+
+	if err := h.refreshTokenRepo.Rotate(ctx, current, next); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			h.revokeFamily(c, current.FamilyID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate refresh token"})
+		return
+	}
+
+	if err := h.sessionRepo.Touch(ctx, current.FamilyID, c.ClientIP()); err != nil {
+		log.Printf("failed to update session %s: %v", current.FamilyID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"accessToken":  accessToken,
 		"refreshToken": refreshToken,
 	})
 }
 
-// ---------- FORGOT PASSWORD ----------
-func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+// ---------- LOGOUT ----------
+// Logout ends the session the refresh token belongs to, and revokes the access
+// token when one is sent along
+func (h *AuthHandler) Logout(c *gin.Context) {
 	var req struct {
-		Email string `json:"email" binding:"required,email"`
+		RefreshToken string `json:"refreshToken" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Here you would generate a reset token and send email
-	// Skipping email service for now
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset link sent (stub)"})
+	current, err := h.refreshTokenRepo.GetByHash(c.Request.Context(), auth.HashToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load refresh token"})
+		return
+	}
+
+	// Unknown tokens are not reported, logging out twice is not an error
+	if current != nil {
+		if err := revokeSession(c.Request.Context(), h.revocations, h.refreshTokenRepo, current.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke refresh token"})
+			return
+		}
+	}
+
+	if err := h.revokeAccessToken(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke access token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 }
 
-// ---------- RESET PASSWORD ----------
-func (h *AuthHandler) ResetPassword(c *gin.Context) {
+// LogoutAll ends every session of the authenticated user, including access tokens already issued
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, ok := authmw.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.revokeUserTokens(c.Request.Context(), uid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out from all devices"})
+}
+
+func (h *AuthHandler) revokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return revokeUserTokens(ctx, h.revocations, h.refreshTokenRepo, userID)
+}
+
+// revokeUserTokens revokes every refresh token of the user and every access token issued until now
+func revokeUserTokens(ctx context.Context,
+	revocations sharedauth.RevocationStore,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	userID uuid.UUID) error {
+	if err := revocations.SetIssuedBefore(ctx, userID.String(), time.Now()); err != nil {
+		return err
+	}
+	return refreshTokenRepo.RevokeAllForUser(ctx, userID)
+}
+
+// revokeAccessToken revokes the bearer token of the request until it expires. Requests
+// without a valid bearer token have nothing to revoke.
+func (h *AuthHandler) revokeAccessToken(c *gin.Context) error {
+	tokenStr, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return nil
+	}
+
+	claims, err := sharedauth.ParseToken(tokenStr)
+	if err != nil {
+		return nil
+	}
+
+	tokenID, _ := claims[sharedauth.ClaimTokenID].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if tokenID == "" || err != nil || expiresAt == nil {
+		return nil
+	}
+
+	return h.revocations.RevokeToken(c.Request.Context(), tokenID, expiresAt.Time)
+}
+
+// sessionIssuer starts sessions for fully authenticated users, after the password
+// and any second factor were checked
+type sessionIssuer struct {
+	userRepo    repository.IUserRepository
+	roleRepo    repository.IRoleRepository
+	sessionRepo repository.ISessionRepository
+	keys        *auth.KeyRing
+}
+
+// start clears the failed logins of user and issues a token pair in a new family,
+// recorded as a session of the device the request came from
+func (s *sessionIssuer) start(c *gin.Context, user *models.User, deviceID string) (gin.H, error) {
+	ctx := c.Request.Context()
+
+	// The IP is not reset, one valid account must not clear the guesses made against others
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetLoginFailures(ctx, user.ID); err != nil {
+			log.Printf("failed to reset failed logins of user %s: %v", user.ID, err)
+		}
+	}
+
+	grants, err := resolveGrants(ctx, s.roleRepo, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every login starts a new token family, which is also the session id
+	familyID := uuid.New()
+
+	accessToken, err := auth.GenerateAccessToken(s.keys, *user, grants, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := newRefreshToken(c, user.ID, familyID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		ID:         familyID,
+		UserID:     user.ID,
+		DeviceID:   deviceID,
+		DeviceName: deviceName(record.UserAgent),
+		UserAgent:  record.UserAgent,
+		IPAddress:  truncate(c.ClientIP(), 45),
+		LastUsedAt: time.Now(),
+	}
+	if err := s.sessionRepo.Start(ctx, session, record); err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	}, nil
+}
+
+// resolveGrants loads the role hierarchy and resolves the roles and permissions of user
+func resolveGrants(ctx context.Context, roleRepo repository.IRoleRepository, user *models.User) (auth.Grants, error) {
+	roles, err := roleRepo.GetAllWithPermissions(ctx)
+	if err != nil {
+		return auth.Grants{}, err
+	}
+	return auth.ResolveGrants(*user, roles), nil
+}
+
+// newRefreshToken creates a refresh token in family and the record to store for it
+func newRefreshToken(c *gin.Context, userID uuid.UUID, familyID uuid.UUID, deviceID string) (string, *models.RefreshToken, error) {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &models.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: tokenHash,
+		UserID:    userID,
+		FamilyID:  familyID,
+		DeviceID:  deviceID,
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		ExpiresAt: time.Now().Add(auth.RefreshTokenLifetime()),
+	}, nil
+}
+
+func (h *AuthHandler) revokeFamily(c *gin.Context, familyID uuid.UUID) {
+	if err := revokeSession(c.Request.Context(), h.revocations, h.refreshTokenRepo, familyID); err != nil {
+		log.Printf("failed to revoke refresh token family %s: %v", familyID, err)
+	}
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
+
+// ---------- CHANGE PASSWORD ----------
+// ChangePassword sets a new password for the authenticated user, who still has to
+// know the current one. Wrong guesses back off like failed logins, so a stolen
+// access token cannot be used to guess the password either.
+// Users who forgot theirs go through the password reset flow instead.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	var req struct {
-		Email       string `json:"email" binding:"required,email"`
 		Password    string `json:"password" binding:"required"`
 		NewPassword string `json:"newPassword" binding:"required"`
 	}
@@ -204,30 +545,76 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByEmail(c.Request.Context(), req.Email)
-	if err != nil || user == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	clientIP := c.ClientIP()
+
+	if retryAfter := h.protection.IP.RetryAfter(clientIP, now); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
 		return
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	emailHash := auth.LoginAttemptKey(user.Email)
+	retryAfter, err := h.guard.lockedFor(ctx, emailHash, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts"})
+		return
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	// Accounts without a password sign in through a provider and set one through the reset flow
+	hash := []byte(user.Password)
+	if user.Password == "" {
+		hash = h.dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil {
+		h.protection.IP.Fail(clientIP, now)
+		h.guard.recordFailure(ctx, emailHash, user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if !checkNewPassword(c, h.passwords, req.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	hashed, err := h.passwords.Hash(req.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
 	}
 
-	user.Password = string(hashed)
+	user.Password = hashed
 	user.LatestUpdatedAt = time.Now()
 
-	if err := h.userRepo.Update(context.Background(), user); err != nil {
+	if err := h.userRepo.Update(ctx, user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
 		return
 	}
 
+	// Sessions started with the old password must not outlive it
+	if err := h.revokeUserTokens(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
 }
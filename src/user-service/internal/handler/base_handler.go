@@ -1,8 +1,32 @@
 package handler
 
+// Page size used when none is requested, and the largest one served
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type BaseRequest struct {
-	PageSize  int32 `json:"pageSize"`
-	PageIndex int32 `json:"pageIndex"`
+	PageSize  int32 `json:"pageSize" form:"pageSize"`
+	PageIndex int32 `json:"pageIndex" form:"pageIndex"`
+}
+
+// Normalize clamps the page to valid bounds. Pages are numbered from 1.
+func (r *BaseRequest) Normalize() {
+	if r.PageIndex < 1 {
+		r.PageIndex = 1
+	}
+	if r.PageSize < 1 {
+		r.PageSize = defaultPageSize
+	}
+	if r.PageSize > maxPageSize {
+		r.PageSize = maxPageSize
+	}
+}
+
+// Offset returns how many rows precede the page
+func (r *BaseRequest) Offset() int {
+	return int((r.PageIndex - 1) * r.PageSize)
 }
 
 type BaseResponse struct {
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// Resends are limited per user, so the endpoint cannot be used to flood a mailbox
+const (
+	verificationResendCooldown = time.Minute
+	verificationHourlyLimit    = 5
+)
+
+// ErrVerificationRateLimited is returned when a user asked for too many verification
+// emails. The resend endpoint then skips the email without telling the caller.
+var ErrVerificationRateLimited = errors.New("too many verification emails requested, try again later")
+
+// EmailVerificationOptions configures email verification
+type EmailVerificationOptions struct {
+	URL      string // page of the frontend that receives ?token=
+	TTL      time.Duration
+	Required bool // block login until the email is verified
+}
+
+// emailVerifier issues verification tokens and mails them. It is shared by
+// registration and the resend endpoint.
+type emailVerifier struct {
+	tokenRepo repository.IEmailVerificationTokenRepository
+	mailer    mailer.Mailer
+	options   EmailVerificationOptions
+}
+
+// send replaces any outstanding verification token of the user and mails the new one
+func (v *emailVerifier) send(ctx context.Context, user *models.User) error {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := v.tokenRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := v.tokenRepo.Create(ctx, &models.EmailVerificationToken{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(v.options.TTL),
+	}); err != nil {
+		return err
+	}
+
+	verifyURL, err := tokenURL(v.options.URL, token)
+	if err != nil {
+		return err
+	}
+
+	message, err := mailer.Render(mailer.TemplateEmailVerification, user.Email, map[string]any{
+		"Name":      user.Name,
+		"VerifyURL": verifyURL,
+		"ExpiresIn": formatDuration(v.options.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	sendInBackground(v.mailer, message, user.ID)
+	return nil
+}
+
+// checkRateLimit rejects a resend within the cooldown or above the hourly limit
+func (v *emailVerifier) checkRateLimit(ctx context.Context, user *models.User) error {
+	now := time.Now()
+
+	recent, err := v.tokenRepo.CountCreatedSince(ctx, user.ID, now.Add(-verificationResendCooldown))
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return ErrVerificationRateLimited
+	}
+
+	hourly, err := v.tokenRepo.CountCreatedSince(ctx, user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if hourly >= verificationHourlyLimit {
+		return ErrVerificationRateLimited
+	}
+	return nil
+}
+
+type EmailVerificationHandler struct {
+	userRepo repository.IUserRepository
+	verifier *emailVerifier
+}
+
+func NewEmailVerificationHandler(userRepo repository.IUserRepository,
+	tokenRepo repository.IEmailVerificationTokenRepository,
+	mailer mailer.Mailer,
+	options EmailVerificationOptions) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		userRepo: userRepo,
+		verifier: &emailVerifier{tokenRepo: tokenRepo, mailer: mailer, options: options},
+	}
+}
+
+func RegisterEmailVerificationRoutes(rg *gin.RouterGroup,
+	userRepo repository.IUserRepository,
+	tokenRepo repository.IEmailVerificationTokenRepository,
+	mailer mailer.Mailer,
+	options EmailVerificationOptions) {
+
+	handler := NewEmailVerificationHandler(userRepo, tokenRepo, mailer, options)
+
+	rg.POST("/verify-email", handler.VerifyEmail)
+	rg.POST("/resend-verification", handler.ResendVerification)
+}
+
+// ---------- VERIFY EMAIL ----------
+// VerifyEmail redeems a verification token and marks the email of its user verified
+func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	verificationToken, err := h.verifier.tokenRepo.GetByHash(ctx, auth.HashToken(req.Token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load verification token"})
+		return
+	}
+	if verificationToken == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrVerificationTokenInvalid.Error()})
+		return
+	}
+
+	if err := h.verifier.tokenRepo.Consume(ctx, verificationToken.ID); err != nil {
+		if errors.Is(err, repository.ErrVerificationTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem verification token"})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, verificationToken.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrVerificationTokenInvalid.Error()})
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+
+		if err := h.userRepo.Update(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// ---------- RESEND VERIFICATION ----------
+// ResendVerification mails a new verification link. The account is looked up after
+// the response, and unknown, already verified and rate limited emails get the same
+// one, so the endpoint does not reveal accounts.
+func (h *EmailVerificationHandler) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inBackground(func(ctx context.Context) {
+		user, err := h.userRepo.GetByEmail(ctx, req.Email)
+		if err != nil || user == nil || user.EmailVerifiedAt != nil {
+			return
+		}
+
+		if err := h.verifier.checkRateLimit(ctx, user); err != nil {
+			if !errors.Is(err, ErrVerificationRateLimited) {
+				log.Printf("failed to check verification emails of user %s: %v", user.ID, err)
+			}
+			return
+		}
+		if err := h.verifier.send(ctx, user); err != nil {
+			log.Printf("failed to resend verification email for user %s: %v", user.ID, err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered and not yet verified, a verification link has been sent"})
+}
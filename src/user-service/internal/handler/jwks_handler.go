@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+)
+
+// jwksMaxAge bounds how long verifiers cache the key set before picking up a rotation
+const jwksMaxAge = 15 * time.Minute
+
+type JWKSHandler struct {
+	keys *auth.KeyRing
+}
+
+func NewJWKSHandler(keys *auth.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func RegisterJWKSRoutes(router gin.IRouter, keys *auth.KeyRing) {
+	handler := NewJWKSHandler(keys)
+
+	router.GET("/.well-known/jwks.json", handler.GetJWKS)
+}
+
+// GET /.well-known/jwks.json
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	set, err := h.keys.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// newDummyPasswordHash returns the hash compared against when the email is unknown.
+// It has the cost of real hashes, so a failed lookup takes as long as a wrong password.
+func newDummyPasswordHash(policy auth.PasswordPolicy) []byte {
+	hashed, _ := policy.Hash("dummy-password")
+	return []byte(hashed)
+}
+
+// LockoutNotifier is told when an account gets locked after too many failed logins
+type LockoutNotifier interface {
+	AccountLocked(ctx context.Context, user *models.User, attempts int, until time.Time)
+}
+
+// LoginProtection throttles password guessing per email address and per client IP.
+// Addresses back off alike whether or not an account has them, and the account of
+// a locked address is locked too, which also holds back its social logins.
+type LoginProtection struct {
+	Account  auth.LockoutPolicy
+	Attempts repository.ILoginAttemptRepository
+	IP       *auth.AttemptLimiter
+	Notifier LockoutNotifier
+}
+
+// mailLockoutNotifier emails the owner of a locked account
+type mailLockoutNotifier struct {
+	mailer mailer.Mailer
+}
+
+func NewMailLockoutNotifier(mailer mailer.Mailer) LockoutNotifier {
+	return &mailLockoutNotifier{mailer: mailer}
+}
+
+func (n *mailLockoutNotifier) AccountLocked(_ context.Context, user *models.User, attempts int, until time.Time) {
+	message, err := mailer.Render(mailer.TemplateAccountLocked, user.Email, map[string]any{
+		"Name":      user.Name,
+		"Attempts":  attempts,
+		"LockedFor": formatDuration(time.Until(until).Round(time.Minute)),
+	})
+	if err != nil {
+		log.Printf("failed to render lockout email for user %s: %v", user.ID, err)
+		return
+	}
+
+	sendInBackground(n.mailer, message, user.ID)
+}
+
+// tooManyAttempts refuses a login until retryAfter has passed
+func tooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	tooManyRequests(c, retryAfter, "too many failed login attempts, try again later")
+}
+
+// tooManyRequests refuses a request until retryAfter has passed
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// lockedFor returns how long the account still refuses logins
+func lockedFor(user *models.User, now time.Time) time.Duration {
+	if user.LockedUntil == nil || !now.Before(*user.LockedUntil) {
+		return 0
+	}
+	return user.LockedUntil.Sub(now)
+}
+
+// loginGuard applies the login protection to password and code checks of the
+// handlers, so guesses made anywhere back off and lock alike
+type loginGuard struct {
+	userRepo   repository.IUserRepository
+	protection LoginProtection
+}
+
+// refuse answers 429 and returns true while the client IP or the email address of
+// user is backed off after failed logins
+func (g *loginGuard) refuse(c *gin.Context, user *models.User) bool {
+	now := time.Now()
+
+	if retryAfter := g.protection.IP.RetryAfter(c.ClientIP(), now); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return true
+	}
+
+	retryAfter, err := g.lockedFor(c.Request.Context(), auth.LoginAttemptKey(user.Email), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts"})
+		return true
+	}
+	if retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return true
+	}
+	return false
+}
+
+// fail counts a wrong password or code of user as a failed login
+func (g *loginGuard) fail(c *gin.Context, user *models.User) {
+	g.protection.IP.Fail(c.ClientIP(), time.Now())
+	g.recordFailure(c.Request.Context(), auth.LoginAttemptKey(user.Email), user)
+}
+
+// lockedFor returns how long logins with the email address are still refused
+func (g *loginGuard) lockedFor(ctx context.Context, emailHash string, now time.Time) (time.Duration, error) {
+	lockedUntil, err := g.protection.Attempts.LockedUntil(ctx, emailHash)
+	if err != nil || lockedUntil == nil || !now.Before(*lockedUntil) {
+		return 0, err
+	}
+	return lockedUntil.Sub(now), nil
+}
+
+// recordFailure counts a wrong password against the email address and backs it
+// off. When an account has the address, user is set: it is counted and locked along,
+// and its owner is notified once the policy locks.
+func (g *loginGuard) recordFailure(ctx context.Context, emailHash string, user *models.User) {
+	policy := g.protection.Account
+
+	failures, err := g.protection.Attempts.RecordFailure(ctx, emailHash, policy.Window)
+	if err != nil {
+		log.Printf("failed to record failed login: %v", err)
+		return
+	}
+	if user != nil {
+		if _, err := g.userRepo.RecordLoginFailure(ctx, user.ID, policy.Window); err != nil {
+			log.Printf("failed to record failed login for user %s: %v", user.ID, err)
+		}
+	}
+
+	delay := policy.Delay(failures)
+	if delay == 0 {
+		return
+	}
+
+	until := time.Now().Add(delay)
+	if err := g.protection.Attempts.LockUntil(ctx, emailHash, until); err != nil {
+		log.Printf("failed to lock login: %v", err)
+		return
+	}
+	if user == nil {
+		return
+	}
+	if err := g.userRepo.LockUntil(ctx, user.ID, until); err != nil {
+		log.Printf("failed to lock user %s: %v", user.ID, err)
+		return
+	}
+
+	if policy.Locks(failures) && g.protection.Notifier != nil {
+		g.protection.Notifier.AccountLocked(ctx, user, failures, until)
+	}
+}
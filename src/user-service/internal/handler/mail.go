@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+)
+
+// Emails are sent after the response, bounded so a stuck relay cannot pile up goroutines
+const sendMailTimeout = 30 * time.Second
+
+// sendInBackground delivers message without holding up the request. Sending in the
+// background also keeps response times equal whether or not an email went out.
+func sendInBackground(m mailer.Mailer, message mailer.Message, userID uuid.UUID) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendMailTimeout)
+		defer cancel()
+
+		if err := m.Send(ctx, message); err != nil {
+			log.Printf("failed to send %q email to user %s: %v", message.Subject, userID, err)
+		}
+	}()
+}
+
+// inBackground runs task after the response, detached from the request. Endpoints
+// that must not reveal whether an account exists look it up this way, as the lookup
+// and the token written for a found account would otherwise show in response times.
+func inBackground(task func(ctx context.Context)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendMailTimeout)
+		defer cancel()
+
+		task(ctx)
+	}()
+}
+
+// tokenURL appends token as the token query parameter of base
+func tokenURL(base string, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link url: %w", err)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// formatDuration renders durations the way emails mention them, e.g. "30 minutes"
+func formatDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		hours := int(d / time.Hour)
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	}
+
+	minutes := int(d / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
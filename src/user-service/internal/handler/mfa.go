@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+var errInvalidMFACode = errors.New("invalid two-factor code")
+
+// requiresMFA reports whether a user with the grants may not log in with a password
+// only. Holding ADMIN through another role or the hierarchy counts too.
+func requiresMFA(grants auth.Grants) bool {
+	return grants.HasRole(sharedauth.RoleAdmin)
+}
+
+// mfaVerifier checks TOTP and recovery codes. It is shared by the second login
+// step and the endpoints managing the second factor.
+type mfaVerifier struct {
+	userRepo         repository.IUserRepository
+	recoveryCodeRepo repository.IRecoveryCodeRepository
+	secrets          *auth.SecretBox
+}
+
+// verifyTOTP checks code against the TOTP secret of user, enrolled or pending, and
+// burns its time step so the code cannot be used again
+func (v *mfaVerifier) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	if user.TOTPSecret == "" {
+		return errInvalidMFACode
+	}
+
+	secret, err := v.secrets.Open(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	if err := v.userRepo.UseTOTPStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, repository.ErrTOTPCodeReused) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	// Keep the loaded user current, a later save must not roll the step back
+	user.TOTPLastStep = step
+	return nil
+}
+
+// verify accepts either a TOTP code or one of the recovery codes of user
+func (v *mfaVerifier) verify(ctx context.Context, user *models.User, code string, recoveryCode string) error {
+	if code != "" {
+		return v.verifyTOTP(ctx, user, code)
+	}
+
+	if recoveryCode != "" {
+		err := v.recoveryCodeRepo.Consume(ctx, user.ID, auth.HashRecoveryCode(recoveryCode))
+		if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	return errInvalidMFACode
+}
+
+// newRecoveryCodes replaces the recovery codes of the user and returns the new ones,
+// the only time they are shown
+func (v *mfaVerifier) newRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := v.recoveryCodeRepo.ReplaceForUser(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// respondMFAChallenge answers a correct first factor with a challenge token instead
+// of the token pair. Users who must have a second factor but have none get an
+// enrolment challenge, which only opens the TOTP enrolment endpoints.
+func respondMFAChallenge(c *gin.Context, keys *auth.KeyRing, user *models.User) {
+	use := auth.TokenUseMFA
+	if user.TOTPEnabledAt == nil {
+		use = auth.TokenUseMFAEnrollment
+	}
+
+	challenge, err := auth.GenerateMFAChallenge(keys, *user, use)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate mfa token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfaRequired":           use == auth.TokenUseMFA,
+		"mfaEnrollmentRequired": use == auth.TokenUseMFAEnrollment,
+		"mfaToken":              challenge,
+		"expiresIn":             int(auth.MFAChallengeLifetime.Seconds()),
+	})
+}
+
+// ---------- LOGIN (SECOND STEP) ----------
+// LoginMFA exchanges the challenge token of Login and a TOTP or recovery code for the token pair
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken     string `json:"mfaToken" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		DeviceID     string `json:"deviceId" binding:"max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	clientIP := c.ClientIP()
+
+	if retryAfter := h.protection.IP.RetryAfter(clientIP, now); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+
+	userID, err := auth.ParseMFAChallenge(h.keys, req.MFAToken, auth.TokenUseMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, userID)
+	if err != nil || user == nil || user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidChallenge.Error()})
+		return
+	}
+
+	if retryAfter := lockedFor(user, now); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+
+	// Wrong codes count as failed logins, so guessing them locks the account too
+	if err := h.mfa.verify(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			h.protection.IP.Fail(clientIP, now)
+			h.guard.recordFailure(ctx, auth.LoginAttemptKey(user.Email), user)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code"})
+		return
+	}
+
+	tokens, err := h.sessions.start(c, user, req.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
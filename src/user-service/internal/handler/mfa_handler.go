@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// contextMFAEnrollment marks requests authenticated with an enrolment challenge
+// instead of an access token
+const contextMFAEnrollment = "mfa_enrollment"
+
+type MFAHandler struct {
+	userRepo repository.IUserRepository
+	keys     *auth.KeyRing
+	secrets  *auth.SecretBox
+	issuer   string
+	mfa      *mfaVerifier
+	sessions *sessionIssuer
+	guard    *loginGuard
+}
+
+func NewMFAHandler(userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	sessionRepo repository.ISessionRepository,
+	keys *auth.KeyRing,
+	secrets *auth.SecretBox,
+	issuer string,
+	protection LoginProtection) *MFAHandler {
+	return &MFAHandler{
+		userRepo: userRepo,
+		keys:     keys,
+		secrets:  secrets,
+		issuer:   issuer,
+		mfa:      &mfaVerifier{userRepo: userRepo, recoveryCodeRepo: recoveryCodeRepo, secrets: secrets},
+		sessions: &sessionIssuer{userRepo: userRepo, roleRepo: roleRepo, sessionRepo: sessionRepo, keys: keys},
+		guard:    &loginGuard{userRepo: userRepo, protection: protection},
+	}
+}
+
+func RegisterMFARoutes(rg *gin.RouterGroup,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	sessionRepo repository.ISessionRepository,
+	keys *auth.KeyRing,
+	secrets *auth.SecretBox,
+	issuer string,
+	protection LoginProtection) {
+
+	handler := NewMFAHandler(userRepo, roleRepo, recoveryCodeRepo, sessionRepo, keys, secrets, issuer, protection)
+
+	enrollment := rg.Group("/totp", handler.enrollmentAuth(), authmw.RequireFirstParty())
+	enrollment.POST("/enroll", handler.Enroll)
+	enrollment.POST("/confirm", handler.Confirm)
+
+	users := rg.Group("", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	users.POST("/totp/disable", handler.Disable)
+	users.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+}
+
+// enrollmentAuth accepts an enrolment challenge from Login in place of an access
+// token, so users who must have a second factor can set one up before logging in
+func (h *MFAHandler) enrollmentAuth() gin.HandlerFunc {
+	requireAccessToken := authmw.AuthMiddleware()
+
+	return func(c *gin.Context) {
+		tokenStr, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if found {
+			if userID, err := auth.ParseMFAChallenge(h.keys, tokenStr, auth.TokenUseMFAEnrollment); err == nil {
+				c.Set(authmw.ContextUserID, userID.String())
+				// A challenge is only ever issued to our own login, never to a client
+				c.Set(authmw.ContextClaims, jwt.MapClaims{sharedauth.ClaimUserID: userID.String()})
+				c.Set(contextMFAEnrollment, true)
+				c.Next()
+				return
+			}
+		}
+
+		requireAccessToken(c)
+	}
+}
+
+// currentUser loads the authenticated user
+func (h *MFAHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := authmw.UserID(c)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// POST /auth/mfa/totp/enroll
+// Enroll creates a pending TOTP secret. It only takes effect once Confirm receives
+// a first code, so a half finished enrolment never locks the user out.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+
+	sealed, err := h.secrets.Seal(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+
+	user.TOTPSecret = sealed
+	if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUri": auth.TOTPURI(h.issuer, user.Email, secret),
+	})
+}
+
+// POST /auth/mfa/totp/confirm
+// Confirm enables the pending secret once the user proves their authenticator
+// produces its codes, and returns the recovery codes. An enrolment started from
+// Login also finishes the login.
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req struct {
+		Code     string `json:"code" binding:"required"`
+		DeviceID string `json:"deviceId" binding:"max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor enrolment has not been started"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := h.mfa.verifyTOTP(ctx, user, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code"})
+		return
+	}
+
+	now := time.Now()
+	user.TOTPEnabledAt = &now
+	if err := h.userRepo.Update(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := h.mfa.newRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	response := gin.H{"recoveryCodes": codes}
+
+	if c.GetBool(contextMFAEnrollment) {
+		tokens, err := h.sessions.start(c, user, req.DeviceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+			return
+		}
+		for key, value := range tokens {
+			response[key] = value
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /auth/mfa/totp/disable
+// Disable removes the second factor. It asks for the password and a code again, so
+// a stolen access token alone cannot downgrade the account; wrong ones count as
+// failed logins, so they cannot be guessed here either.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	grants, err := resolveGrants(c.Request.Context(), h.sessions.roleRepo, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
+		return
+	}
+	if requiresMFA(grants) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for your role"})
+		return
+	}
+
+	if h.guard.refuse(c, user) {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		h.guard.fail(c, user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := h.mfa.verify(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			h.guard.fail(c, user)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code"})
+		return
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	if err := h.userRepo.Update(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	if err := h.mfa.recoveryCodeRepo.DeleteForUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// POST /auth/mfa/recovery-codes
+// RegenerateRecoveryCodes replaces the recovery codes, invalidating the old ones
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := h.mfa.verifyTOTP(ctx, user, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code"})
+		return
+	}
+
+	codes, err := h.mfa.newRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
+)
+
+type OAuthClientHandler struct {
+	clientRepo       repository.IOAuthClientRepository
+	consentRepo      repository.IOAuthConsentRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+}
+
+func NewOAuthClientHandler(clientRepo repository.IOAuthClientRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		clientRepo:       clientRepo,
+		consentRepo:      consentRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// RegisterOAuthClientRoutes exposes client registration to admins, and the consents
+// they gave to every user
+func RegisterOAuthClientRoutes(rg *gin.RouterGroup,
+	clientRepo repository.IOAuthClientRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository) {
+
+	handler := NewOAuthClientHandler(clientRepo, consentRepo, refreshTokenRepo)
+
+	clients := rg.Group("/clients", authmw.AuthMiddleware(), authmw.RequireFirstParty(), authmw.RequirePermission(sharedauth.PermissionOAuthClientManage))
+	clients.GET("", handler.GetClients)
+	clients.POST("", handler.AddClient)
+	clients.DELETE("/:id", middleware.UUIDParamMiddleware("id"), handler.DeleteClient)
+
+	consents := rg.Group("/consents", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	consents.GET("", handler.GetConsents)
+	consents.DELETE("/:clientId", handler.RevokeConsent)
+}
+
+// ---------- CLIENTS ----------
+// GET /oauth/clients
+func (h *OAuthClientHandler) GetClients(c *gin.Context) {
+	clients, err := h.clientRepo.GetMany(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch clients"})
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+// POST /oauth/clients
+// AddClient registers a client. The secret of a confidential client is only
+// returned here, we keep its hash.
+func (h *OAuthClientHandler) AddClient(c *gin.Context) {
+	var req struct {
+		Name           string   `json:"name" binding:"required,max=100"`
+		RedirectURIs   []string `json:"redirectUris"`
+		AllowedScopes  []string `json:"allowedScopes" binding:"required,min=1"`
+		GrantTypes     []string `json:"grantTypes" binding:"required,min=1"`
+		Public         bool     `json:"public"`
+		FirstParty     bool     `json:"firstParty"`
+		ResourceServer bool     `json:"resourceServer"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.AllowedScopes {
+		if _, ok := auth.FindScope(scope); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+	}
+	for _, grantType := range req.GrantTypes {
+		if !slices.Contains([]string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken}, grantType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported grant type " + grantType})
+			return
+		}
+	}
+	if req.Public && slices.Contains(req.GrantTypes, GrantClientCredentials) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "public clients cannot use the client credentials grant"})
+		return
+	}
+	if req.Public && req.ResourceServer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource servers must be confidential clients"})
+		return
+	}
+	if slices.Contains(req.GrantTypes, GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the authorization code grant needs a redirect uri"})
+		return
+	}
+	for _, redirectURI := range req.RedirectURIs {
+		// Redirect URIs must be absolute and carry no fragment (RFC 6749 section 3.1.2)
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redirect uri " + redirectURI})
+			return
+		}
+	}
+
+	clientID, err := newClientID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create client"})
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:       clientID,
+		Name:           req.Name,
+		RedirectURIs:   req.RedirectURIs,
+		AllowedScopes:  req.AllowedScopes,
+		GrantTypes:     req.GrantTypes,
+		FirstParty:     req.FirstParty,
+		ResourceServer: req.ResourceServer,
+	}
+
+	var secret string
+	if !req.Public {
+		if secret, client.SecretHash, err = auth.NewOpaqueToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create client"})
+			return
+		}
+	}
+
+	if err := h.clientRepo.Create(c.Request.Context(), &client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create client"})
+		return
+	}
+
+	response := gin.H{"client": client}
+	if secret != "" {
+		response["clientSecret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// DELETE /oauth/clients/:id
+// DeleteClient removes a client and revokes the refresh tokens and consents it holds
+func (h *OAuthClientHandler) DeleteClient(c *gin.Context) {
+	id := c.MustGet("id").(uuid.UUID)
+
+	if err := h.clientRepo.Delete(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "client deleted"})
+}
+
+// newClientID returns a random, non-secret client identifier
+func newClientID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ---------- CONSENTS ----------
+// GET /oauth/consents
+// GetConsents lists the clients the current user allowed access to
+func (h *OAuthClientHandler) GetConsents(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	consents, err := h.consentRepo.GetByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch consents"})
+		return
+	}
+	c.JSON(http.StatusOK, consents)
+}
+
+// DELETE /oauth/consents/:clientId
+// RevokeConsent withdraws the access of a client and revokes the refresh tokens it
+// holds for the user. Its access tokens lapse when they expire.
+func (h *OAuthClientHandler) RevokeConsent(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	clientID := c.Param("clientId")
+
+	if err := h.consentRepo.Revoke(ctx, userID, clientID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke consent"})
+		return
+	}
+	if err := h.refreshTokenRepo.RevokeForClient(ctx, userID, clientID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke client tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "consent revoked"})
+}
+
+// currentUserID returns the id of the authenticated user
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, _ := authmw.UserID(c)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
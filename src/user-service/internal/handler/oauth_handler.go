@@ -0,0 +1,756 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// Grant types of the token endpoint
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// Authorization codes are exchanged right after the redirect
+const authorizationCodeLifetime = 2 * time.Minute
+
+// oauthError is an error response of RFC 6749 section 5.2
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code string, description string) *oauthError {
+	return &oauthError{Code: code, Description: description}
+}
+
+type OAuthHandler struct {
+	clientRepo       repository.IOAuthClientRepository
+	codeRepo         repository.IOAuthAuthorizationCodeRepository
+	consentRepo      repository.IOAuthConsentRepository
+	userRepo         repository.IUserRepository
+	roleRepo         repository.IRoleRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	keys             *auth.KeyRing
+	revocations      sharedauth.RevocationStore
+}
+
+func NewOAuthHandler(clientRepo repository.IOAuthClientRepository,
+	codeRepo repository.IOAuthAuthorizationCodeRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	keys *auth.KeyRing,
+	revocations sharedauth.RevocationStore) *OAuthHandler {
+	return &OAuthHandler{
+		clientRepo:       clientRepo,
+		codeRepo:         codeRepo,
+		consentRepo:      consentRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		keys:             keys,
+		revocations:      revocations,
+	}
+}
+
+// RegisterOAuthRoutes exposes the authorization server. The authorize endpoints are
+// called by our frontend, which shows the consent screen to the signed in user;
+// the other endpoints are called by clients directly.
+func RegisterOAuthRoutes(rg *gin.RouterGroup,
+	clientRepo repository.IOAuthClientRepository,
+	codeRepo repository.IOAuthAuthorizationCodeRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	keys *auth.KeyRing,
+	revocations sharedauth.RevocationStore) {
+
+	handler := NewOAuthHandler(clientRepo, codeRepo, consentRepo, userRepo, roleRepo, refreshTokenRepo, keys, revocations)
+
+	users := rg.Group("", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	users.GET("/authorize", handler.GetAuthorization)
+	users.POST("/authorize", handler.Authorize)
+
+	rg.POST("/token", handler.Token)
+	rg.POST("/introspect", handler.Introspect)
+	rg.POST("/revoke", handler.Revoke)
+}
+
+// authorizeRequest holds the parameters of an authorization request (RFC 6749 section 4.1.1)
+type authorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// validatedAuthorization is an authorization request that passed validation
+type validatedAuthorization struct {
+	client          *models.OAuthClient
+	redirectURI     string
+	redirectURISent bool // false when the single registered one was filled in
+	scopes          []string
+}
+
+// validateAuthorization checks an authorization request for user. Errors about the
+// client or redirect URI are returned as err and must not be redirected, since the
+// redirect URI cannot be trusted; the rest come back as an oauthError to redirect.
+func (h *OAuthHandler) validateAuthorization(ctx context.Context, req authorizeRequest, user *models.User) (*validatedAuthorization, *oauthError, error) {
+	client, err := h.clientRepo.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		return nil, nil, newOAuthError("invalid_client", "unknown client")
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, nil, newOAuthError("invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	validated := &validatedAuthorization{client: client, redirectURI: redirectURI, redirectURISent: req.RedirectURI != ""}
+
+	if req.ResponseType != "code" {
+		return validated, newOAuthError("unsupported_response_type", "only the code response type is supported"), nil
+	}
+	if !slices.Contains(client.GrantTypes, GrantAuthorizationCode) {
+		return validated, newOAuthError("unauthorized_client", "client may not use the authorization code grant"), nil
+	}
+
+	// PKCE is required of every client, confidential ones included
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return validated, newOAuthError("invalid_request", "code_challenge with code_challenge_method S256 is required"), nil
+	}
+
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := auth.ParseScopes(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.AllowedScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.AllowedScopes, scope) || !grants.AllowsScope(scope) {
+			return validated, newOAuthError("invalid_scope", "scope "+scope+" cannot be granted"), nil
+		}
+	}
+	validated.scopes = scopes
+
+	return validated, nil, nil
+}
+
+// authorizingUser loads the signed in user the client asks access from
+func (h *OAuthHandler) authorizingUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := authmw.UserID(c)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user id"})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GET /oauth/authorize
+// GetAuthorization validates an authorization request and describes it for the
+// consent screen: which client asks for which scopes, and whether the user already consented.
+func (h *OAuthHandler) GetAuthorization(c *gin.Context) {
+	var req authorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, newOAuthError("invalid_request", err.Error()))
+		return
+	}
+
+	user, ok := h.authorizingUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	validated, redirectErr, err := h.validateAuthorization(ctx, req, user)
+	if !h.handleAuthorizationError(c, req, validated, redirectErr, err) {
+		return
+	}
+
+	consentRequired, err := h.consentRequired(ctx, user.ID, validated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load consent"})
+		return
+	}
+
+	scopes := make([]auth.Scope, 0, len(validated.scopes))
+	for _, name := range validated.scopes {
+		scope, _ := auth.FindScope(name)
+		scopes = append(scopes, scope)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": gin.H{
+			"clientId": validated.client.ClientID,
+			"name":     validated.client.Name,
+		},
+		"scopes":          scopes,
+		"consentRequired": consentRequired,
+	})
+}
+
+// POST /oauth/authorize
+// Authorize records the decision of the user and returns the URL to send them back
+// to the client with, carrying an authorization code when they approved
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var req struct {
+		authorizeRequest
+		Approve bool `json:"approve"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, newOAuthError("invalid_request", err.Error()))
+		return
+	}
+
+	user, ok := h.authorizingUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	validated, redirectErr, err := h.validateAuthorization(ctx, req.authorizeRequest, user)
+	if !h.handleAuthorizationError(c, req.authorizeRequest, validated, redirectErr, err) {
+		return
+	}
+
+	if !req.Approve {
+		c.JSON(http.StatusOK, gin.H{
+			"redirectUrl": redirectWith(validated.redirectURI, req.State, newOAuthError("access_denied", "the user denied access")),
+		})
+		return
+	}
+
+	if !validated.client.FirstParty {
+		if err := h.consentRepo.Grant(ctx, user.ID, validated.client.ClientID, validated.scopes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record consent"})
+			return
+		}
+	}
+
+	code, codeHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue authorization code"})
+		return
+	}
+
+	// Unredeemed codes are swept whenever a new one is issued
+	if _, err := h.codeRepo.DeleteExpired(ctx); err != nil {
+		log.Printf("failed to delete expired authorization codes: %v", err)
+	}
+
+	if err := h.codeRepo.Create(ctx, &models.OAuthAuthorizationCode{
+		CodeHash:        codeHash,
+		ClientID:        validated.client.ClientID,
+		UserID:          user.ID,
+		RedirectURI:     validated.redirectURI,
+		RedirectURISent: validated.redirectURISent,
+		Scopes:          validated.scopes,
+		CodeChallenge:   req.CodeChallenge,
+		ExpiresAt:       time.Now().Add(authorizationCodeLifetime),
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue authorization code"})
+		return
+	}
+
+	redirect, _ := url.Parse(validated.redirectURI)
+	query := redirect.Query()
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	c.JSON(http.StatusOK, gin.H{"redirectUrl": redirect.String()})
+}
+
+// handleAuthorizationError writes the response for a failed authorization request
+// and reports whether the request is valid
+func (h *OAuthHandler) handleAuthorizationError(c *gin.Context, req authorizeRequest, validated *validatedAuthorization, redirectErr *oauthError, err error) bool {
+	var clientErr *oauthError
+	switch {
+	case errors.As(err, &clientErr):
+		c.JSON(http.StatusBadRequest, clientErr)
+		return false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate authorization request"})
+		return false
+	case redirectErr != nil:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             redirectErr.Code,
+			"error_description": redirectErr.Description,
+			"redirectUrl":       redirectWith(validated.redirectURI, req.State, redirectErr),
+		})
+		return false
+	}
+	return true
+}
+
+// consentRequired reports whether the user has to approve the request. Our own
+// clients never ask, third-party clients ask until the user allowed every scope.
+func (h *OAuthHandler) consentRequired(ctx context.Context, userID uuid.UUID, validated *validatedAuthorization) (bool, error) {
+	if validated.client.FirstParty {
+		return false, nil
+	}
+
+	consent, err := h.consentRepo.Get(ctx, userID, validated.client.ClientID)
+	if err != nil || consent == nil {
+		return true, err
+	}
+
+	for _, scope := range validated.scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// redirectWith returns redirectURI carrying an error response (RFC 6749 section 4.1.2.1)
+func redirectWith(redirectURI string, state string, oauthErr *oauthError) string {
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := redirect.Query()
+	query.Set("error", oauthErr.Code)
+	query.Set("error_description", oauthErr.Description)
+	if state != "" {
+		query.Set("state", state)
+	}
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+// ---------- TOKEN ----------
+// POST /oauth/token
+// Token issues tokens for the authorization code, client credentials and refresh
+// token grants. Parameters are form encoded as RFC 6749 requires.
+func (h *OAuthHandler) Token(c *gin.Context) {
+	// Tokens must never be cached by intermediaries (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if !slices.Contains(client.GrantTypes, grantType) {
+		c.JSON(http.StatusBadRequest, newOAuthError("unauthorized_client", "client may not use grant type "+grantType))
+		return
+	}
+
+	var (
+		response gin.H
+		err      error
+	)
+	switch grantType {
+	case GrantAuthorizationCode:
+		response, err = h.exchangeAuthorizationCode(c, client)
+	case GrantClientCredentials:
+		response, err = h.exchangeClientCredentials(c, client)
+	case GrantRefreshToken:
+		response, err = h.exchangeRefreshToken(c, client)
+	default:
+		err = newOAuthError("unsupported_grant_type", "grant type "+grantType+" is not supported")
+	}
+
+	var tokenErr *oauthError
+	if errors.As(err, &tokenErr) {
+		c.JSON(http.StatusBadRequest, tokenErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, newOAuthError("server_error", "failed to issue tokens"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *OAuthHandler) exchangeAuthorizationCode(c *gin.Context, client *models.OAuthClient) (gin.H, error) {
+	ctx := c.Request.Context()
+
+	code, err := h.codeRepo.Consume(ctx, auth.HashToken(c.PostForm("code")))
+	if errors.Is(err, repository.ErrAuthorizationCodeInvalid) {
+		return nil, newOAuthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// redirect_uri is only required if the authorization request had it (RFC 6749 section 4.1.3)
+	redirectURI := c.PostForm("redirect_uri")
+	if (code.RedirectURISent || redirectURI != "") && code.RedirectURI != redirectURI {
+		return nil, newOAuthError("invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+	if code.ClientID != client.ClientID {
+		return nil, newOAuthError("invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+	if !verifyCodeChallenge(c.PostForm("code_verifier"), code.CodeChallenge) {
+		return nil, newOAuthError("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	user, err := h.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newOAuthError("invalid_grant", "user no longer exists")
+	}
+	if user.DisabledAt != nil {
+		return nil, newOAuthError("invalid_grant", "account disabled")
+	}
+
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.issueTokens(c, client, user, grants, code.Scopes, uuid.New())
+}
+
+func (h *OAuthHandler) exchangeClientCredentials(c *gin.Context, client *models.OAuthClient) (gin.H, error) {
+	if client.IsPublic() {
+		return nil, newOAuthError("unauthorized_client", "public clients cannot use the client credentials grant")
+	}
+
+	scopes := auth.ParseScopes(c.PostForm("scope"))
+	if len(scopes) == 0 {
+		scopes = client.AllowedScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.AllowedScopes, scope) {
+			return nil, newOAuthError("invalid_scope", "scope "+scope+" cannot be granted")
+		}
+	}
+
+	return h.issueTokens(c, client, nil, auth.Grants{}, scopes, uuid.Nil)
+}
+
+// exchangeRefreshToken rotates a refresh token the client obtained with the
+// authorization code grant. Reuse revokes the family and its access tokens, as for
+// our own login.
+func (h *OAuthHandler) exchangeRefreshToken(c *gin.Context, client *models.OAuthClient) (gin.H, error) {
+	ctx := c.Request.Context()
+
+	current, err := h.refreshTokenRepo.GetByHash(ctx, auth.HashToken(c.PostForm("refresh_token")))
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.ClientID != client.ClientID {
+		return nil, newOAuthError("invalid_grant", "invalid refresh token")
+	}
+	if current.RevokedAt != nil {
+		if err := revokeSession(ctx, h.revocations, h.refreshTokenRepo, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, newOAuthError("invalid_grant", "refresh token reuse detected")
+	}
+	if current.IsExpired(time.Now()) {
+		return nil, newOAuthError("invalid_grant", "refresh token expired")
+	}
+
+	user, err := h.userRepo.GetByID(ctx, current.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newOAuthError("invalid_grant", "user no longer exists")
+	}
+	if user.DisabledAt != nil {
+		return nil, newOAuthError("invalid_grant", "account disabled")
+	}
+
+	// A narrower scope may be requested, never a wider one
+	scopes := current.Scopes
+	if requested := auth.ParseScopes(c.PostForm("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(current.Scopes, scope) {
+				return nil, newOAuthError("invalid_scope", "scope "+scope+" was not granted")
+			}
+		}
+		scopes = requested
+	}
+
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// The user may have lost the role a scope needs since the grant
+	scopes = slices.DeleteFunc(slices.Clone(scopes), func(scope string) bool {
+		return !grants.AllowsScope(scope)
+	})
+
+	accessToken, err := auth.GenerateScopedAccessToken(h.keys, user, grants, client.ClientID, scopes, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, next, err := newRefreshToken(c, user.ID, current.FamilyID, "")
+	if err != nil {
+		return nil, err
+	}
+	next.ClientID = client.ClientID
+	next.Scopes = scopes
+
+	if err := h.refreshTokenRepo.Rotate(ctx, current, next); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			if err := revokeSession(ctx, h.revocations, h.refreshTokenRepo, current.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, newOAuthError("invalid_grant", "refresh token reuse detected")
+		}
+		return nil, err
+	}
+
+	return tokenResponse(accessToken, refreshToken, scopes), nil
+}
+
+// issueTokens signs an access token for the client, and a refresh token in a new
+// family when the client may refresh and acts for a user
+func (h *OAuthHandler) issueTokens(c *gin.Context, client *models.OAuthClient, user *models.User, grants auth.Grants, scopes []string, familyID uuid.UUID) (gin.H, error) {
+	accessToken, err := auth.GenerateScopedAccessToken(h.keys, user, grants, client.ClientID, scopes, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !slices.Contains(client.GrantTypes, GrantRefreshToken) {
+		return tokenResponse(accessToken, "", scopes), nil
+	}
+
+	refreshToken, record, err := newRefreshToken(c, user.ID, familyID, "")
+	if err != nil {
+		return nil, err
+	}
+	record.ClientID = client.ClientID
+	record.Scopes = scopes
+
+	if err := h.refreshTokenRepo.Create(c.Request.Context(), record); err != nil {
+		return nil, err
+	}
+
+	return tokenResponse(accessToken, refreshToken, scopes), nil
+}
+
+// tokenResponse is a successful token response (RFC 6749 section 5.1)
+func tokenResponse(accessToken string, refreshToken string, scopes []string) gin.H {
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.AccessTokenLifetime().Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	}
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+	return response
+}
+
+// verifyCodeChallenge checks a PKCE verifier against the S256 challenge (RFC 7636)
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// authenticateClient identifies the calling client from HTTP Basic credentials or
+// the client_id and client_secret form parameters. Public clients only send their
+// id; confidential clients must send their secret.
+func (h *OAuthHandler) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// Basic credentials are form encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	client, err := h.clientRepo.GetByClientID(c.Request.Context(), clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, newOAuthError("server_error", "failed to load client"))
+		return nil, false
+	}
+
+	authenticated := client != nil
+	if authenticated && !client.IsPublic() {
+		authenticated = subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) == 1
+	}
+
+	if !authenticated {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.JSON(http.StatusUnauthorized, newOAuthError("invalid_client", "client authentication failed"))
+		return nil, false
+	}
+	return client, true
+}
+
+// ---------- INTROSPECT ----------
+// POST /oauth/introspect
+// Introspect reports whether a token is active (RFC 7662). Tokens of other clients,
+// and of our own login, are reported inactive unless the caller is a resource
+// server; refresh tokens only to their own client.
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if client.IsPublic() {
+		c.JSON(http.StatusUnauthorized, newOAuthError("invalid_client", "public clients cannot introspect tokens"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	token := c.PostForm("token")
+	inactive := gin.H{"active": false}
+
+	if claims, err := h.keys.Verify(token); err == nil {
+		if claims[sharedauth.ClaimTokenUse] != sharedauth.TokenUseAccess || sharedauth.CheckRevoked(ctx, claims) != nil {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+		if issuedTo, _ := claims[sharedauth.ClaimClientID].(string); issuedTo != client.ClientID && !client.ResourceServer {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+
+		response := gin.H{
+			"active":     true,
+			"token_type": "Bearer",
+			"sub":        claims["sub"],
+			"exp":        claims[sharedauth.ClaimExp],
+			"iat":        claims[sharedauth.ClaimIssuedAt],
+			"jti":        claims[sharedauth.ClaimTokenID],
+			"scope":      claims[sharedauth.ClaimScope],
+			"client_id":  claims[sharedauth.ClaimClientID],
+			"username":   claims[sharedauth.ClaimUserEmail],
+		}
+		if response["sub"] == nil {
+			response["sub"] = claims[sharedauth.ClaimUserID]
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	refreshToken, err := h.refreshTokenRepo.GetByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, newOAuthError("server_error", "failed to load token"))
+		return
+	}
+	if refreshToken == nil || refreshToken.ClientID != client.ClientID || refreshToken.RevokedAt != nil || refreshToken.IsExpired(time.Now()) {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"token_type": GrantRefreshToken,
+		"sub":        refreshToken.UserID.String(),
+		"exp":        refreshToken.ExpiresAt.Unix(),
+		"iat":        refreshToken.CreatedAt.Unix(),
+		"scope":      strings.Join(refreshToken.Scopes, " "),
+		"client_id":  refreshToken.ClientID,
+	})
+}
+
+// ---------- REVOKE ----------
+// POST /oauth/revoke
+// Revoke invalidates a token the client holds (RFC 7009). Revoking a refresh token
+// also revokes the access tokens issued from its family. Unknown tokens and tokens
+// of other clients are ignored, the response is always 200.
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	token := c.PostForm("token")
+
+	if claims, err := h.keys.Verify(token); err == nil {
+		tokenID, _ := claims[sharedauth.ClaimTokenID].(string)
+		expiresAt, err := claims.GetExpirationTime()
+		if claims[sharedauth.ClaimClientID] == client.ClientID && tokenID != "" && err == nil && expiresAt != nil {
+			if err := h.revocations.RevokeToken(ctx, tokenID, expiresAt.Time); err != nil {
+				c.JSON(http.StatusServiceUnavailable, newOAuthError("temporarily_unavailable", "failed to revoke token"))
+				return
+			}
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	refreshToken, err := h.refreshTokenRepo.GetByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, newOAuthError("temporarily_unavailable", "failed to revoke token"))
+		return
+	}
+	if refreshToken != nil && refreshToken.ClientID == client.ClientID {
+		if err := revokeSession(ctx, h.revocations, h.refreshTokenRepo, refreshToken.FamilyID); err != nil {
+			c.JSON(http.StatusServiceUnavailable, newOAuthError("temporarily_unavailable", "failed to revoke token"))
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// How long the user may take to sign in at the provider
+const oidcAuthRequestLifetime = 10 * time.Minute
+
+var (
+	errUnverifiedEmail   = errors.New("the provider did not confirm an email address for this account")
+	errUnverifiedAccount = errors.New("an account with this email exists but its email is not verified, sign in with your password and verify it first")
+)
+
+type OIDCHandler struct {
+	providers        map[string]*auth.OIDCProvider
+	userRepo         repository.IUserRepository
+	roleRepo         repository.IRoleRepository
+	identityRepo     repository.IUserIdentityRepository
+	authRequestRepo  repository.IOIDCAuthRequestRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	revocations      sharedauth.RevocationStore
+	keys             *auth.KeyRing
+	sessions         *sessionIssuer
+}
+
+func NewOIDCHandler(providers map[string]*auth.OIDCProvider,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	identityRepo repository.IUserIdentityRepository,
+	authRequestRepo repository.IOIDCAuthRequestRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	sessionRepo repository.ISessionRepository,
+	revocations sharedauth.RevocationStore,
+	keys *auth.KeyRing) *OIDCHandler {
+	return &OIDCHandler{
+		providers:        providers,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		identityRepo:     identityRepo,
+		authRequestRepo:  authRequestRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocations:      revocations,
+		keys:             keys,
+		sessions:         &sessionIssuer{userRepo: userRepo, roleRepo: roleRepo, sessionRepo: sessionRepo, keys: keys},
+	}
+}
+
+func RegisterOIDCRoutes(rg *gin.RouterGroup,
+	providers map[string]*auth.OIDCProvider,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	identityRepo repository.IUserIdentityRepository,
+	authRequestRepo repository.IOIDCAuthRequestRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	sessionRepo repository.ISessionRepository,
+	revocations sharedauth.RevocationStore,
+	keys *auth.KeyRing) {
+
+	handler := NewOIDCHandler(providers, userRepo, roleRepo, identityRepo, authRequestRepo, refreshTokenRepo, sessionRepo, revocations, keys)
+
+	rg.GET("/providers", handler.GetProviders)
+	rg.POST("/:provider/authorize", handler.Authorize)
+	rg.POST("/:provider/callback", handler.Callback)
+}
+
+// GET /auth/oidc/providers
+func (h *OIDCHandler) GetProviders(c *gin.Context) {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// provider returns the provider named in the path, or writes 404
+func (h *OIDCHandler) provider(c *gin.Context) (*auth.OIDCProvider, bool) {
+	provider, found := h.providers[c.Param("provider")]
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// POST /auth/oidc/:provider/authorize
+// Authorize starts a login with the provider. The frontend sends the user to the
+// returned URL and posts the code and state the provider redirects back with to Callback.
+// The state is bound to the browser starting the login: the frontend keeps a random
+// verifier in its session storage and sends only its S256 challenge here, so a
+// state and code planted in another browser cannot complete there (login CSRF).
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req struct {
+		BrowserChallenge string `json:"browserChallenge" binding:"required,len=43"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	state, stateHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	nonce, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	codeVerifier, codeChallenge, err := auth.NewPKCEVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(ctx, state, nonce, codeChallenge)
+	if err != nil {
+		log.Printf("failed to build authorization url: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+
+	// Abandoned logins are swept whenever a new one starts
+	if _, err := h.authRequestRepo.DeleteExpired(ctx); err != nil {
+		log.Printf("failed to delete expired oidc logins: %v", err)
+	}
+
+	if err := h.authRequestRepo.Create(ctx, &models.OIDCAuthRequest{
+		StateHash:        stateHash,
+		Provider:         c.Param("provider"),
+		Nonce:            nonce,
+		CodeVerifier:     codeVerifier,
+		BrowserChallenge: req.BrowserChallenge,
+		ExpiresAt:        time.Now().Add(oidcAuthRequestLifetime),
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorizationUrl": authorizationURL,
+		"state":            state,
+	})
+}
+
+// POST /auth/oidc/:provider/callback
+// Callback redeems the code the provider returned and logs the user in, linking
+// or creating the account the identity belongs to
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var req struct {
+		Code            string `json:"code" binding:"required"`
+		State           string `json:"state" binding:"required"`
+		BrowserVerifier string `json:"browserVerifier" binding:"required"`
+		DeviceID        string `json:"deviceId" binding:"max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	providerName := c.Param("provider")
+
+	authRequest, err := h.authRequestRepo.Consume(ctx, auth.HashToken(req.State))
+	if err != nil {
+		if errors.Is(err, repository.ErrAuthRequestInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load login state"})
+		return
+	}
+	if authRequest.Provider != providerName || !verifyCodeChallenge(req.BrowserVerifier, authRequest.BrowserChallenge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrAuthRequestInvalid.Error()})
+		return
+	}
+
+	claims, err := provider.Exchange(ctx, req.Code, authRequest.CodeVerifier, authRequest.Nonce)
+	if err != nil {
+		log.Printf("failed to complete %s login: %v", providerName, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider login failed"})
+		return
+	}
+
+	user, err := h.resolveUser(ctx, providerName, claims)
+	if err != nil {
+		if errors.Is(err, errUnverifiedEmail) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errUnverifiedAccount) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+
+	if retryAfter := lockedFor(user, time.Now()); retryAfter > 0 {
+		tooManyAttempts(c, retryAfter)
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+
+	grants, err := resolveGrants(ctx, h.roleRepo, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil || requiresMFA(grants) {
+		respondMFAChallenge(c, h.keys, user)
+		return
+	}
+
+	tokens, err := h.sessions.start(c, user, req.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// resolveUser returns the user the external identity belongs to. Unknown identities
+// are linked to the account with the same email, or get a new CUSTOMER account.
+// Both only happen for emails the provider verified, otherwise anyone could claim
+// an account by registering its email at a provider.
+//
+// Local accounts are only linked once their own email is verified too: anyone can
+// register an email they do not own, and linking would hand them the account of
+// its owner on their first social login. A verified account already proved it owns
+// the email, so linking keeps its password and sessions.
+func (h *OIDCHandler) resolveUser(ctx context.Context, provider string, claims auth.OIDCClaims) (*models.User, error) {
+	identity, err := h.identityRepo.GetByProviderSubject(ctx, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		if err := h.identityRepo.TouchLogin(ctx, identity.ID); err != nil {
+			log.Printf("failed to record login of identity %s: %v", identity.ID, err)
+		}
+
+		user, err := h.userRepo.GetByID(ctx, identity.UserID)
+		if err == nil && user == nil {
+			err = fmt.Errorf("identity %s belongs to a missing user", identity.ID)
+		}
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err := h.userRepo.GetByEmail(ctx, claims.Email)
+	if err != nil || user == nil {
+		user, err = h.provisionUser(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	} else if user.EmailVerifiedAt == nil {
+		return nil, errUnverifiedAccount
+	}
+
+	now := time.Now()
+	if err := h.identityRepo.Create(ctx, &models.UserIdentity{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionUser creates a CUSTOMER account for a first social login. It has no
+// password, the user can set one through the password reset flow.
+func (h *OIDCHandler) provisionUser(ctx context.Context, claims auth.OIDCClaims) (*models.User, error) {
+	customerRole, err := h.roleRepo.GetByName(ctx, sharedauth.RoleCustomer)
+	if err != nil {
+		return nil, err
+	}
+	if customerRole == nil {
+		return nil, errors.New("customer role is missing")
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:              uuid.New(),
+		Email:           claims.Email,
+		Name:            truncate(name, 100),
+		EmailVerifiedAt: &now,
+		RoleID:          customerRole.ID,
+	}
+
+	if err := h.userRepo.Create(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	// Load the role the access token names
+	return h.userRepo.GetByID(ctx, user.ID)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// fakeUserRepository holds one local account. Methods resolveUser does not call
+// panic through the nil embedded interface.
+type fakeUserRepository struct {
+	repository.IUserRepository
+	user *models.User
+}
+
+func (r *fakeUserRepository) GetByEmail(_ context.Context, email string) (*models.User, error) {
+	if r.user == nil || r.user.Email != email {
+		return nil, errors.New("record not found")
+	}
+	user := *r.user
+	return &user, nil
+}
+
+type fakeUserIdentityRepository struct {
+	repository.IUserIdentityRepository
+	created []models.UserIdentity
+}
+
+func (r *fakeUserIdentityRepository) GetByProviderSubject(context.Context, string, string) (*models.UserIdentity, error) {
+	return nil, nil
+}
+
+func (r *fakeUserIdentityRepository) Create(_ context.Context, identity *models.UserIdentity) error {
+	r.created = append(r.created, *identity)
+	return nil
+}
+
+type fakeRefreshTokenRepository struct {
+	repository.IRefreshTokenRepository
+	revokedFor []uuid.UUID
+}
+
+func (r *fakeRefreshTokenRepository) RevokeAllForUser(_ context.Context, userID uuid.UUID) error {
+	r.revokedFor = append(r.revokedFor, userID)
+	return nil
+}
+
+func newLinkingHandler(user *models.User) (*OIDCHandler, *fakeUserRepository, *fakeUserIdentityRepository, *fakeRefreshTokenRepository, sharedauth.RevocationStore) {
+	users := &fakeUserRepository{user: user}
+	identities := &fakeUserIdentityRepository{}
+	refreshTokens := &fakeRefreshTokenRepository{}
+	revocations := sharedauth.NewMemoryRevocationStore(time.Hour)
+
+	handler := NewOIDCHandler(nil, users, nil, identities, nil, refreshTokens, nil, revocations, nil)
+	return handler, users, identities, refreshTokens, revocations
+}
+
+func TestResolveUserLinksVerifiedAccount(t *testing.T) {
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+	user := &models.User{ID: uuid.New(), Email: "jane@example.com", Password: "hash", EmailVerifiedAt: &verifiedAt}
+	handler, users, identities, refreshTokens, revocations := newLinkingHandler(user)
+
+	linked, err := handler.resolveUser(context.Background(), "google", auth.OIDCClaims{
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+
+	if linked.ID != user.ID || linked.Password != "hash" || users.user.Password != "hash" {
+		t.Fatalf("linking cleared the password of the account: %+v", linked)
+	}
+	if len(identities.created) != 1 || identities.created[0].UserID != user.ID || identities.created[0].Subject != "subject-1" {
+		t.Fatalf("unexpected identities %+v", identities.created)
+	}
+	if len(refreshTokens.revokedFor) != 0 {
+		t.Fatalf("refresh tokens of the account were revoked: %v", refreshTokens.revokedFor)
+	}
+	if watermark, _ := revocations.IssuedBefore(context.Background(), user.ID.String()); !watermark.IsZero() {
+		t.Fatal("access tokens of the account were revoked")
+	}
+}
+
+func TestResolveUserRefusesUnverifiedAccount(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: "jane@example.com", Password: "hash"}
+	handler, _, identities, refreshTokens, _ := newLinkingHandler(user)
+
+	_, err := handler.resolveUser(context.Background(), "google", auth.OIDCClaims{
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+	})
+	if !errors.Is(err, errUnverifiedAccount) {
+		t.Fatalf("resolveUser returned %v, want %v", err, errUnverifiedAccount)
+	}
+	if len(identities.created) != 0 || len(refreshTokens.revokedFor) != 0 {
+		t.Fatal("an unverified account was changed")
+	}
+}
+
+func TestResolveUserRefusesUnverifiedProviderEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	user := &models.User{ID: uuid.New(), Email: "jane@example.com", EmailVerifiedAt: &verifiedAt}
+	handler, _, identities, _, _ := newLinkingHandler(user)
+
+	_, err := handler.resolveUser(context.Background(), "google", auth.OIDCClaims{
+		Subject: "subject-1",
+		Email:   "jane@example.com",
+	})
+	if !errors.Is(err, errUnverifiedEmail) {
+		t.Fatalf("resolveUser returned %v, want %v", err, errUnverifiedEmail)
+	}
+	if len(identities.created) != 0 {
+		t.Fatal("an identity was linked on an unverified provider email")
+	}
+}
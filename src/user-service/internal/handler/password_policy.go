@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// checkNewPassword responds with every rule password breaks for the account with
+// email and name. It reports whether the password is acceptable.
+func checkNewPassword(c *gin.Context, policy auth.PasswordPolicy, password string, email string, name string) bool {
+	violations, err := policy.Check(c.Request.Context(), password, email, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check password"})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "password does not meet the requirements",
+			"violations": violations,
+		})
+		return false
+	}
+	return true
+}
+
+// rehashPassword upgrades the hash of a password that was just verified, when it was
+// made with another cost than the policy uses. Failing to do so only postpones it.
+func rehashPassword(ctx context.Context, userRepo repository.IUserRepository, policy auth.PasswordPolicy, user *models.User, password string) {
+	if !policy.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashed, err := policy.Hash(password)
+	if err != nil {
+		log.Printf("failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	if err := userRepo.ReplacePasswordHash(ctx, user.ID, user.Password, hashed); err != nil {
+		log.Printf("failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	user.Password = hashed
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// PasswordResetOptions configures the links mailed by the password reset flow
+type PasswordResetOptions struct {
+	URL string // page of the frontend that receives ?token=
+	TTL time.Duration
+}
+
+// PasswordResetProtection limits how often reset links are requested, per email
+// address and per client IP. Every request counts, so an address backs off alike
+// whether or not an account has it. Addresses are tracked in the database, like
+// failed logins, so their cooldown is shared by every instance.
+type PasswordResetProtection struct {
+	Email    auth.LockoutPolicy
+	Requests repository.IPasswordResetRequestRepository
+	IP       *auth.AttemptLimiter
+}
+
+type PasswordResetHandler struct {
+	userRepo         repository.IUserRepository
+	resetTokenRepo   repository.IPasswordResetTokenRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	revocations      sharedauth.RevocationStore
+	mailer           mailer.Mailer
+	options          PasswordResetOptions
+	protection       PasswordResetProtection
+	passwords        auth.PasswordPolicy
+}
+
+func NewPasswordResetHandler(userRepo repository.IUserRepository,
+	resetTokenRepo repository.IPasswordResetTokenRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	revocations sharedauth.RevocationStore,
+	mailer mailer.Mailer,
+	options PasswordResetOptions,
+	protection PasswordResetProtection,
+	passwords auth.PasswordPolicy) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		userRepo:         userRepo,
+		resetTokenRepo:   resetTokenRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocations:      revocations,
+		mailer:           mailer,
+		options:          options,
+		protection:       protection,
+		passwords:        passwords,
+	}
+}
+
+func RegisterPasswordResetRoutes(rg *gin.RouterGroup,
+	userRepo repository.IUserRepository,
+	resetTokenRepo repository.IPasswordResetTokenRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	revocations sharedauth.RevocationStore,
+	mailer mailer.Mailer,
+	options PasswordResetOptions,
+	protection PasswordResetProtection,
+	passwords auth.PasswordPolicy) {
+
+	handler := NewPasswordResetHandler(userRepo, resetTokenRepo, refreshTokenRepo, revocations, mailer, options, protection, passwords)
+
+	rg.POST("/forgot-password", handler.ForgotPassword)
+	rg.POST("/reset-password", handler.ResetPassword)
+}
+
+// ---------- FORGOT PASSWORD ----------
+// ForgotPassword mails a reset link. The account is looked up after the response,
+// which is the same whether or not the email is registered, so the endpoint cannot
+// be used to discover accounts. Requests for an address or from a client IP made
+// during their cooldown are refused.
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	emailHash := auth.LoginAttemptKey(req.Email)
+
+	retryAfter, err := h.resetBlockedFor(ctx, emailHash, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check password reset requests"})
+		return
+	}
+	retryAfter = max(retryAfter, h.protection.IP.RetryAfter(c.ClientIP(), now))
+	if retryAfter > 0 {
+		tooManyRequests(c, retryAfter, "too many password reset requests, try again later")
+		return
+	}
+
+	h.protection.IP.Fail(c.ClientIP(), now)
+	if err := h.recordResetRequest(ctx, emailHash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record password reset request"})
+		return
+	}
+
+	inBackground(func(ctx context.Context) {
+		user, err := h.userRepo.GetByEmail(ctx, req.Email)
+		if err != nil || user == nil {
+			return
+		}
+		if err := h.sendResetLink(ctx, user); err != nil {
+			log.Printf("failed to start password reset for user %s: %v", user.ID, err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered, a password reset link has been sent"})
+}
+
+// resetBlockedFor returns how long reset links for the email address are still refused
+func (h *PasswordResetHandler) resetBlockedFor(ctx context.Context, emailHash string, now time.Time) (time.Duration, error) {
+	blockedUntil, err := h.protection.Requests.BlockedUntil(ctx, emailHash)
+	if err != nil || blockedUntil == nil || !now.Before(*blockedUntil) {
+		return 0, err
+	}
+	return blockedUntil.Sub(now), nil
+}
+
+// recordResetRequest counts a reset link requested for the email address and
+// blocks the next one for the cooldown the policy gives
+func (h *PasswordResetHandler) recordResetRequest(ctx context.Context, emailHash string) error {
+	policy := h.protection.Email
+
+	requests, err := h.protection.Requests.RecordRequest(ctx, emailHash, policy.Window)
+	if err != nil {
+		return err
+	}
+
+	delay := policy.Delay(requests)
+	if delay == 0 {
+		return nil
+	}
+	return h.protection.Requests.BlockUntil(ctx, emailHash, time.Now().Add(delay))
+}
+
+// sendResetLink replaces any outstanding reset token of the user and mails the new one
+func (h *PasswordResetHandler) sendResetLink(ctx context.Context, user *models.User) error {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.resetTokenRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := h.resetTokenRepo.Create(ctx, &models.PasswordResetToken{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(h.options.TTL),
+	}); err != nil {
+		return err
+	}
+
+	resetURL, err := tokenURL(h.options.URL, token)
+	if err != nil {
+		return err
+	}
+
+	message, err := mailer.Render(mailer.TemplatePasswordReset, user.Email, map[string]any{
+		"Name":      user.Name,
+		"ResetURL":  resetURL,
+		"ExpiresIn": formatDuration(h.options.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	sendInBackground(h.mailer, message, user.ID)
+	return nil
+}
+
+// ---------- RESET PASSWORD ----------
+// ResetPassword redeems a reset token, sets the new password and ends every session of the user
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	resetToken, err := h.resetTokenRepo.GetByHash(ctx, auth.HashToken(req.Token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reset token"})
+		return
+	}
+	if resetToken == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrResetTokenInvalid.Error()})
+		return
+	}
+
+	user, err := h.userRepo.GetByID(ctx, resetToken.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrResetTokenInvalid.Error()})
+		return
+	}
+
+	// Checked before the token is redeemed, so a refused password does not cost the link
+	if !checkNewPassword(c, h.passwords, req.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	if err := h.resetTokenRepo.Consume(ctx, resetToken.ID); err != nil {
+		if errors.Is(err, repository.ErrResetTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem reset token"})
+		return
+	}
+
+	hashed, err := h.passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	user.Password = hashed
+	user.LatestUpdatedAt = time.Now()
+
+	if err := h.userRepo.Update(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+		return
+	}
+
+	if err := revokeUserTokens(ctx, h.revocations, h.refreshTokenRepo, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+type PermissionHandler struct {
+	permissionRepo repository.IPermissionRepository
+}
+
+func NewPermissionHandler(permissionRepo repository.IPermissionRepository) *PermissionHandler {
+	return &PermissionHandler{
+		permissionRepo: permissionRepo,
+	}
+}
+
+func RegisterPermissionRoutes(rg *gin.RouterGroup, permissionRepo repository.IPermissionRepository) {
+	handler := NewPermissionHandler(permissionRepo)
+
+	rg.GET("", authmw.AuthMiddleware(), authmw.RequireFirstParty(), authmw.RequirePermission(sharedauth.PermissionRoleManage), handler.GetPermissions)
+}
+
+// GET /permissions
+// GetPermissions lists the permissions roles can be given
+func (h *PermissionHandler) GetPermissions(c *gin.Context) {
+	permissions, err := h.permissionRepo.GetMany(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, permissions)
+}
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/mailer"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/privacy"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recentLoginWindow is how long after signing in users without a password or second
+// factor may still delete their account, see reauthenticate
+const recentLoginWindow = 10 * time.Minute
+
+type PrivacyHandler struct {
+	userRepo         repository.IUserRepository
+	addressRepo      repository.IAddressRepository
+	sessionRepo      repository.ISessionRepository
+	userIdentityRepo repository.IUserIdentityRepository
+	consentRepo      repository.IOAuthConsentRepository
+	apiKeyRepo       repository.IAPIKeyRepository
+	mfa              *mfaVerifier
+	guard            *loginGuard
+	hooks            *privacy.Hooks
+	mailer           mailer.Mailer
+	gracePeriod      time.Duration
+}
+
+func NewPrivacyHandler(userRepo repository.IUserRepository,
+	addressRepo repository.IAddressRepository,
+	sessionRepo repository.ISessionRepository,
+	userIdentityRepo repository.IUserIdentityRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	apiKeyRepo repository.IAPIKeyRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	secrets *auth.SecretBox,
+	hooks *privacy.Hooks,
+	mailer mailer.Mailer,
+	gracePeriod time.Duration,
+	protection LoginProtection) *PrivacyHandler {
+	return &PrivacyHandler{
+		userRepo:         userRepo,
+		addressRepo:      addressRepo,
+		sessionRepo:      sessionRepo,
+		userIdentityRepo: userIdentityRepo,
+		consentRepo:      consentRepo,
+		apiKeyRepo:       apiKeyRepo,
+		mfa:              &mfaVerifier{userRepo: userRepo, recoveryCodeRepo: recoveryCodeRepo, secrets: secrets},
+		guard:            &loginGuard{userRepo: userRepo, protection: protection},
+		hooks:            hooks,
+		mailer:           mailer,
+		gracePeriod:      gracePeriod,
+	}
+}
+
+// RegisterPrivacyRoutes lets users export their data and delete their account. Only
+// our apps may, delegated clients and API keys never act on these.
+func RegisterPrivacyRoutes(rg *gin.RouterGroup,
+	userRepo repository.IUserRepository,
+	addressRepo repository.IAddressRepository,
+	sessionRepo repository.ISessionRepository,
+	userIdentityRepo repository.IUserIdentityRepository,
+	consentRepo repository.IOAuthConsentRepository,
+	apiKeyRepo repository.IAPIKeyRepository,
+	recoveryCodeRepo repository.IRecoveryCodeRepository,
+	secrets *auth.SecretBox,
+	hooks *privacy.Hooks,
+	mailer mailer.Mailer,
+	gracePeriod time.Duration,
+	protection LoginProtection) {
+
+	handler := NewPrivacyHandler(userRepo, addressRepo, sessionRepo, userIdentityRepo, consentRepo, apiKeyRepo, recoveryCodeRepo, secrets, hooks, mailer, gracePeriod, protection)
+
+	me := rg.Group("/me", authmw.AuthMiddleware(), authmw.RequireFirstParty())
+	me.POST("/export", handler.ExportData)
+	me.DELETE("", handler.DeleteAccount)
+	me.POST("/cancel-deletion", handler.CancelDeletion)
+}
+
+// ---------- EXPORT ----------
+// POST /users/me/export
+// ExportData returns a zip archive of the personal data we hold about the
+// authenticated user: a JSON file per kind of data here, and the document of every
+// other service holding some under services/
+func (h *PrivacyHandler) ExportData(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	addresses, err := h.addressRepo.GetByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch addresses"})
+		return
+	}
+	sessions, err := h.sessionRepo.GetActiveByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sessions"})
+		return
+	}
+	identities, err := h.userIdentityRepo.GetByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch linked accounts"})
+		return
+	}
+	consents, err := h.consentRepo.GetByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch consents"})
+		return
+	}
+	apiKeys, err := h.apiKeyRepo.GetByUser(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch api keys"})
+		return
+	}
+
+	services, err := h.hooks.Export(ctx, user.ID)
+	if err != nil {
+		log.Printf("failed to export data of user %s: %v", user.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to export data from other services"})
+		return
+	}
+
+	current := currentSessionID(c)
+	sessionResponses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, newSessionResponse(session, current))
+	}
+
+	files := map[string]any{
+		"profile.json":         newUserResponse(*user),
+		"addresses.json":       addresses,
+		"sessions.json":        sessionResponses,
+		"linked-accounts.json": identities,
+		"oauth-consents.json":  consents,
+		"api-keys.json":        newAPIKeyResponses(apiKeys),
+	}
+	for name, document := range services {
+		files["services/"+name+".json"] = document
+	}
+
+	archive, err := buildArchive(files)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build archive"})
+		return
+	}
+
+	filename := "account-data-" + time.Now().UTC().Format("20060102") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// buildArchive zips every value as the indented JSON file it is keyed by
+func buildArchive(files map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for name, value := range files {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ---------- DELETION ----------
+// DELETE /users/me
+// DeleteAccount schedules the erasure of the authenticated user's personal data
+// after the grace period. Until then the user can still sign in and cancel it.
+// The user confirms it, see reauthenticate.
+func (h *PrivacyHandler) DeleteAccount(c *gin.Context) {
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "account deletion already scheduled"})
+		return
+	}
+	if !h.reauthenticate(c, user, req.Password, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	scheduledAt := time.Now().Add(h.gracePeriod)
+	if err := h.userRepo.ScheduleDeletion(c.Request.Context(), user.ID, &scheduledAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule account deletion"})
+		return
+	}
+
+	h.sendDeletionNotice(user, scheduledAt)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":             "account scheduled for deletion",
+		"deletionScheduledAt": scheduledAt,
+	})
+}
+
+// POST /users/me/cancel-deletion
+func (h *PrivacyHandler) CancelDeletion(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.DeletionScheduledAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "no account deletion scheduled"})
+		return
+	}
+
+	if err := h.userRepo.ScheduleDeletion(c.Request.Context(), user.ID, nil); err != nil {
+		if errors.Is(err, repository.ErrAccountErased) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deletion cancelled"})
+}
+
+// reauthenticate checks the request comes from the user, not just from a stolen
+// access token. Users confirm with their password. Those signing in through a
+// social login have none: they give a second factor code if they enrolled one, and
+// otherwise must have signed in again within recentLoginWindow. Wrong passwords and
+// codes count as failed logins and back off like them.
+func (h *PrivacyHandler) reauthenticate(c *gin.Context, user *models.User, password string, code string, recoveryCode string) bool {
+	if (user.Password != "" || user.TOTPEnabledAt != nil) && h.guard.refuse(c, user) {
+		return false
+	}
+
+	if user.Password != "" {
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+			h.guard.fail(c, user)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return false
+		}
+		return true
+	}
+
+	ctx := c.Request.Context()
+
+	if user.TOTPEnabledAt != nil {
+		if err := h.mfa.verify(ctx, user, code, recoveryCode); err != nil {
+			if errors.Is(err, errInvalidMFACode) {
+				h.guard.fail(c, user)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify two-factor code"})
+			return false
+		}
+		return true
+	}
+
+	// Refreshing keeps the session, so its start is when the user last signed in
+	session, err := h.sessionRepo.GetActiveForUser(ctx, user.ID, currentSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch session"})
+		return false
+	}
+	if session == nil || time.Since(session.CreatedAt) > recentLoginWindow {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in again to delete your account"})
+		return false
+	}
+	return true
+}
+
+// sendDeletionNotice tells the user when their data is erased, so a deletion they
+// did not ask for can still be cancelled
+func (h *PrivacyHandler) sendDeletionNotice(user *models.User, scheduledAt time.Time) {
+	message, err := mailer.Render(mailer.TemplateAccountDeletion, user.Email, map[string]any{
+		"Name":         user.Name,
+		"DeletionDate": scheduledAt.UTC().Format("2 January 2006"),
+	})
+	if err != nil {
+		log.Printf("failed to render account deletion email for user %s: %v", user.ID, err)
+		return
+	}
+	sendInBackground(h.mailer, message, user.ID)
+}
+
+// currentUser loads the authenticated user. Erased accounts have no data left to act on.
+func (h *PrivacyHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return nil, false
+	}
+	if user == nil || user.ErasedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
@@ -1,117 +1,458 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
 	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
 )
 
+// builtInRoles are referenced by name across the services, so they can be neither
+// renamed nor deleted
+var builtInRoles = []string{sharedauth.RoleCustomer, sharedauth.RoleEmployee, sharedauth.RoleAdmin}
+
+// RoleRequest is the body of role create requests
+type RoleRequest struct {
+	Name        string     `json:"name" binding:"required,max=50"`
+	Description string     `json:"description" binding:"max=255"`
+	ParentID    *uuid.UUID `json:"parentID"`
+}
+
+// RoleUpdateRequest is the body of role update requests. A role keeps its parent
+// unless parentID is sent, null detaches it.
+type RoleUpdateRequest struct {
+	Name        string       `json:"name" binding:"required,max=50"`
+	Description string       `json:"description" binding:"max=255"`
+	ParentID    optionalUUID `json:"parentID"`
+}
+
+// optionalUUID tells a field sent as null from a field not sent at all
+type optionalUUID struct {
+	Set   bool
+	Value *uuid.UUID
+}
+
+func (o *optionalUUID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// RoleResponse is a role as the API returns it
+type RoleResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ParentID    *uuid.UUID `json:"parentID"`
+	BuiltIn     bool       `json:"builtIn"`
+	Permissions []string   `json:"permissions"`
+}
+
+func newRoleResponse(role models.Role) RoleResponse {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+	slices.Sort(permissions)
+
+	return RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		ParentID:    role.ParentID,
+		BuiltIn:     slices.Contains(builtInRoles, role.Name),
+		Permissions: permissions,
+	}
+}
+
+// RoleMemberResponse is a user holding a role
+type RoleMemberResponse struct {
+	ID      uuid.UUID `json:"id"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name"`
+	Primary bool      `json:"primary"` // whether the role is the primary role of the user
+}
+
 type RoleHandler struct {
-	repo     repository.IBaseRepository[models.Role]
-	userRepo repository.IBaseRepository[models.User]
+	roleRepo       repository.IRoleRepository
+	permissionRepo repository.IPermissionRepository
+	userRepo       repository.IUserRepository
+	revocations    sharedauth.RevocationStore
 }
 
 func NewRoleHandler(roleRepo repository.IRoleRepository,
-	userRepo repository.IUserRepository) *RoleHandler {
+	permissionRepo repository.IPermissionRepository,
+	userRepo repository.IUserRepository,
+	revocations sharedauth.RevocationStore) *RoleHandler {
 	return &RoleHandler{
-		repo:     roleRepo,
-		userRepo: userRepo,
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		userRepo:       userRepo,
+		revocations:    revocations,
 	}
 }
 
 func RegisterRoleRoutes(rg *gin.RouterGroup, roleRepo repository.IRoleRepository,
-	userRepo repository.IUserRepository) {
-	RoleHandler := NewRoleHandler(roleRepo, userRepo)
-	// rg.Use(middleware.AuthMiddleware(), middleware.RequireRole("ADMIN"))
+	permissionRepo repository.IPermissionRepository,
+	userRepo repository.IUserRepository,
+	revocations sharedauth.RevocationStore) {
+	RoleHandler := NewRoleHandler(roleRepo, permissionRepo, userRepo, revocations)
+	rg.Use(authmw.AuthMiddleware(), authmw.RequireFirstParty(), authmw.RequirePermission(sharedauth.PermissionRoleManage))
 
 	rg.GET("", RoleHandler.GetRoles)
 	rg.POST("", RoleHandler.AddRole)
 	rg.GET("/:id", middleware.UUIDParamMiddleware("id"), RoleHandler.GetRoleById)
 	rg.PUT("/:id", middleware.UUIDParamMiddleware("id"), RoleHandler.UpdateRole)
 	rg.DELETE("/:id", middleware.UUIDParamMiddleware("id"), RoleHandler.DeleteRole)
+	rg.PUT("/:id/permissions", middleware.UUIDParamMiddleware("id"), RoleHandler.SetRolePermissions)
+	rg.GET("/:id/users", middleware.UUIDParamMiddleware("id"), RoleHandler.GetRoleUsers)
 }
 
 // GET /roles
 func (h *RoleHandler) GetRoles(c *gin.Context) {
-	roles, err := h.repo.GetMany(c.Request.Context(), nil)
+	roles, err := h.roleRepo.GetAllWithPermissions(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
 		return
 	}
-	c.JSON(http.StatusOK, roles)
+
+	response := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, newRoleResponse(role))
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // POST /roles
 func (h *RoleHandler) AddRole(c *gin.Context) {
-	var role models.Role
-	if err := c.ShouldBindJSON(&role); err != nil {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.repo.Create(c.Request.Context(), &role); err != nil {
+	ctx := c.Request.Context()
+
+	roles, err := h.roleRepo.GetAllWithPermissions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
+		return
+	}
+
+	role := models.Role{
+		ID:          uuid.New(),
+		Name:        normalizeRoleName(req.Name),
+		Description: req.Description,
+		ParentID:    req.ParentID,
+	}
+	if status, err := validateRole(role, roles); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.roleRepo.Create(ctx, &role); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create role"})
 		return
 	}
-	c.JSON(http.StatusCreated, role)
+	c.JSON(http.StatusCreated, newRoleResponse(role))
 }
 
 // GET /roles/:id
 func (h *RoleHandler) GetRoleById(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
+	id := c.MustGet("id").(uuid.UUID)
+
+	role, err := h.roleRepo.GetWithPermissions(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
 		return
 	}
-
-	role, err := h.repo.GetByID(c.Request.Context(), id)
-	if err != nil {
+	if role == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
 		return
 	}
-	c.JSON(http.StatusOK, role)
+	c.JSON(http.StatusOK, newRoleResponse(*role))
 }
 
 // PUT /roles/:id
 func (h *RoleHandler) UpdateRole(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
+	id := c.MustGet("id").(uuid.UUID)
+
+	var req RoleUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	roles, err := h.roleRepo.GetAllWithPermissions(ctx)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
 		return
 	}
 
-	var role models.Role
-	if err := c.ShouldBindJSON(&role); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	index := slices.IndexFunc(roles, func(role models.Role) bool { return role.ID == id })
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+	current := roles[index]
+
+	role := models.Role{
+		ID:          id,
+		Name:        normalizeRoleName(req.Name),
+		Description: req.Description,
+		ParentID:    current.ParentID,
+	}
+	if req.ParentID.Set {
+		role.ParentID = req.ParentID.Value
+	}
+	if slices.Contains(builtInRoles, current.Name) {
+		if role.Name != current.Name {
+			c.JSON(http.StatusForbidden, gin.H{"error": "built-in roles cannot be renamed"})
+			return
+		}
+		// Inheriting would silently widen a role every user or employee holds
+		if !equalRoleIDs(role.ParentID, current.ParentID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the parent of built-in roles cannot be changed"})
+			return
+		}
+	}
+	if status, err := validateRole(role, roles); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	role.ID = id // ensure update matches path param
-	if err := h.repo.Update(c.Request.Context(), &role); err != nil {
+	if err := h.roleRepo.Update(ctx, &role); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
 		return
 	}
-	c.JSON(http.StatusOK, role)
+
+	// Access tokens carry the role names and permissions, so tokens issued before the change are stale
+	if err := h.revokeRoleTokens(ctx, current.Name, role.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens of role members"})
+		return
+	}
+
+	role.Permissions = current.Permissions
+	c.JSON(http.StatusOK, newRoleResponse(role))
 }
 
-// DELETE /roles/:id
+// DELETE /roles/:id?reassignTo=:roleId
+// DeleteRole refuses to delete a role users still hold, unless they are moved to
+// the role given by reassignTo
 func (h *RoleHandler) DeleteRole(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
+	id := c.MustGet("id").(uuid.UUID)
+	ctx := c.Request.Context()
+
+	role, err := h.roleRepo.GetByID(ctx, id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
+		return
+	}
+	if role == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+	if slices.Contains(builtInRoles, role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "built-in roles cannot be deleted"})
 		return
 	}
 
-	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+	var reassignTo *uuid.UUID
+	if value := c.Query("reassignTo"); value != "" {
+		targetID, err := uuid.Parse(value)
+		if err != nil || targetID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reassignTo role"})
+			return
+		}
+
+		target, err := h.roleRepo.GetByID(ctx, targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
+			return
+		}
+		if target == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo role not found"})
+			return
+		}
+		reassignTo = &targetID
+	}
+
+	if err := h.roleRepo.DeleteReassigning(ctx, role, reassignTo); err != nil {
+		if errors.Is(err, repository.ErrRoleInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": "role is still assigned to users, pass reassignTo to move them"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete role"})
 		return
 	}
-	c.JSON(http.StatusNoContent, nil)
+
+	if err := h.revokeRoleTokens(ctx, role.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens of role members"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PUT /roles/:id/permissions
+// SetRolePermissions replaces the permissions the role grants by itself. Roles
+// inheriting from it pick the change up as well.
+func (h *RoleHandler) SetRolePermissions(c *gin.Context) {
+	id := c.MustGet("id").(uuid.UUID)
+
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	role, err := h.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
+		return
+	}
+	if role == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	// Otherwise no one could manage roles anymore
+	if role.Name == sharedauth.RoleAdmin && !slices.Contains(req.Permissions, sharedauth.PermissionRoleManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the ADMIN role must keep " + sharedauth.PermissionRoleManage})
+		return
+	}
+
+	permissions, err := h.permissionRepo.GetByNames(ctx, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch permissions"})
+		return
+	}
+	for _, name := range req.Permissions {
+		if !slices.ContainsFunc(permissions, func(permission models.Permission) bool { return permission.Name == name }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission " + name})
+			return
+		}
+	}
+
+	if err := h.roleRepo.SetPermissions(ctx, role, permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role permissions"})
+		return
+	}
+
+	// Access tokens carry the permissions, so tokens issued before the change are stale
+	if err := h.revokeRoleTokens(ctx, role.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens of role members"})
+		return
+	}
+
+	role.Permissions = permissions
+	c.JSON(http.StatusOK, newRoleResponse(*role))
+}
+
+// GET /roles/:id/users?pageIndex=1&pageSize=20
+// GetRoleUsers lists the users holding the role, as primary or additional role
+func (h *RoleHandler) GetRoleUsers(c *gin.Context) {
+	id := c.MustGet("id").(uuid.UUID)
+
+	var page BaseRequest
+	if err := c.ShouldBindQuery(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page.Normalize()
+
+	ctx := c.Request.Context()
+
+	role, err := h.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
+		return
+	}
+	if role == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	users, total, err := h.userRepo.GetPage(ctx, repository.UserFilter{RoleID: &id}, page.Offset(), int(page.PageSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role members"})
+		return
+	}
+
+	members := make([]RoleMemberResponse, 0, len(users))
+	for _, user := range users {
+		members = append(members, RoleMemberResponse{
+			ID:      user.ID,
+			Email:   user.Email,
+			Name:    user.Name,
+			Primary: user.RoleID == id,
+		})
+	}
+
+	c.JSON(http.StatusOK, PaginationData{
+		BaseResponse: BaseResponse{Data: members, Success: true},
+		Count:        int32(total),
+	})
+}
+
+// equalRoleIDs reports whether both role ids are unset or the same
+func equalRoleIDs(a *uuid.UUID, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// normalizeRoleName returns name the way role names are stored, like CUSTOMER
+func normalizeRoleName(name string) string {
+	return strings.ToUpper(strings.TrimSpace(name))
+}
+
+// validateRole checks a created or updated role against the existing roles: its
+// name must be unique and its parent must exist without closing a cycle
+func validateRole(role models.Role, roles []models.Role) (int, error) {
+	if role.Name == "" {
+		return http.StatusBadRequest, errors.New("role name is required")
+	}
+	if slices.ContainsFunc(roles, func(other models.Role) bool { return other.Name == role.Name && other.ID != role.ID }) {
+		return http.StatusConflict, errors.New("role " + role.Name + " already exists")
+	}
+
+	if role.ParentID != nil {
+		if !slices.ContainsFunc(roles, func(other models.Role) bool { return other.ID == *role.ParentID }) {
+			return http.StatusBadRequest, errors.New("parent role not found")
+		}
+		if slices.Contains(auth.RoleDescendants(roles, role.ID), *role.ParentID) {
+			return http.StatusBadRequest, errors.New("parent role would inherit from the role itself")
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// revokeRoleTokens moves the issued-before watermark of the named roles. Tokens list
+// inherited roles too, so this also revokes those of the roles inheriting from them.
+func (h *RoleHandler) revokeRoleTokens(ctx context.Context, names ...string) error {
+	now := time.Now()
+	for _, name := range names {
+		if err := h.revocations.SetIssuedBefore(ctx, sharedauth.RoleRevocationID(name), now); err != nil {
+			return err
+		}
+	}
+	return nil
 }
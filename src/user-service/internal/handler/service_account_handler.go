@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
+)
+
+// ServiceAccountRequest is the body of service account create requests
+type ServiceAccountRequest struct {
+	Name        string    `json:"name" binding:"required,max=100"`
+	Description string    `json:"description" binding:"max=255"`
+	RoleID      uuid.UUID `json:"roleId" binding:"required"`
+}
+
+// ServiceAccountResponse is a service account with the name of its role
+type ServiceAccountResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	RoleID      uuid.UUID `json:"roleId"`
+	Role        string    `json:"role"`
+	CreatedByID uuid.UUID `json:"createdById"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func newServiceAccountResponse(account models.ServiceAccount) ServiceAccountResponse {
+	return ServiceAccountResponse{
+		ID:          account.ID,
+		Name:        account.Name,
+		Description: account.Description,
+		RoleID:      account.RoleID,
+		Role:        account.Role.Name,
+		CreatedByID: account.CreatedByID,
+		CreatedAt:   account.CreatedAt,
+	}
+}
+
+type ServiceAccountHandler struct {
+	serviceAccountRepo repository.IServiceAccountRepository
+	apiKeyRepo         repository.IAPIKeyRepository
+	roleRepo           repository.IRoleRepository
+}
+
+func NewServiceAccountHandler(serviceAccountRepo repository.IServiceAccountRepository,
+	apiKeyRepo repository.IAPIKeyRepository,
+	roleRepo repository.IRoleRepository) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		serviceAccountRepo: serviceAccountRepo,
+		apiKeyRepo:         apiKeyRepo,
+		roleRepo:           roleRepo,
+	}
+}
+
+// RegisterServiceAccountRoutes lets admins manage service accounts and their API keys
+func RegisterServiceAccountRoutes(rg *gin.RouterGroup,
+	serviceAccountRepo repository.IServiceAccountRepository,
+	apiKeyRepo repository.IAPIKeyRepository,
+	roleRepo repository.IRoleRepository) {
+
+	handler := NewServiceAccountHandler(serviceAccountRepo, apiKeyRepo, roleRepo)
+
+	rg.Use(authmw.AuthMiddleware(), authmw.RequireFirstParty(), authmw.RequirePermission(sharedauth.PermissionServiceAccountManage))
+	rg.GET("", handler.GetServiceAccounts)
+	rg.POST("", handler.AddServiceAccount)
+
+	account := rg.Group("/:id", middleware.UUIDParamMiddleware("id"))
+	account.GET("", handler.GetServiceAccountById)
+	account.DELETE("", handler.DeleteServiceAccount)
+	account.GET("/api-keys", handler.GetAPIKeys)
+	account.POST("/api-keys", handler.AddAPIKey)
+	account.DELETE("/api-keys/:keyId", middleware.UUIDParamMiddleware("keyId"), handler.RevokeAPIKey)
+}
+
+// ---------- SERVICE ACCOUNTS ----------
+// GET /service-accounts
+func (h *ServiceAccountHandler) GetServiceAccounts(c *gin.Context) {
+	accounts, err := h.serviceAccountRepo.GetAllWithRole(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch service accounts"})
+		return
+	}
+
+	response := make([]ServiceAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response = append(response, newServiceAccountResponse(account))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /service-accounts
+// AddServiceAccount creates an account holding a role the caller holds too, so no
+// admin can mint a machine identity stronger than themselves
+func (h *ServiceAccountHandler) AddServiceAccount(c *gin.Context) {
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	creatorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	name := strings.TrimSpace(req.Name)
+
+	existing, err := h.serviceAccountRepo.GetByName(ctx, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch service account"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "service account name already exists"})
+		return
+	}
+
+	role, err := h.roleRepo.GetByID(ctx, req.RoleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch role"})
+		return
+	}
+	if role == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role not found"})
+		return
+	}
+	if !slices.Contains(authmw.Roles(c), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot grant a role you do not hold"})
+		return
+	}
+
+	account := models.ServiceAccount{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		RoleID:      role.ID,
+		CreatedByID: creatorID,
+	}
+	if err := h.serviceAccountRepo.Create(ctx, &account); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create service account"})
+		return
+	}
+	account.Role = *role
+
+	c.JSON(http.StatusCreated, newServiceAccountResponse(account))
+}
+
+// GET /service-accounts/:id
+func (h *ServiceAccountHandler) GetServiceAccountById(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newServiceAccountResponse(*account))
+}
+
+// DELETE /service-accounts/:id
+// DeleteServiceAccount revokes every key of the account before deleting it
+func (h *ServiceAccountHandler) DeleteServiceAccount(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if err := h.apiKeyRepo.RevokeForServiceAccount(ctx, account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api keys"})
+		return
+	}
+	if err := h.serviceAccountRepo.Delete(ctx, account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete service account"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ---------- SERVICE ACCOUNT API KEYS ----------
+// The keys of a service account act with its role, so only admins holding that
+// role manage them, like only they may create the account.
+
+// GET /service-accounts/:id/api-keys
+func (h *ServiceAccountHandler) GetAPIKeys(c *gin.Context) {
+	account, ok := h.keyedServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyRepo.GetByServiceAccount(c.Request.Context(), account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch api keys"})
+		return
+	}
+	c.JSON(http.StatusOK, newAPIKeyResponses(keys))
+}
+
+// POST /service-accounts/:id/api-keys
+func (h *ServiceAccountHandler) AddAPIKey(c *gin.Context) {
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, ok := h.keyedServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	grants, err := serviceAccountGrants(c.Request.Context(), h.roleRepo, account)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
+		return
+	}
+
+	issueAPIKey(c, h.apiKeyRepo, req, grants, models.APIKey{ServiceAccountID: &account.ID})
+}
+
+// DELETE /service-accounts/:id/api-keys/:keyId
+func (h *ServiceAccountHandler) RevokeAPIKey(c *gin.Context) {
+	account, ok := h.keyedServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	keyID := c.MustGet("keyId").(uuid.UUID)
+
+	key, err := h.apiKeyRepo.GetByID(ctx, keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch api key"})
+		return
+	}
+	if key == nil || key.ServiceAccountID == nil || *key.ServiceAccountID != account.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+
+	if err := h.apiKeyRepo.Revoke(ctx, key.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
+
+// serviceAccount loads the service account named by the id path parameter
+func (h *ServiceAccountHandler) serviceAccount(c *gin.Context) (*models.ServiceAccount, bool) {
+	id := c.MustGet("id").(uuid.UUID)
+	account, err := h.serviceAccountRepo.GetWithRole(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch service account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "service account not found"})
+		return nil, false
+	}
+	return account, true
+}
+
+// keyedServiceAccount loads the service account named by the id path parameter,
+// refusing callers who do not hold its role
+func (h *ServiceAccountHandler) keyedServiceAccount(c *gin.Context) (*models.ServiceAccount, bool) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return nil, false
+	}
+	if !slices.Contains(authmw.Roles(c), account.Role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot manage api keys of a role you do not hold"})
+		return nil, false
+	}
+	return account, true
+}
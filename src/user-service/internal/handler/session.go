@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// SessionResponse is a login of the authenticated user as listed to them
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceID   string    `json:"deviceId"`
+	DeviceName string    `json:"deviceName"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Current    bool      `json:"current"`
+}
+
+// ---------- SESSIONS ----------
+// GET /auth/sessions
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionRepo.GetActiveByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(session, current))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DELETE /auth/sessions/:id
+// RevokeSession logs one device out, revoking its refresh tokens and the access
+// tokens it already holds
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.MustGet("id").(uuid.UUID)
+
+	session, err := h.sessionRepo.GetActiveForUser(ctx, userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch session"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := revokeSession(ctx, h.revocations, h.refreshTokenRepo, session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// revokeSession ends a session: its refresh token family, and the access tokens
+// issued in it until the last of them expires
+func revokeSession(ctx context.Context,
+	revocations sharedauth.RevocationStore,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	sessionID uuid.UUID) error {
+	if err := refreshTokenRepo.RevokeFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	return revocations.RevokeToken(ctx, sharedauth.SessionRevocationID(sessionID.String()), time.Now().Add(auth.AccessTokenLifetime()))
+}
+
+func newSessionResponse(session models.Session, current uuid.UUID) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		DeviceID:   session.DeviceID,
+		DeviceName: session.DeviceName,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		Current:    session.ID == current,
+	}
+}
+
+// currentSessionID returns the session the access token of the request belongs to,
+// uuid.Nil for tokens issued before sessions were recorded
+func currentSessionID(c *gin.Context) uuid.UUID {
+	claims, _ := authmw.Claims(c)
+	value, _ := claims[sharedauth.ClaimSessionID].(string)
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// Browsers and platforms recognized in user agents, in matching order. Edge and Opera
+// also announce Chrome, and Chrome also announces Safari, so they are checked first.
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"EdgA/", "Edge"},
+		{"EdgiOS/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentPlatforms = []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Macintosh", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// deviceName describes the device of a user agent for people, like "Chrome on
+// Windows". Agents that are not browsers, like mobile apps or HTTP libraries, are
+// named after their first product token.
+func deviceName(userAgent string) string {
+	var browser, platform string
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	for _, candidate := range userAgentPlatforms {
+		if strings.Contains(userAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+
+	product, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	product, _, _ = strings.Cut(product, "/")
+	if product == "" {
+		return "Unknown device"
+	}
+	return truncate(product, 100)
+}
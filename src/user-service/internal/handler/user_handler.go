@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+	authmw "github.com/quochao170402/ecommerce-aws/shared/middleware"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+	"github.com/quochao170402/ecommerce-aws/user-service/middleware"
+)
+
+// UserResponse is a user as the API returns it. Secrets, like the password hash and
+// the TOTP secret, have no field here.
+type UserResponse struct {
+	ID                  uuid.UUID  `json:"id"`
+	Email               string     `json:"email"`
+	Name                string     `json:"name"`
+	EmailVerifiedAt     *time.Time `json:"emailVerifiedAt"`
+	Role                string     `json:"role"`
+	Roles               []string   `json:"roles"` // additional roles
+	Permissions         []string   `json:"permissions,omitempty"`
+	TOTPEnabled         bool       `json:"totpEnabled"`
+	LockedUntil         *time.Time `json:"lockedUntil"`
+	DisabledAt          *time.Time `json:"disabledAt"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+	ErasedAt            *time.Time `json:"erasedAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	LatestUpdatedAt     time.Time  `json:"latestUpdatedAt"`
+}
+
+func newUserResponse(user models.User) UserResponse {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	return UserResponse{
+		ID:                  user.ID,
+		Email:               user.Email,
+		Name:                user.Name,
+		EmailVerifiedAt:     user.EmailVerifiedAt,
+		Role:                user.Role.Name,
+		Roles:               roles,
+		TOTPEnabled:         user.TOTPEnabledAt != nil,
+		LockedUntil:         user.LockedUntil,
+		DisabledAt:          user.DisabledAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		ErasedAt:            user.ErasedAt,
+		CreatedAt:           user.CreatedAt,
+		LatestUpdatedAt:     user.LatestUpdatedAt,
+	}
+}
+
+type UserHandler struct {
+	userRepo         repository.IUserRepository
+	roleRepo         repository.IRoleRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	revocations      sharedauth.RevocationStore
+}
+
+func NewUserHandler(userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	revocations sharedauth.RevocationStore) *UserHandler {
+	return &UserHandler{
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocations:      revocations,
+	}
+}
+
+func RegisterUserRoutes(rg *gin.RouterGroup,
+	userRepo repository.IUserRepository,
+	roleRepo repository.IRoleRepository,
+	refreshTokenRepo repository.IRefreshTokenRepository,
+	revocations sharedauth.RevocationStore) {
+	handler := NewUserHandler(userRepo, roleRepo, refreshTokenRepo, revocations)
+
+	// Clients granted the profile scope, by OAuth or an API key, may read the profile;
+	// only our apps edit it
+	me := rg.Group("/me", authmw.AuthOrAPIKeyMiddleware())
+	me.GET("", authmw.RequireScope("profile"), handler.GetMe)
+	me.PATCH("", authmw.RequireFirstParty(), handler.UpdateMe)
+
+	admin := rg.Group("", authmw.AuthMiddleware(), authmw.RequireFirstParty(), authmw.RequirePermission(sharedauth.PermissionUserManage))
+	admin.GET("", handler.GetUsers)
+	admin.GET("/:id", middleware.UUIDParamMiddleware("id"), handler.GetUserById)
+	admin.PUT("/:id/roles", middleware.UUIDParamMiddleware("id"), handler.SetUserRoles)
+	admin.POST("/:id/disable", middleware.UUIDParamMiddleware("id"), handler.DisableUser)
+	admin.POST("/:id/enable", middleware.UUIDParamMiddleware("id"), handler.EnableUser)
+	admin.POST("/:id/unlock", middleware.UUIDParamMiddleware("id"), handler.UnlockUser)
+}
+
+// ---------- PROFILE ----------
+// GET /users/me
+// GetMe returns the authenticated user, with the permissions its roles grant
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	grants, err := resolveGrants(c.Request.Context(), h.roleRepo, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve permissions"})
+		return
+	}
+
+	response := newUserResponse(*user)
+	response.Permissions = grants.Permissions
+	c.JSON(http.StatusOK, response)
+}
+
+// PATCH /users/me
+// UpdateMe changes the profile of the authenticated user. The email address is
+// not editable here, since it is verified and used to sign in.
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req struct {
+		Name *string `json:"name" binding:"omitempty,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		user.Name = name
+	}
+
+	if err := h.userRepo.UpdateProfile(c.Request.Context(), user.ID, user.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+// currentUser loads the authenticated user
+func (h *UserHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	id, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// ---------- ADMIN ----------
+// GET /users?search=&roleId=&disabled=&pageIndex=1&pageSize=20
+// GetUsers lists users, optionally searched by name or email and filtered by role
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	var req struct {
+		BaseRequest
+		Search   string `form:"search"`
+		RoleID   string `form:"roleId"`
+		Disabled *bool  `form:"disabled"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Normalize()
+
+	filter := repository.UserFilter{
+		Search:   strings.TrimSpace(req.Search),
+		Disabled: req.Disabled,
+	}
+	if req.RoleID != "" {
+		roleID, err := uuid.Parse(req.RoleID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid roleId"})
+			return
+		}
+		filter.RoleID = &roleID
+	}
+
+	users, total, err := h.userRepo.GetPage(c.Request.Context(), filter, req.Offset(), int(req.PageSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch users"})
+		return
+	}
+
+	response := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, newUserResponse(user))
+	}
+
+	c.JSON(http.StatusOK, PaginationData{
+		BaseResponse: BaseResponse{Data: response, Success: true},
+		Count:        int32(total),
+	})
+}
+
+// GET /users/:id
+func (h *UserHandler) GetUserById(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+// PUT /users/:id/roles
+// SetUserRoles replaces the primary role and the additional roles of a user
+func (h *UserHandler) SetUserRoles(c *gin.Context) {
+	var req struct {
+		RoleID  uuid.UUID   `json:"roleId" binding:"required"`
+		RoleIDs []uuid.UUID `json:"roleIds"` // additional roles
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok || h.refuseSelf(c, user, "change your own roles") {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	roles, err := h.roleRepo.GetAllWithPermissions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch roles"})
+		return
+	}
+
+	findRole := func(id uuid.UUID) (models.Role, bool) {
+		index := slices.IndexFunc(roles, func(role models.Role) bool { return role.ID == id })
+		if index < 0 {
+			return models.Role{}, false
+		}
+		return roles[index], true
+	}
+
+	primary, found := findRole(req.RoleID)
+	if !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role not found"})
+		return
+	}
+
+	additional := make([]models.Role, 0, len(req.RoleIDs))
+	for _, id := range req.RoleIDs {
+		role, found := findRole(id)
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role " + id.String() + " not found"})
+			return
+		}
+		// Only the reference is stored, the permissions loaded with the role are left out
+		if !slices.ContainsFunc(additional, func(other models.Role) bool { return other.ID == id }) {
+			additional = append(additional, models.Role{ID: role.ID, Name: role.Name})
+		}
+	}
+
+	if err := h.userRepo.SetRoles(ctx, user, primary, additional); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update roles"})
+		return
+	}
+
+	// Access tokens carry roles and permissions, so tokens issued before the change are stale
+	if err := h.revocations.SetIssuedBefore(ctx, user.ID.String(), time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	updated, err := h.userRepo.GetByID(ctx, user.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(*updated))
+}
+
+// POST /users/:id/disable
+// DisableUser blocks every login of the user and ends its sessions
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok || h.refuseSelf(c, user, "disable your own account") {
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	if err := h.userRepo.SetDisabled(ctx, user.ID, &now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable user"})
+		return
+	}
+	if err := revokeUserTokens(ctx, h.revocations, h.refreshTokenRepo, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	user.DisabledAt = &now
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+// POST /users/:id/enable
+// EnableUser lets the user sign in again, unless the account was erased
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	if user.ErasedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": repository.ErrAccountErased.Error()})
+		return
+	}
+
+	if err := h.userRepo.SetDisabled(c.Request.Context(), user.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable user"})
+		return
+	}
+
+	user.DisabledAt = nil
+	c.JSON(http.StatusOK, newUserResponse(*user))
+}
+
+// POST /users/:id/unlock
+// UnlockUser lifts a login lockout and forgets the failed logins of the user
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.ResetLoginFailures(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked"})
+}
+
+// targetUser loads the user named by the id path parameter
+func (h *UserHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	id := c.MustGet("id").(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// refuseSelf stops admins from acting on their own account where they could lock
+// themselves out, and reports whether it did
+func (h *UserHandler) refuseSelf(c *gin.Context, user *models.User, action string) bool {
+	userID, _ := authmw.UserID(c)
+	if userID != user.ID.String() {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "you cannot " + action})
+	return true
+}
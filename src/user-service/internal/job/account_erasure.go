@@ -0,0 +1,116 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/shared/auth"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/privacy"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+const (
+	// accountErasureBatchSize is how many accounts one run erases at most
+	accountErasureBatchSize = 100
+	// maxErasureRetryDelay caps the backoff between attempts of a failing account
+	maxErasureRetryDelay = 24 * time.Hour
+)
+
+// AccountErasureJob periodically erases the accounts whose deletion grace period
+// ended: first here, then in every service holding personal data. Accounts whose
+// services failed are retried with an exponential backoff, behind accounts not
+// attempted yet.
+type AccountErasureJob struct {
+	userRepo    repository.IUserRepository
+	revocations auth.RevocationStore
+	hooks       *privacy.Hooks
+	interval    time.Duration
+}
+
+func NewAccountErasureJob(userRepo repository.IUserRepository, revocations auth.RevocationStore, hooks *privacy.Hooks, interval time.Duration) *AccountErasureJob {
+	return &AccountErasureJob{
+		userRepo:    userRepo,
+		revocations: revocations,
+		hooks:       hooks,
+		interval:    interval,
+	}
+}
+
+// Start runs the job immediately and then on every tick until ctx is cancelled
+func (j *AccountErasureJob) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("Account erasure job failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *AccountErasureJob) Run(ctx context.Context) error {
+	users, err := j.userRepo.GetDueForErasure(ctx, time.Now(), accountErasureBatchSize)
+	if err != nil {
+		return err
+	}
+
+	erased := 0
+	for _, user := range users {
+		if err := j.erase(ctx, user); err != nil {
+			log.Printf("Account erasure job failed to erase user %s: %v", user.ID, err)
+			if err := j.userRepo.DeferErasure(ctx, user.ID, time.Now().Add(j.retryDelay(user.ErasureAttempts))); err != nil {
+				log.Printf("Account erasure job failed to defer user %s: %v", user.ID, err)
+			}
+			continue
+		}
+		erased++
+	}
+
+	if erased > 0 {
+		log.Printf("Account erasure job erased %d accounts", erased)
+	}
+	return nil
+}
+
+// retryDelay is the wait after the failed attempt following attempts earlier failures:
+// the interval, doubled for each of them up to maxErasureRetryDelay
+func (j *AccountErasureJob) retryDelay(attempts int) time.Duration {
+	delay := j.interval
+	for i := 0; i < attempts && delay < maxErasureRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxErasureRetryDelay)
+}
+
+func (j *AccountErasureJob) erase(ctx context.Context, user models.User) error {
+	now := time.Now()
+	if user.ErasedAt == nil {
+		err := j.userRepo.Erase(ctx, user.ID, now)
+		if errors.Is(err, repository.ErrDeletionCancelled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Access tokens issued before the erasure still carry the email and name. Set on
+	// every attempt, so a failure after Erase is repaired by the next one.
+	if err := j.revocations.SetIssuedBefore(ctx, user.ID.String(), now); err != nil {
+		return err
+	}
+
+	if err := j.hooks.Erase(ctx, user.ID); err != nil {
+		return err
+	}
+	return j.userRepo.CompleteErasure(ctx, user.ID)
+}
@@ -0,0 +1,94 @@
+package job
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/repository"
+)
+
+// loginAttemptRetention is how long failed logins and password reset requests are
+// kept, the windows of their policies are not longer
+const loginAttemptRetention = 24 * time.Hour
+
+// RefreshTokenCleanupJob periodically deletes expired refresh tokens, the sessions
+// left without any and failed logins and reset requests nobody is held back by any more
+type RefreshTokenCleanupJob struct {
+	repo             repository.IRefreshTokenRepository
+	sessionRepo      repository.ISessionRepository
+	loginAttemptRepo repository.ILoginAttemptRepository
+	resetRequestRepo repository.IPasswordResetRequestRepository
+	interval         time.Duration
+}
+
+func NewRefreshTokenCleanupJob(repo repository.IRefreshTokenRepository,
+	sessionRepo repository.ISessionRepository,
+	loginAttemptRepo repository.ILoginAttemptRepository,
+	resetRequestRepo repository.IPasswordResetRequestRepository,
+	interval time.Duration) *RefreshTokenCleanupJob {
+	return &RefreshTokenCleanupJob{
+		repo:             repo,
+		sessionRepo:      sessionRepo,
+		loginAttemptRepo: loginAttemptRepo,
+		resetRequestRepo: resetRequestRepo,
+		interval:         interval,
+	}
+}
+
+// Start runs the job immediately and then on every tick until ctx is cancelled
+func (j *RefreshTokenCleanupJob) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("Refresh token cleanup job failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *RefreshTokenCleanupJob) Run(ctx context.Context) error {
+	deleted, err := j.repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		log.Printf("Refresh token cleanup job deleted %d expired tokens", deleted)
+	}
+
+	ended, err := j.sessionRepo.DeleteEnded(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ended > 0 {
+		log.Printf("Refresh token cleanup job deleted %d ended sessions", ended)
+	}
+
+	stale, err := j.loginAttemptRepo.DeleteStale(ctx, time.Now().Add(-loginAttemptRetention))
+	if err != nil {
+		return err
+	}
+
+	if stale > 0 {
+		log.Printf("Refresh token cleanup job deleted %d stale login attempts", stale)
+	}
+
+	stale, err = j.resetRequestRepo.DeleteStale(ctx, time.Now().Add(-loginAttemptRetention))
+	if err != nil {
+		return err
+	}
+
+	if stale > 0 {
+		log.Printf("Refresh token cleanup job deleted %d stale password reset requests", stale)
+	}
+	return nil
+}
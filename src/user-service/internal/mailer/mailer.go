@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"context"
+)
+
+// Message is one email with a plain text and an optional HTML body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers emails. SMTPMailer is used in deployments, FileMailer writes
+// emails to a file or the console for local development.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each email has a <name>.txt template defining "subject" and "text" blocks and a
+// <name>.html template for the HTML body
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Every email is parsed on its own, as they all define the same block names
+var (
+	textTemplates = parseAll(".txt", func(file string) *texttemplate.Template {
+		return texttemplate.Must(texttemplate.ParseFS(templateFS, file))
+	})
+	htmlTemplates = parseAll(".html", func(file string) *htmltemplate.Template {
+		return htmltemplate.Must(htmltemplate.ParseFS(templateFS, file))
+	})
+)
+
+func parseAll[T any](ext string, parse func(file string) T) map[string]T {
+	files, err := fs.Glob(templateFS, "templates/*"+ext)
+	if err != nil {
+		panic(err)
+	}
+
+	templates := make(map[string]T, len(files))
+	for _, file := range files {
+		templates[strings.TrimSuffix(path.Base(file), ext)] = parse(file)
+	}
+	return templates
+}
+
+// Template names
+const (
+	TemplatePasswordReset     = "password_reset"
+	TemplateEmailVerification = "email_verification"
+	TemplateAccountLocked     = "account_locked"
+	TemplateAccountDeletion   = "account_deletion"
+)
+
+// Render builds the email named by template for the recipient
+func Render(template string, to string, data any) (Message, error) {
+	text, foundText := textTemplates[template]
+	html, foundHTML := htmlTemplates[template]
+	if !foundText || !foundHTML {
+		return Message{}, fmt.Errorf("unknown email template %s", template)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render subject of %s: %w", template, err)
+	}
+	if err := text.ExecuteTemplate(&textBody, "text", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render text of %s: %w", template, err)
+	}
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render html of %s: %w", template, err)
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()),
+		HTML:    htmlBody.String(),
+	}, nil
+}
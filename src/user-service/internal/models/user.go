@@ -7,16 +7,46 @@ import (
 )
 
 type User struct {
-	ID              uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Email           string    `gorm:"uniqueIndex;not null" json:"email"`
-	Password        string    `gorm:"not null" json:"password"`
-	Name            string    `gorm:"size:100;not null" json:"name"`
+	ID              uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Email           string     `gorm:"uniqueIndex;not null" json:"email"`
+	Password        string     `gorm:"not null" json:"-"`
+	Name            string     `gorm:"size:100;not null" json:"name"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+
+	// Consecutive failed logins, see auth.LockoutPolicy
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"lockedUntil"`
+
+	// Set while an admin has disabled the account, which blocks every login
+	DisabledAt *time.Time `gorm:"index" json:"disabledAt"`
+
+	// Set while the user asked to delete the account. Once it passes, personal data
+	// is erased here and in the other services, and the account is kept as a
+	// disabled shell with ErasedAt set, so references to its id stay valid.
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletionScheduledAt"`
+	ErasedAt            *time.Time `json:"erasedAt"`
+
+	// Failed erasure attempts, retried with a backoff so failing accounts do not
+	// hold back the others
+	ErasureAttempts      int        `gorm:"not null;default:0" json:"-"`
+	NextErasureAttemptAt *time.Time `json:"-"`
+
+	// TOTP second factor. The secret is sealed with auth.SecretBox and only counts
+	// once TOTPEnabledAt is set, after the user confirmed a first code.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totpEnabledAt"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"`
+
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	LatestUpdatedAt time.Time `gorm:"autoUpdateTime" json:"latestUpdatedAt"`
 
 	// Relations
 	RoleID uuid.UUID `gorm:"type:uuid;not null" json:"roleID"`
 	Role   Role      `gorm:"foreignKey:RoleID" json:"role"`
+
+	// Roles held on top of the primary role
+	Roles []Role `gorm:"many2many:user_roles" json:"roles"`
 }
 
 type Role struct {
@@ -24,11 +54,247 @@ type Role struct {
 	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
 	Description string    `gorm:"size:255" json:"description"`
 
+	// A role inherits the permissions of its parent, ADMIN > EMPLOYEE > CUSTOMER
+	ParentID *uuid.UUID `gorm:"type:uuid" json:"parentID"`
+
 	// One-to-many relation
 	Users []User `gorm:"foreignKey:RoleID" json:"users"`
+
+	// Many-to-many relation
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
 }
 
+// Permission allows one kind of action, like product:write. Services authorize by
+// permission, roles only group them.
+type Permission struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+}
+
+// RefreshToken is one single-use refresh token. Only its SHA-256 hash is stored.
+// Every rotation creates the next token in the same family, so a reused token
+// identifies the whole chain to revoke.
 type RefreshToken struct {
-	ID    uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Token string    `gorm:"uniqueIndex;not null" json:"token"`
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	TokenHash    string     `gorm:"column:token;uniqueIndex;not null" json:"-"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"userID"`
+	FamilyID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"familyID"`
+	DeviceID     string     `gorm:"size:100" json:"deviceID"`
+	UserAgent    string     `gorm:"size:255" json:"userAgent"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	ReplacedByID *uuid.UUID `gorm:"type:uuid" json:"replacedByID"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+
+	// Set for tokens issued to an OAuth client, which only refreshes them within Scopes
+	ClientID string   `gorm:"size:100;index" json:"clientID"`
+	Scopes   []string `gorm:"serializer:json" json:"scopes"`
+}
+
+// IsExpired reports whether the token can no longer be used at now
+func (t RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// LoginAttempt is the failed password logins with one email address. It is kept
+// whether or not an account has that address, so backing off reveals nothing about
+// which accounts exist. Keyed by auth.LoginAttemptKey, the table holds no emails.
+type LoginAttempt struct {
+	EmailHash     string     `gorm:"primaryKey" json:"-"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null;index" json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
+
+// PasswordResetRequest is the reset links requested for one email address, kept
+// like LoginAttempt whether or not an account has the address.
+type PasswordResetRequest struct {
+	EmailHash     string     `gorm:"primaryKey" json:"-"`
+	Requests      int        `gorm:"not null;default:0" json:"requests"`
+	LastRequestAt time.Time  `gorm:"not null;index" json:"lastRequestAt"`
+	BlockedUntil  *time.Time `json:"blockedUntil"`
+}
+
+// Session is one login of a user on a device. Its ID is the family of the refresh
+// tokens the login rotates through, so revoking the family ends the session.
+type Session struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"userID"`
+	DeviceID   string    `gorm:"size:100" json:"deviceID"`
+	DeviceName string    `gorm:"size:100" json:"deviceName"`
+	UserAgent  string    `gorm:"size:255" json:"userAgent"`
+	IPAddress  string    `gorm:"size:45" json:"ipAddress"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	LastUsedAt time.Time `gorm:"not null" json:"lastUsedAt"`
+}
+
+// PasswordResetToken is a single-use token mailed to a user who forgot their
+// password. Only its SHA-256 hash is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userID"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// EmailVerificationToken is a single-use token mailed to a user to prove they own
+// their email address. Only its SHA-256 hash is stored.
+type EmailVerificationToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userID"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// RecoveryCode is a one-time code replacing a TOTP code when the authenticator is
+// lost. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userID"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// UserIdentity links an account of an external OpenID Connect provider to a user.
+// The provider subject is the stable identifier, emails can change.
+type UserIdentity struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"userID"`
+	Provider    string     `gorm:"size:50;not null;uniqueIndex:idx_user_identity_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identity_subject" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// OIDCAuthRequest is a social login in progress, between sending the user to the
+// provider and the provider sending them back. It is keyed by the SHA-256 hash of
+// the state parameter and holds the nonce and PKCE verifier checked on return, and
+// the challenge of the verifier the browser that started the login keeps.
+type OIDCAuthRequest struct {
+	StateHash        string    `gorm:"primaryKey" json:"-"`
+	Provider         string    `gorm:"size:50;not null" json:"provider"`
+	Nonce            string    `gorm:"not null" json:"-"`
+	CodeVerifier     string    `gorm:"not null" json:"-"`
+	BrowserChallenge string    `gorm:"not null;default:''" json:"-"`
+	ExpiresAt        time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// OAuthClient is an application registered to obtain tokens from our authorization
+// server. Public clients, like mobile apps, have no secret and must use PKCE.
+type OAuthClient struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ClientID      string    `gorm:"size:100;uniqueIndex;not null" json:"clientId"`
+	SecretHash    string    `json:"-"`
+	Name          string    `gorm:"size:100;not null" json:"name"`
+	RedirectURIs  []string  `gorm:"serializer:json" json:"redirectUris"`
+	AllowedScopes []string  `gorm:"serializer:json" json:"allowedScopes"`
+	GrantTypes    []string  `gorm:"serializer:json" json:"grantTypes"`
+	FirstParty    bool      `gorm:"not null;default:false" json:"firstParty"` // our own apps skip the consent screen
+
+	// A resource server, like one of our APIs, may introspect the access tokens of
+	// every client. Other clients only introspect their own.
+	ResourceServer bool `gorm:"not null;default:false" json:"resourceServer"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// IsPublic reports whether the client cannot keep a secret
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// OAuthAuthorizationCode is a code issued by the authorize endpoint, redeemed once
+// at the token endpoint. Only its SHA-256 hash is stored.
+type OAuthAuthorizationCode struct {
+	CodeHash        string    `gorm:"primaryKey" json:"-"`
+	ClientID        string    `gorm:"size:100;not null" json:"clientId"`
+	UserID          uuid.UUID `gorm:"type:uuid;not null" json:"userID"`
+	RedirectURI     string    `gorm:"not null" json:"redirectUri"`
+	RedirectURISent bool      `gorm:"not null;default:false" json:"redirectUriSent"` // then required again at the token endpoint
+	Scopes          []string  `gorm:"serializer:json" json:"scopes"`
+	CodeChallenge   string    `gorm:"not null" json:"-"`
+	ExpiresAt       time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// OAuthConsent records the scopes a user allowed a client, so the consent screen
+// is only shown again when the client asks for more
+type OAuthConsent struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_oauth_consent_user_client" json:"userID"`
+	ClientID  string    `gorm:"size:100;not null;uniqueIndex:idx_oauth_consent_user_client" json:"clientId"`
+	Scopes    []string  `gorm:"serializer:json" json:"scopes"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// ServiceAccount is a non-human identity for integrations. It holds a role like a
+// user does, but can only authenticate with API keys.
+type ServiceAccount struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	RoleID      uuid.UUID `gorm:"type:uuid;not null;index" json:"roleID"`
+	Role        Role      `gorm:"foreignKey:RoleID" json:"role"`
+	CreatedByID uuid.UUID `gorm:"type:uuid;not null" json:"createdByID"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// APIKey authenticates a machine client as its owner, a user or a service account,
+// within Scopes. The key is shown once; only its SHA-256 hash is stored, next to a
+// prefix that identifies it in listings.
+type APIKey struct {
+	ID               uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name             string     `gorm:"size:100;not null" json:"name"`
+	Prefix           string     `gorm:"size:20;uniqueIndex;not null" json:"prefix"`
+	KeyHash          string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID           *uuid.UUID `gorm:"type:uuid;index" json:"userID"`
+	ServiceAccountID *uuid.UUID `gorm:"type:uuid;index" json:"serviceAccountID"`
+	Scopes           []string   `gorm:"serializer:json" json:"scopes"`
+	ExpiresAt        *time.Time `json:"expiresAt"`
+	LastUsedAt       *time.Time `json:"lastUsedAt"`
+	RevokedAt        *time.Time `json:"revokedAt"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// IsActive reports whether the key can be used at now
+func (k APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Address is a shipping or billing address in the address book of a user. Addresses
+// in Vietnam are located by province, district and ward; elsewhere by city, state
+// and postal code.
+type Address struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"userID"`
+	Label         string    `gorm:"size:50" json:"label"` // like Home or Office
+	RecipientName string    `gorm:"size:100;not null" json:"recipientName"`
+	Phone         string    `gorm:"size:20;not null" json:"phone"`      // E.164, like +84912345678
+	CountryCode   string    `gorm:"size:2;not null" json:"countryCode"` // ISO 3166-1 alpha-2
+	AddressLine1  string    `gorm:"size:255;not null" json:"addressLine1"`
+	AddressLine2  string    `gorm:"size:255" json:"addressLine2"`
+
+	// Vietnamese administrative divisions
+	Province string `gorm:"size:100" json:"province"`
+	District string `gorm:"size:100" json:"district"`
+	Ward     string `gorm:"size:100" json:"ward"`
+
+	// International fields
+	City       string `gorm:"size:100" json:"city"`
+	State      string `gorm:"size:100" json:"state"`
+	PostalCode string `gorm:"size:20" json:"postalCode"`
+
+	IsDefaultShipping bool      `gorm:"not null;default:false" json:"isDefaultShipping"`
+	IsDefaultBilling  bool      `gorm:"not null;default:false" json:"isDefaultBilling"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
@@ -0,0 +1,121 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	sharedauth "github.com/quochao170402/ecommerce-aws/shared/auth"
+)
+
+// maxExportBytes bounds the export document a single service may return
+const maxExportBytes = 64 << 20
+
+// Hook is another service holding personal data of users. For a user id it answers
+// GET <URL>/<id> with a JSON document of the data it holds, and DELETE <URL>/<id>
+// by erasing or anonymizing that data. Both must be idempotent.
+type Hook struct {
+	Name string // names the document of the service in exports
+	URL  string
+}
+
+// ParseHooks reads hooks given as comma separated name=url pairs
+func ParseHooks(value string) ([]Hook, error) {
+	var hooks []Hook
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, url, found := strings.Cut(entry, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !found || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid hook %q, expected name=url", entry)
+		}
+		for _, hook := range hooks {
+			if hook.Name == name {
+				return nil, fmt.Errorf("duplicate hook %s", name)
+			}
+		}
+		hooks = append(hooks, Hook{Name: name, URL: strings.TrimSuffix(url, "/")})
+	}
+	return hooks, nil
+}
+
+// Hooks calls every service holding personal data, authenticated by an API key of a
+// service account with the privacy scope, which carries personal_data:manage only
+type Hooks struct {
+	hooks  []Hook
+	apiKey string
+	client *http.Client
+}
+
+func NewHooks(hooks []Hook, apiKey string) *Hooks {
+	return &Hooks{
+		hooks:  hooks,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Export returns the document of every service by hook name. It fails when any
+// service fails, an export missing some data would mislead the user.
+func (h *Hooks) Export(ctx context.Context, userID uuid.UUID) (map[string]json.RawMessage, error) {
+	documents := make(map[string]json.RawMessage, len(h.hooks))
+	for _, hook := range h.hooks {
+		resp, err := h.call(ctx, http.MethodGet, hook, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxExportBytes+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read export: %w", hook.Name, err)
+		}
+		if len(body) > maxExportBytes || !json.Valid(body) {
+			return nil, fmt.Errorf("%s: invalid export document", hook.Name)
+		}
+		documents[hook.Name] = body
+	}
+	return documents, nil
+}
+
+// Erase asks every service to erase the data of the user. Services erased before
+// a failure are asked again on the next attempt, which their idempotence allows.
+func (h *Hooks) Erase(ctx context.Context, userID uuid.UUID) error {
+	for _, hook := range h.hooks {
+		resp, err := h.call(ctx, http.MethodDelete, hook, userID)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// call sends one request to hook, failing unless it succeeded
+func (h *Hooks) call(ctx context.Context, method string, hook Hook, userID uuid.UUID) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, hook.URL+"/"+userID.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hook.Name, err)
+	}
+	req.Header.Set(sharedauth.APIKeyHeader, h.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hook.Name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", hook.Name, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxAddresses bounds the address book of one user
+const MaxAddresses = 20
+
+var (
+	// ErrAddressNotFound is returned when the address does not exist or belongs to another user
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrAddressBookFull is returned when the user already has MaxAddresses addresses
+	ErrAddressBookFull = errors.New("address book is full")
+)
+
+type IAddressRepository interface {
+	GetByUser(ctx context.Context, userID uuid.UUID) ([]models.Address, error)
+	GetForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Address, error)
+	Create(ctx context.Context, address *models.Address) error
+	Update(ctx context.Context, address *models.Address) error
+	DeleteForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+}
+
+// AddressRepository implements IAddressRepository. Every user has at most one
+// default shipping and one default billing address; setting a default clears the
+// previous one in the same transaction.
+type AddressRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewAddressRepository(db *gorm.DB) IAddressRepository {
+	return &AddressRepository{db: db}
+}
+
+// GetByUser returns the addresses of the user, defaults first and then the newest
+func (r *AddressRepository) GetByUser(ctx context.Context, userID uuid.UUID) ([]models.Address, error) {
+	var addresses []models.Address
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("is_default_shipping DESC, is_default_billing DESC, created_at DESC").
+		Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetForUser returns the address only when it belongs to the user
+func (r *AddressRepository) GetForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Address, error) {
+	var address models.Address
+	if err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &address, nil
+}
+
+// Create stores the address, unless the address book of the user is full. The
+// first address of a user becomes its default shipping and billing address.
+func (r *AddressRepository) Create(ctx context.Context, address *models.Address) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, address.UserID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Address{}).Where("user_id = ?", address.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxAddresses {
+			return ErrAddressBookFull
+		}
+		if count == 0 {
+			address.IsDefaultShipping = true
+			address.IsDefaultBilling = true
+		}
+
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+		return tx.Create(address).Error
+	})
+}
+
+// Update saves the address. A default it gives up is handed on to the newest other
+// address, like on deletion; the only address of a user keeps its defaults.
+func (r *AddressRepository) Update(ctx context.Context, address *models.Address) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, address.UserID); err != nil {
+			return err
+		}
+
+		var current models.Address
+		if err := tx.Where("id = ? AND user_id = ?", address.ID, address.UserID).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAddressNotFound
+			}
+			return err
+		}
+
+		defaults := []struct {
+			column     string
+			wasDefault bool
+			isDefault  *bool
+		}{
+			{"is_default_shipping", current.IsDefaultShipping, &address.IsDefaultShipping},
+			{"is_default_billing", current.IsDefaultBilling, &address.IsDefaultBilling},
+		}
+		for _, d := range defaults {
+			if !d.wasDefault || *d.isDefault {
+				continue
+			}
+
+			handedOn, err := handOnDefault(tx, address.UserID, address.ID, d.column)
+			if err != nil {
+				return err
+			}
+			*d.isDefault = !handedOn
+		}
+
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+		return tx.Save(address).Error
+	})
+}
+
+// DeleteForUser deletes the address of the user. A deleted default is handed on to
+// the newest remaining address.
+func (r *AddressRepository) DeleteForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var deleted []models.Address
+		if err := tx.Clauses(clause.Returning{}).
+			Where("id = ? AND user_id = ?", id, userID).
+			Delete(&deleted).Error; err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return ErrAddressNotFound
+		}
+
+		for column, wasDefault := range map[string]bool{
+			"is_default_shipping": deleted[0].IsDefaultShipping,
+			"is_default_billing":  deleted[0].IsDefaultBilling,
+		} {
+			if !wasDefault {
+				continue
+			}
+			if _, err := handOnDefault(tx, userID, id, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// handOnDefault gives the default of column to the newest address of the user
+// other than from. It reports false when the user has no other address.
+func handOnDefault(tx *gorm.DB, userID uuid.UUID, from uuid.UUID, column string) (bool, error) {
+	var next models.Address
+	err := tx.Where("user_id = ? AND id <> ?", userID, from).Order("created_at DESC").First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Model(&next).Update(column, true).Error
+}
+
+// lockUser serializes address book changes of one user, so two requests cannot
+// both set a default
+func lockUser(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Exec("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Error
+}
+
+// clearDefaults unsets the defaults address is about to take over
+func clearDefaults(tx *gorm.DB, address *models.Address) error {
+	if address.IsDefaultShipping {
+		if err := tx.Model(&models.Address{}).
+			Where("user_id = ? AND id <> ? AND is_default_shipping", address.UserID, address.ID).
+			Update("is_default_shipping", false).Error; err != nil {
+			return err
+		}
+	}
+	if address.IsDefaultBilling {
+		if err := tx.Model(&models.Address{}).
+			Where("user_id = ? AND id <> ? AND is_default_billing", address.UserID, address.ID).
+			Update("is_default_billing", false).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
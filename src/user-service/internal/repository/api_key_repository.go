@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IAPIKeyRepository interface {
+	IBaseRepository[models.APIKey]
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	GetByUser(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error)
+	GetByServiceAccount(ctx context.Context, serviceAccountID uuid.UUID) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	RevokeForServiceAccount(ctx context.Context, serviceAccountID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, interval time.Duration) error
+}
+
+// APIKeyRepository implements IAPIKeyRepository
+type APIKeyRepository struct {
+	IBaseRepository[models.APIKey]
+	db *gorm.DB
+}
+
+// constructor
+func NewAPIKeyRepository(db *gorm.DB) IAPIKeyRepository {
+	return &APIKeyRepository{
+		IBaseRepository: NewBaseRepository[models.APIKey](db),
+		db:              db,
+	}
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).
+		Where("key_hash = ?", keyHash).
+		First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetByUser returns the keys of the user, the newest first
+func (r *APIKeyRepository) GetByUser(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetByServiceAccount returns the keys of the service account, the newest first
+func (r *APIKeyRepository) GetByServiceAccount(ctx context.Context, serviceAccountID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.WithContext(ctx).
+		Where("service_account_id = ?", serviceAccountID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *APIKeyRepository) RevokeForServiceAccount(ctx context.Context, serviceAccountID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("service_account_id = ? AND revoked_at IS NULL", serviceAccountID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchLastUsed records that the key was used just now. The time is written at most
+// once per interval, so busy keys do not write on every request.
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, interval time.Duration) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).
+		Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		Update("last_used_at", now).Error
+}
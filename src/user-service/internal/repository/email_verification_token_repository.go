@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrVerificationTokenInvalid is returned for verification tokens that are used, expired or superseded
+var ErrVerificationTokenInvalid = errors.New("invalid or expired verification token")
+
+type IEmailVerificationTokenRepository interface {
+	IBaseRepository[models.EmailVerificationToken]
+	GetByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	Consume(ctx context.Context, id uuid.UUID) error
+	InvalidateForUser(ctx context.Context, userID uuid.UUID) error
+	CountCreatedSince(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error)
+}
+
+// EmailVerificationTokenRepository implements IEmailVerificationTokenRepository
+type EmailVerificationTokenRepository struct {
+	IBaseRepository[models.EmailVerificationToken]
+	db *gorm.DB
+}
+
+// constructor
+func NewEmailVerificationTokenRepository(db *gorm.DB) IEmailVerificationTokenRepository {
+	return &EmailVerificationTokenRepository{
+		IBaseRepository: NewBaseRepository[models.EmailVerificationToken](db),
+		db:              db,
+	}
+}
+
+func (r *EmailVerificationTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	if err := r.db.WithContext(ctx).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume marks the token used. It only succeeds once and only before the token expires.
+func (r *EmailVerificationTokenRepository) Consume(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVerificationTokenInvalid
+	}
+	return nil
+}
+
+// InvalidateForUser retires the outstanding tokens of a user, so only the latest mailed link works
+func (r *EmailVerificationTokenRepository) InvalidateForUser(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+// CountCreatedSince counts the tokens issued to a user since the given time, used to rate limit resends
+func (r *EmailVerificationTokenRepository) CountCreatedSince(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
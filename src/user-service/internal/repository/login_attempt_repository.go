@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type ILoginAttemptRepository interface {
+	LockedUntil(ctx context.Context, emailHash string) (*time.Time, error)
+	RecordFailure(ctx context.Context, emailHash string, window time.Duration) (int, error)
+	LockUntil(ctx context.Context, emailHash string, until time.Time) error
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+// LoginAttemptRepository implements ILoginAttemptRepository
+type LoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewLoginAttemptRepository(db *gorm.DB) ILoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// LockedUntil returns until when logins with emailHash are refused, nil when they are not
+func (r *LoginAttemptRepository) LockedUntil(ctx context.Context, emailHash string) (*time.Time, error) {
+	var attempt models.LoginAttempt
+	if err := r.db.WithContext(ctx).Where("email_hash = ?", emailHash).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return attempt.LockedUntil, nil
+}
+
+// RecordFailure counts a failed login with emailHash and returns the consecutive failures.
+// A failure after window without any starts counting from one again.
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, emailHash string, window time.Duration) (int, error) {
+	now := time.Now()
+
+	var failures int
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (email_hash, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (email_hash) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < ? THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`, emailHash, now, now.Add(-window)).
+		Scan(&failures).Error
+	return failures, err
+}
+
+// LockUntil refuses logins with emailHash until the given time
+func (r *LoginAttemptRepository) LockUntil(ctx context.Context, emailHash string, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.LoginAttempt{}).
+		Where("email_hash = ?", emailHash).
+		UpdateColumn("locked_until", until).Error
+}
+
+// DeleteStale removes the attempts whose last failure is before the given time and
+// which no longer lock, and returns how many
+func (r *LoginAttemptRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&models.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAuthorizationCodeInvalid is returned for unknown, already redeemed or expired codes
+var ErrAuthorizationCodeInvalid = errors.New("invalid or expired authorization code")
+
+type IOAuthAuthorizationCodeRepository interface {
+	Create(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	Consume(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// OAuthAuthorizationCodeRepository implements IOAuthAuthorizationCodeRepository
+type OAuthAuthorizationCodeRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewOAuthAuthorizationCodeRepository(db *gorm.DB) IOAuthAuthorizationCodeRepository {
+	return &OAuthAuthorizationCodeRepository{db: db}
+}
+
+func (r *OAuthAuthorizationCodeRepository) Create(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	return r.db.WithContext(ctx).Create(code).Error
+}
+
+// Consume deletes the code and returns it, so a code can only be redeemed once
+func (r *OAuthAuthorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	var codes []models.OAuthAuthorizationCode
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("code_hash = ?", codeHash).
+		Delete(&codes).Error; err != nil {
+		return nil, err
+	}
+
+	if len(codes) == 0 || !time.Now().Before(codes[0].ExpiresAt) {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+	return &codes[0], nil
+}
+
+// DeleteExpired removes codes that were never redeemed
+func (r *OAuthAuthorizationCodeRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.OAuthAuthorizationCode{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IOAuthClientRepository interface {
+	IBaseRepository[models.OAuthClient]
+	GetByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error)
+}
+
+// OAuthClientRepository implements IOAuthClientRepository
+type OAuthClientRepository struct {
+	IBaseRepository[models.OAuthClient]
+	db *gorm.DB
+}
+
+// constructor
+func NewOAuthClientRepository(db *gorm.DB) IOAuthClientRepository {
+	return &OAuthClientRepository{
+		IBaseRepository: NewBaseRepository[models.OAuthClient](db),
+		db:              db,
+	}
+}
+
+func (r *OAuthClientRepository) GetByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := r.db.WithContext(ctx).
+		Where("client_id = ?", clientID).
+		First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Delete removes the client together with what its users granted it: their consents
+// and its pending authorization codes are deleted and its refresh tokens revoked.
+// Access tokens already issued to it lapse when they expire.
+func (r *OAuthClientRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var client models.OAuthClient
+		if err := tx.Where("id = ?", id).First(&client).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("entity not found")
+			}
+			return err
+		}
+
+		if err := tx.Delete(&client).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("client_id = ? AND revoked_at IS NULL", client.ClientID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&models.OAuthConsent{}, &models.OAuthAuthorizationCode{}} {
+			if err := tx.Where("client_id = ?", client.ClientID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
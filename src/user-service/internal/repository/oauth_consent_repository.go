@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IOAuthConsentRepository interface {
+	Get(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error)
+	GetByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthConsent, error)
+	Grant(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error
+	Revoke(ctx context.Context, userID uuid.UUID, clientID string) error
+}
+
+// OAuthConsentRepository implements IOAuthConsentRepository
+type OAuthConsentRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewOAuthConsentRepository(db *gorm.DB) IOAuthConsentRepository {
+	return &OAuthConsentRepository{db: db}
+}
+
+func (r *OAuthConsentRepository) Get(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND client_id = ?", userID, clientID).
+		First(&consent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *OAuthConsentRepository) GetByUser(ctx context.Context, userID uuid.UUID) ([]models.OAuthConsent, error) {
+	var consents []models.OAuthConsent
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&consents).Error; err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// Grant records the scopes the user allowed the client, replacing earlier consent
+func (r *OAuthConsentRepository) Grant(ctx context.Context, userID uuid.UUID, clientID string, scopes []string) error {
+	consent := models.OAuthConsent{
+		ID:       uuid.New(),
+		UserID:   userID,
+		ClientID: clientID,
+		Scopes:   scopes,
+	}
+
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+		}).
+		Create(&consent).Error
+}
+
+func (r *OAuthConsentRepository) Revoke(ctx context.Context, userID uuid.UUID, clientID string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND client_id = ?", userID, clientID).
+		Delete(&models.OAuthConsent{}).Error
+}
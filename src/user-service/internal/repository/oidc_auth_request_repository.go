@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAuthRequestInvalid is returned for unknown, already used or expired login states
+var ErrAuthRequestInvalid = errors.New("invalid or expired login state")
+
+type IOIDCAuthRequestRepository interface {
+	Create(ctx context.Context, request *models.OIDCAuthRequest) error
+	Consume(ctx context.Context, stateHash string) (*models.OIDCAuthRequest, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// OIDCAuthRequestRepository implements IOIDCAuthRequestRepository
+type OIDCAuthRequestRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewOIDCAuthRequestRepository(db *gorm.DB) IOIDCAuthRequestRepository {
+	return &OIDCAuthRequestRepository{db: db}
+}
+
+func (r *OIDCAuthRequestRepository) Create(ctx context.Context, request *models.OIDCAuthRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+// Consume deletes the request and returns it, so a state can only complete one login
+func (r *OIDCAuthRequestRepository) Consume(ctx context.Context, stateHash string) (*models.OIDCAuthRequest, error) {
+	var requests []models.OIDCAuthRequest
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("state_hash = ?", stateHash).
+		Delete(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	if len(requests) == 0 || !time.Now().Before(requests[0].ExpiresAt) {
+		return nil, ErrAuthRequestInvalid
+	}
+	return &requests[0], nil
+}
+
+// DeleteExpired removes logins that were never completed
+func (r *OIDCAuthRequestRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.OIDCAuthRequest{})
+	return result.RowsAffected, result.Error
+}
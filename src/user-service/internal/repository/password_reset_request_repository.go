@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IPasswordResetRequestRepository interface {
+	BlockedUntil(ctx context.Context, emailHash string) (*time.Time, error)
+	RecordRequest(ctx context.Context, emailHash string, window time.Duration) (int, error)
+	BlockUntil(ctx context.Context, emailHash string, until time.Time) error
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PasswordResetRequestRepository implements IPasswordResetRequestRepository
+type PasswordResetRequestRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewPasswordResetRequestRepository(db *gorm.DB) IPasswordResetRequestRepository {
+	return &PasswordResetRequestRepository{db: db}
+}
+
+// BlockedUntil returns until when reset links for emailHash are refused, nil when they are not
+func (r *PasswordResetRequestRepository) BlockedUntil(ctx context.Context, emailHash string) (*time.Time, error) {
+	var request models.PasswordResetRequest
+	if err := r.db.WithContext(ctx).Where("email_hash = ?", emailHash).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return request.BlockedUntil, nil
+}
+
+// RecordRequest counts a reset link requested for emailHash and returns the requests
+// in a row. A request after window without any starts counting from one again.
+func (r *PasswordResetRequestRepository) RecordRequest(ctx context.Context, emailHash string, window time.Duration) (int, error) {
+	now := time.Now()
+
+	var requests int
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO password_reset_requests (email_hash, requests, last_request_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (email_hash) DO UPDATE SET
+			requests = CASE
+				WHEN password_reset_requests.last_request_at < ? THEN 1
+				ELSE password_reset_requests.requests + 1
+			END,
+			last_request_at = EXCLUDED.last_request_at
+		RETURNING requests`, emailHash, now, now.Add(-window)).
+		Scan(&requests).Error
+	return requests, err
+}
+
+// BlockUntil refuses reset links for emailHash until the given time
+func (r *PasswordResetRequestRepository) BlockUntil(ctx context.Context, emailHash string, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.PasswordResetRequest{}).
+		Where("email_hash = ?", emailHash).
+		UpdateColumn("blocked_until", until).Error
+}
+
+// DeleteStale removes the requests whose last one is before the given time and
+// which no longer block, and returns how many
+func (r *PasswordResetRequestRepository) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("last_request_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", before, time.Now()).
+		Delete(&models.PasswordResetRequest{})
+	return result.RowsAffected, result.Error
+}
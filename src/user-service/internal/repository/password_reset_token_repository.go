@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrResetTokenInvalid is returned for reset tokens that are used, expired or superseded
+var ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+
+type IPasswordResetTokenRepository interface {
+	IBaseRepository[models.PasswordResetToken]
+	GetByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	Consume(ctx context.Context, id uuid.UUID) error
+	InvalidateForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// PasswordResetTokenRepository implements IPasswordResetTokenRepository
+type PasswordResetTokenRepository struct {
+	IBaseRepository[models.PasswordResetToken]
+	db *gorm.DB
+}
+
+// constructor
+func NewPasswordResetTokenRepository(db *gorm.DB) IPasswordResetTokenRepository {
+	return &PasswordResetTokenRepository{
+		IBaseRepository: NewBaseRepository[models.PasswordResetToken](db),
+		db:              db,
+	}
+}
+
+func (r *PasswordResetTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.db.WithContext(ctx).
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume marks the token used. It only succeeds once and only before the token
+// expires, so a token cannot be redeemed twice even by concurrent requests.
+func (r *PasswordResetTokenRepository) Consume(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrResetTokenInvalid
+	}
+	return nil
+}
+
+// InvalidateForUser retires the outstanding tokens of a user, so only the latest mailed link works
+func (r *PasswordResetTokenRepository) InvalidateForUser(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IPermissionRepository interface {
+	IBaseRepository[models.Permission]
+	GetByNames(ctx context.Context, names []string) ([]models.Permission, error)
+}
+
+// PermissionRepository implements IPermissionRepository
+type PermissionRepository struct {
+	IBaseRepository[models.Permission]
+	db *gorm.DB
+}
+
+// constructor
+func NewPermissionRepository(db *gorm.DB) IPermissionRepository {
+	return &PermissionRepository{
+		IBaseRepository: NewBaseRepository[models.Permission](db),
+		db:              db,
+	}
+}
+
+func (r *PermissionRepository) GetByNames(ctx context.Context, names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if err := r.db.WithContext(ctx).
+		Where("name IN ?", names).
+		Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
@@ -2,14 +2,25 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrRefreshTokenReused is returned when a refresh token was already rotated or revoked
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
 type IRefreshTokenRepository interface {
 	IBaseRepository[models.RefreshToken]
-	GetByToken(ctx context.Context, token string) (*models.RefreshToken, error)
+	GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	Rotate(ctx context.Context, current *models.RefreshToken, next *models.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeForClient(ctx context.Context, userID uuid.UUID, clientID string) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
 }
 
 // RefreshTokenRepository implements IRefreshTokenRepository
@@ -26,12 +37,68 @@ func NewRefreshTokenRepository(db *gorm.DB) IRefreshTokenRepository {
 	}
 }
 
-func (r *RefreshTokenRepository) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
 	var refreshToken models.RefreshToken
 	if err := r.db.WithContext(ctx).
-		Where("token = ?", token).
+		Where("token = ?", tokenHash).
 		First(&refreshToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &refreshToken, nil
 }
+
+// Rotate revokes current and stores next in one transaction. The revoke only
+// succeeds while current is unrevoked, so of two concurrent rotations one fails
+// with ErrRefreshTokenReused.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, current *models.RefreshToken, next *models.RefreshToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]any{
+				"revoked_at":     time.Now(),
+				"replaced_by_id": next.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		return tx.Create(next).Error
+	})
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeForClient revokes the refresh tokens the user delegated to an OAuth client
+func (r *RefreshTokenRepository) RevokeForClient(ctx context.Context, userID uuid.UUID, clientID string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// DeleteExpired removes tokens that expired before the given time. Revoked tokens are
+// kept until they expire, since reuse detection needs them.
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at < ?", before).
+		Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
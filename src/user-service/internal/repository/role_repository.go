@@ -2,14 +2,24 @@ package repository
 
 import (
 	"context"
+	"errors"
+
+	"github.com/google/uuid"
 
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrRoleInUse is returned when deleting a role users still hold without reassigning them
+var ErrRoleInUse = errors.New("role is still assigned to users")
+
 type IRoleRepository interface {
 	IBaseRepository[models.Role]
 	GetByName(ctx context.Context, name string) (*models.Role, error)
+	GetWithPermissions(ctx context.Context, id uuid.UUID) (*models.Role, error)
+	GetAllWithPermissions(ctx context.Context) ([]models.Role, error)
+	SetPermissions(ctx context.Context, role *models.Role, permissions []models.Permission) error
+	DeleteReassigning(ctx context.Context, role *models.Role, reassignTo *uuid.UUID) error
 }
 
 // RoleRepository implements IRoleRepository
@@ -35,3 +45,91 @@ func (r *RoleRepository) GetByName(ctx context.Context, name string) (*models.Ro
 	}
 	return &role, nil
 }
+
+func (r *RoleRepository) GetWithPermissions(ctx context.Context, id uuid.UUID) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).
+		Preload("Permissions").
+		First(&role, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetAllWithPermissions returns every role with its permissions, the whole hierarchy
+// grants are resolved from
+func (r *RoleRepository) GetAllWithPermissions(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SetPermissions replaces the permissions of role
+func (r *RoleRepository) SetPermissions(ctx context.Context, role *models.Role, permissions []models.Permission) error {
+	return r.db.WithContext(ctx).Model(role).Association("Permissions").Replace(permissions)
+}
+
+// DeleteReassigning deletes role in one transaction. Its users and service accounts
+// move to the role reassignTo; without one the delete fails with ErrRoleInUse while
+// any holds it.
+// Roles inheriting from it inherit from its parent instead.
+func (r *RoleRepository) DeleteReassigning(ctx context.Context, role *models.Role, reassignTo *uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if reassignTo == nil {
+			var members int64
+			if err := tx.Model(&models.User{}).
+				Where("role_id = ?", role.ID).
+				Or("id IN (SELECT user_id FROM user_roles WHERE role_id = ?)", role.ID).
+				Count(&members).Error; err != nil {
+				return err
+			}
+			if members == 0 {
+				if err := tx.Model(&models.ServiceAccount{}).
+					Where("role_id = ?", role.ID).
+					Count(&members).Error; err != nil {
+					return err
+				}
+			}
+			if members > 0 {
+				return ErrRoleInUse
+			}
+		} else {
+			if err := tx.Model(&models.User{}).
+				Where("role_id = ?", role.ID).
+				Update("role_id", *reassignTo).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.ServiceAccount{}).
+				Where("role_id = ?", role.ID).
+				Update("role_id", *reassignTo).Error; err != nil {
+				return err
+			}
+
+			// Users already holding the target keep a single assignment of it
+			if err := tx.Exec(`DELETE FROM user_roles WHERE role_id = ? AND (
+				user_id IN (SELECT id FROM users WHERE role_id = ?) OR
+				user_id IN (SELECT user_id FROM user_roles WHERE role_id = ?))`,
+				role.ID, *reassignTo, *reassignTo).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE user_roles SET role_id = ? WHERE role_id = ?", *reassignTo, role.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.Role{}).
+			Where("parent_id = ?", role.ID).
+			Update("parent_id", role.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&models.Role{}, "id = ?", role.ID).Error
+	})
+}
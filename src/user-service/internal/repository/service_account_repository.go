@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IServiceAccountRepository interface {
+	IBaseRepository[models.ServiceAccount]
+	GetAllWithRole(ctx context.Context) ([]models.ServiceAccount, error)
+	GetWithRole(ctx context.Context, id uuid.UUID) (*models.ServiceAccount, error)
+	GetByName(ctx context.Context, name string) (*models.ServiceAccount, error)
+}
+
+// ServiceAccountRepository implements IServiceAccountRepository
+type ServiceAccountRepository struct {
+	IBaseRepository[models.ServiceAccount]
+	db *gorm.DB
+}
+
+// constructor
+func NewServiceAccountRepository(db *gorm.DB) IServiceAccountRepository {
+	return &ServiceAccountRepository{
+		IBaseRepository: NewBaseRepository[models.ServiceAccount](db),
+		db:              db,
+	}
+}
+
+func (r *ServiceAccountRepository) GetAllWithRole(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	if err := r.db.WithContext(ctx).
+		Preload("Role").
+		Order("name").
+		Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (r *ServiceAccountRepository) GetWithRole(ctx context.Context, id uuid.UUID) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := r.db.WithContext(ctx).
+		Preload("Role").
+		First(&account, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ServiceAccountRepository) GetByName(ctx context.Context, name string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := r.db.WithContext(ctx).
+		Where("name = ?", name).
+		First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// activeSession matches sessions whose refresh token family still holds a usable token
+const activeSession = `EXISTS (SELECT 1 FROM refresh_tokens
+	WHERE refresh_tokens.family_id = sessions.id
+	AND refresh_tokens.revoked_at IS NULL
+	AND refresh_tokens.expires_at > ?)`
+
+type ISessionRepository interface {
+	Start(ctx context.Context, session *models.Session, refreshToken *models.RefreshToken) error
+	GetActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	GetActiveForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Session, error)
+	Touch(ctx context.Context, id uuid.UUID, ipAddress string) error
+	DeleteEnded(ctx context.Context) (int64, error)
+}
+
+// SessionRepository implements ISessionRepository. A session is active while its
+// refresh token family is, so revoking tokens needs no update here.
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// constructor
+func NewSessionRepository(db *gorm.DB) ISessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Start stores a new session and the first refresh token of its family in one transaction
+func (r *SessionRepository) Start(ctx context.Context, session *models.Session, refreshToken *models.RefreshToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		return tx.Create(refreshToken).Error
+	})
+}
+
+// GetActiveByUser returns the active sessions of the user, the most recently used first
+func (r *SessionRepository) GetActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Where(activeSession, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetActiveForUser returns the session only when it is active and belongs to the user
+func (r *SessionRepository) GetActiveForUser(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		Where(activeSession, time.Now()).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch records that the session was used just now from ipAddress
+func (r *SessionRepository) Touch(ctx context.Context, id uuid.UUID, ipAddress string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"last_used_at": time.Now(),
+			"ip_address":   ipAddress,
+		}).Error
+}
+
+// DeleteEnded removes sessions whose refresh tokens were all deleted, which happens
+// once the last of them expired
+func (r *SessionRepository) DeleteEnded(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = sessions.id)").
+		Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
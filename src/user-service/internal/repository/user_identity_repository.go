@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type IUserIdentityRepository interface {
+	IBaseRepository[models.UserIdentity]
+	GetByProviderSubject(ctx context.Context, provider string, subject string) (*models.UserIdentity, error)
+	GetByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error)
+	TouchLogin(ctx context.Context, id uuid.UUID) error
+}
+
+// UserIdentityRepository implements IUserIdentityRepository
+type UserIdentityRepository struct {
+	IBaseRepository[models.UserIdentity]
+	db *gorm.DB
+}
+
+// constructor
+func NewUserIdentityRepository(db *gorm.DB) IUserIdentityRepository {
+	return &UserIdentityRepository{
+		IBaseRepository: NewBaseRepository[models.UserIdentity](db),
+		db:              db,
+	}
+}
+
+func (r *UserIdentityRepository) GetByProviderSubject(ctx context.Context, provider string, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := r.db.WithContext(ctx).
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *UserIdentityRepository) GetByUser(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// TouchLogin records a login through the identity
+func (r *UserIdentityRepository) TouchLogin(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UserIdentity{}).
+		Where("id = ?", id).
+		UpdateColumn("last_login_at", time.Now()).Error
+}
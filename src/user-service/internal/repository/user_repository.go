@@ -2,8 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/quochao170402/ecommerce-aws/user-service/auth"
 	"github.com/quochao170402/ecommerce-aws/user-service/internal/models"
 	"gorm.io/gorm"
 )
@@ -11,10 +16,36 @@ import (
 type IUserRepository interface {
 	IBaseRepository[models.User]
 	GetByRole(ctx context.Context, roleID uuid.UUID) ([]models.User, error)
+	GetPage(ctx context.Context, filter UserFilter, offset int, limit int) ([]models.User, int64, error)
+	SetRoles(ctx context.Context, user *models.User, primary models.Role, additional []models.Role) error
+	SetDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error
+	UpdateProfile(ctx context.Context, id uuid.UUID, name string) error
+	ReplacePasswordHash(ctx context.Context, id uuid.UUID, current string, next string) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByName(ctx context.Context, name string) ([]models.User, error)
+	RecordLoginFailure(ctx context.Context, id uuid.UUID, window time.Duration) (int, error)
+	LockUntil(ctx context.Context, id uuid.UUID, until time.Time) error
+	ResetLoginFailures(ctx context.Context, id uuid.UUID) error
+	UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error
+	ScheduleDeletion(ctx context.Context, id uuid.UUID, at *time.Time) error
+	GetDueForErasure(ctx context.Context, now time.Time, limit int) ([]models.User, error)
+	Erase(ctx context.Context, id uuid.UUID, now time.Time) error
+	CompleteErasure(ctx context.Context, id uuid.UUID) error
+	DeferErasure(ctx context.Context, id uuid.UUID, next time.Time) error
 }
 
+var (
+	// ErrTOTPCodeReused is returned for a TOTP code whose time step was already used
+	ErrTOTPCodeReused = errors.New("totp code already used")
+
+	// ErrAccountErased is returned for changes to an account whose data was erased
+	ErrAccountErased = errors.New("account was erased")
+
+	// ErrDeletionCancelled is returned when erasing an account whose deletion is no
+	// longer due
+	ErrDeletionCancelled = errors.New("account deletion was cancelled")
+)
+
 type UserRepository struct {
 	IBaseRepository[models.User] // generic CRUD
 	db                           *gorm.DB
@@ -27,19 +58,77 @@ func NewUserRepository(db *gorm.DB) IUserRepository {
 	}
 }
 
+// GetByID loads the user with its role, which tokens are issued for
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Preload("Role").Preload("Roles").First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UserFilter narrows a user listing. Zero fields do not filter.
+type UserFilter struct {
+	Search   string     // part of the name or email
+	RoleID   *uuid.UUID // held as primary or additional role
+	Disabled *bool
+}
+
+// GetPage returns a page of the users matching filter, ordered by email, and how
+// many match in total
+func (r *UserRepository) GetPage(ctx context.Context, filter UserFilter, offset int, limit int) ([]models.User, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.User{})
+
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("name ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if filter.RoleID != nil {
+		query = query.Where("role_id = ? OR id IN (SELECT user_id FROM user_roles WHERE role_id = ?)", *filter.RoleID, *filter.RoleID)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	if err := query.Preload("Role").Preload("Roles").
+		Order("email").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetByRole returns the users holding the role, as primary or additional role
 func (r *UserRepository) GetByRole(ctx context.Context, roleID uuid.UUID) ([]models.User, error) {
 	var users []models.User
 
 	if err := r.db.WithContext(ctx).
-		Where("role_id = ?", roleID).Find(&users).Error; err != nil {
+		Where("role_id = ?", roleID).
+		Or("id IN (SELECT user_id FROM user_roles WHERE role_id = ?)", roleID).
+		Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
+// GetByEmail finds the user by email, ignoring case. Emails are stored lowercase,
+// the comparison also covers accounts created before they were.
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	if err := r.db.WithContext(ctx).Preload("Role").Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("Role").Preload("Roles").Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -52,3 +141,219 @@ func (r *UserRepository) GetByName(ctx context.Context, name string) ([]models.U
 	}
 	return users, nil
 }
+
+// RecordLoginFailure counts a failed login and returns the consecutive failures. A
+// failure more than window after the previous one starts counting again. The count
+// is incremented in the database, so concurrent guesses cannot undercount.
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id uuid.UUID, window time.Duration) (int, error) {
+	now := time.Now()
+
+	var failures int
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE users
+		SET failed_login_attempts = CASE
+				WHEN last_failed_login_at IS NULL OR last_failed_login_at < ? THEN 1
+				ELSE failed_login_attempts + 1
+			END,
+			last_failed_login_at = ?
+		WHERE id = ?
+		RETURNING failed_login_attempts`, now.Add(-window), now, id).
+		Scan(&failures).Error
+	return failures, err
+}
+
+// LockUntil refuses logins of the user until the given time
+func (r *UserRepository) LockUntil(ctx context.Context, id uuid.UUID, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", id).
+		UpdateColumn("locked_until", until).Error
+}
+
+// ResetLoginFailures clears the failed logins and any lock of the user, and those
+// tracked for their email address
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var email string
+		if err := tx.Raw(`
+			UPDATE users
+			SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+			WHERE id = ?
+			RETURNING email`, id).
+			Scan(&email).Error; err != nil {
+			return err
+		}
+		if email == "" {
+			return nil
+		}
+		return tx.Where("email_hash = ?", auth.LoginAttemptKey(email)).Delete(&models.LoginAttempt{}).Error
+	})
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code. It fails for steps at
+// or before the last one recorded, so every code is accepted at most once.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+	return nil
+}
+
+// SetRoles replaces the primary and additional roles of user. The primary role is
+// never kept among the additional ones.
+func (r *UserRepository) SetRoles(ctx context.Context, user *models.User, primary models.Role, additional []models.Role) error {
+	additional = slices.DeleteFunc(slices.Clone(additional), func(role models.Role) bool {
+		return role.ID == primary.ID
+	})
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("role_id", primary.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Association("Roles").Replace(additional)
+	})
+}
+
+// SetDisabled disables the user, or enables it again when disabledAt is nil
+func (r *UserRepository) SetDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", id).
+		Update("disabled_at", disabledAt).Error
+}
+
+// UpdateProfile changes the fields users edit themselves, leaving the security
+// state of the account alone
+func (r *UserRepository) UpdateProfile(ctx context.Context, id uuid.UUID, name string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", id).
+		Update("name", name).Error
+}
+
+// ReplacePasswordHash stores a new hash of the same password. It only applies while
+// the stored hash is still current, so a password changed meanwhile is kept.
+func (r *UserRepository) ReplacePasswordHash(ctx context.Context, id uuid.UUID, current string, next string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND password = ?", id, current).
+		UpdateColumn("password", next).Error
+}
+
+// ScheduleDeletion sets when the personal data of the user is erased, or cancels the
+// deletion when at is nil. Erased accounts cannot be changed any more.
+func (r *UserRepository) ScheduleDeletion(ctx context.Context, id uuid.UUID, at *time.Time) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND erased_at IS NULL", id).
+		UpdateColumns(map[string]any{
+			"deletion_scheduled_at":   at,
+			"erasure_attempts":        0,
+			"next_erasure_attempt_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccountErased
+	}
+	return nil
+}
+
+// GetDueForErasure returns the users whose deletion is due at now, those never
+// attempted or waiting longest first. Users erased here but not yet in every other
+// service are due until CompleteErasure, as soon as their retry comes up.
+func (r *UserRepository) GetDueForErasure(ctx context.Context, now time.Time, limit int) ([]models.User, error) {
+	var users []models.User
+	if err := r.db.WithContext(ctx).
+		Where("deletion_scheduled_at <= ?", now).
+		Where("next_erasure_attempt_at IS NULL OR next_erasure_attempt_at <= ?", now).
+		Order("COALESCE(next_erasure_attempt_at, deletion_scheduled_at)").
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Erase deletes the personal data of a user whose deletion is due at now, and
+// leaves the account as a disabled shell nobody can sign in to. The deletion stays
+// scheduled until CompleteErasure, once the other services erased their data too.
+func (r *UserRepository) Erase(ctx context.Context, id uuid.UUID, now time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND erased_at IS NULL AND deletion_scheduled_at <= ?", id, now).
+			UpdateColumns(map[string]any{
+				"email":                 "erased-" + id.String() + "@invalid",
+				"name":                  "Deleted user",
+				"password":              "",
+				"email_verified_at":     nil,
+				"failed_login_attempts": 0,
+				"last_failed_login_at":  nil,
+				"locked_until":          nil,
+				"disabled_at":           gorm.Expr("COALESCE(disabled_at, ?)", now),
+				"totp_secret":           "",
+				"totp_enabled_at":       nil,
+				"erased_at":             now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDeletionCancelled
+		}
+
+		for _, model := range []any{
+			&models.Address{},
+			&models.Session{},
+			&models.RefreshToken{},
+			&models.APIKey{},
+			&models.UserIdentity{},
+			&models.RecoveryCode{},
+			&models.OAuthConsent{},
+			&models.OAuthAuthorizationCode{},
+			&models.PasswordResetToken{},
+			&models.EmailVerificationToken{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CompleteErasure records that every service erased the data of the user
+func (r *UserRepository) CompleteErasure(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND erased_at IS NOT NULL", id).
+		UpdateColumns(map[string]any{
+			"deletion_scheduled_at":   nil,
+			"erasure_attempts":        0,
+			"next_erasure_attempt_at": nil,
+		}).Error
+}
+
+// DeferErasure records a failed erasure attempt, retried once next passes
+func (r *UserRepository) DeferErasure(ctx context.Context, id uuid.UUID, next time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", id).
+		UpdateColumns(map[string]any{
+			"erasure_attempts":        gorm.Expr("erasure_attempts + 1"),
+			"next_erasure_attempt_at": next,
+		}).Error
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}